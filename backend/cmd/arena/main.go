@@ -0,0 +1,153 @@
+// Command arena plays two engines against each other on the real board
+// rules and reports how they compare. Engines are given as specs:
+//
+//	bot                     the built-in bot with the default config
+//	bot:randomness=0.05     the built-in bot with some settings changed
+//	random                  a uniformly random legal move, as a baseline
+//
+// Usage:
+//
+//	go run ./cmd/arena -a bot -b bot:randomness=0.5 -games 1000 -export games.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/game"
+)
+
+// newEngine returns a factory for the engine described by spec, which
+// builds it for the symbol it plays in a game
+func newEngine(spec string) (func(symbol int) game.Engine, error) {
+	name, params, _ := strings.Cut(spec, ":")
+	switch name {
+	case "random":
+		if params != "" {
+			return nil, fmt.Errorf("%s: random takes no settings", spec)
+		}
+		return func(int) game.Engine { return randomEngine{} }, nil
+	case "bot":
+		cfg := config.Default().Game.Bot
+		for _, kv := range strings.Split(params, ",") {
+			if kv == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(kv, "=")
+			switch key {
+			case "randomness":
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil || f < 0 || f > 1 {
+					return nil, fmt.Errorf("%s: randomness must be between 0 and 1", spec)
+				}
+				cfg.Randomness = f
+			default:
+				return nil, fmt.Errorf("%s: unknown setting %q", spec, key)
+			}
+		}
+		return func(symbol int) game.Engine { return game.NewBot(symbol, cfg) }, nil
+	}
+	return nil, fmt.Errorf("unknown engine %q (want bot or random)", spec)
+}
+
+// randomEngine plays any legal column
+type randomEngine struct{}
+
+func (randomEngine) GetMove(b *game.Board) int {
+	var cols []int
+	for c := 0; c < game.Cols; c++ {
+		if b[0][c] == 0 {
+			cols = append(cols, c)
+		}
+	}
+	if len(cols) == 0 {
+		return -1
+	}
+	return cols[rand.Intn(len(cols))]
+}
+
+// result is one finished game. Winner is -1 for a draw, otherwise the index
+// (0 = A, 1 = B) of the engine that won.
+type result struct {
+	first  int   // Index of the engine that moved first
+	moves  []int // Columns, 0-based, starting with the first mover
+	winner int
+	reason string // "connect4", "draw" or "illegal"
+}
+
+// play runs one game. The first mover plays symbol 1.
+func play(engines [2]func(int) game.Engine, first int, times *[2][]time.Duration) result {
+	board := game.NewBoard()
+	players := [2]game.Engine{}
+	players[first] = engines[first](1)
+	players[1-first] = engines[1-first](2)
+
+	r := result{first: first, winner: -1}
+	turn := first
+	for {
+		symbol := 1
+		if turn != first {
+			symbol = 2
+		}
+		start := time.Now()
+		col := players[turn].GetMove(board)
+		times[turn] = append(times[turn], time.Since(start))
+
+		row := board.DropDisc(col, symbol)
+		if row == -1 {
+			r.winner, r.reason = 1-turn, "illegal"
+			return r
+		}
+		r.moves = append(r.moves, col)
+		if board.CheckWin(row, col, symbol) {
+			r.winner, r.reason = turn, "connect4"
+			return r
+		}
+		if board.IsFull() {
+			r.reason = "draw"
+			return r
+		}
+		turn = 1 - turn
+	}
+}
+
+func main() {
+	specA := flag.String("a", "bot", "engine A")
+	specB := flag.String("b", "random", "engine B")
+	games := flag.Int("games", 100, "games to play, A and B taking turns to move first")
+	export := flag.String("export", "", "file to write the move sequence of every game to")
+	flag.Parse()
+
+	if *games < 1 {
+		log.Fatal("-games must be positive")
+	}
+	var engines [2]func(int) game.Engine
+	for i, spec := range []string{*specA, *specB} {
+		e, err := newEngine(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		engines[i] = e
+	}
+
+	var times [2][]time.Duration
+	results := make([]result, 0, *games)
+	for i := 0; i < *games; i++ {
+		results = append(results, play(engines, i%2, &times))
+	}
+
+	report(os.Stdout, [2]string{*specA, *specB}, results, times)
+	if *export != "" {
+		if err := exportGames(*export, [2]string{*specA, *specB}, results); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\nGames written to %s\n", *export)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// z is the normal quantile for the 95% intervals reported
+const z = 1.96
+
+// wilson returns the 95% Wilson score interval of k successes in n trials
+func wilson(k, n int) (lo, hi float64) {
+	p := float64(k) / float64(n)
+	nf := float64(n)
+	denom := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denom
+	half := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denom
+	return center - half, center + half
+}
+
+// elo converts an expected score into a rating difference
+func elo(score float64) float64 {
+	return -400 * math.Log10(1/score-1)
+}
+
+func formatElo(score float64) string {
+	if score <= 0 || score >= 1 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.0f", elo(score))
+}
+
+// report prints the results from A's point of view
+func report(w io.Writer, specs [2]string, results []result, times [2][]time.Duration) {
+	n := len(results)
+	var wins, draws, losses, illegal, plies int
+	var firstWins, firstGames int
+	minLen, maxLen := math.MaxInt, 0
+	scores := make([]float64, n)
+	for i, r := range results {
+		switch r.winner {
+		case 0:
+			wins++
+			scores[i] = 1
+		case 1:
+			losses++
+		default:
+			draws++
+			scores[i] = 0.5
+		}
+		if r.reason == "illegal" {
+			illegal++
+		}
+		if r.first == 0 {
+			firstGames++
+			if r.winner == 0 {
+				firstWins++
+			}
+		}
+		plies += len(r.moves)
+		minLen = min(minLen, len(r.moves))
+		maxLen = max(maxLen, len(r.moves))
+	}
+
+	fmt.Fprintf(w, "A: %s\nB: %s\nGames: %d (A moved first in %d)\n\n", specs[0], specs[1], n, firstGames)
+	for _, row := range []struct {
+		label string
+		k     int
+	}{{"A wins", wins}, {"Draws", draws}, {"B wins", losses}} {
+		lo, hi := wilson(row.k, n)
+		fmt.Fprintf(w, "%-7s %5d  %5.1f%%  [%5.1f%%, %5.1f%%]\n", row.label, row.k, 100*float64(row.k)/float64(n), 100*lo, 100*hi)
+	}
+
+	// Mean score with a normal interval from the per-game variance
+	mean := (float64(wins) + float64(draws)/2) / float64(n)
+	variance := 0.0
+	for _, s := range scores {
+		variance += (s - mean) * (s - mean)
+	}
+	half := z * math.Sqrt(variance/float64(n)) / math.Sqrt(float64(n))
+	lo, hi := math.Max(mean-half, 0), math.Min(mean+half, 1)
+	fmt.Fprintf(w, "\nA score %.3f [%.3f, %.3f], Elo difference %s [%s, %s]\n", mean, lo, hi, formatElo(mean), formatElo(lo), formatElo(hi))
+	if firstGames > 0 && firstGames < n {
+		fmt.Fprintf(w, "A won %d/%d moving first, %d/%d moving second\n", firstWins, firstGames, wins-firstWins, n-firstGames)
+	}
+	if illegal > 0 {
+		fmt.Fprintf(w, "%d game(s) ended on an illegal move\n", illegal)
+	}
+	fmt.Fprintf(w, "Game length: %.1f plies on average (min %d, max %d)\n", float64(plies)/float64(n), minLen, maxLen)
+
+	fmt.Fprintf(w, "\nMove time     mean       p50       p95       max\n")
+	for i, label := range []string{"A", "B"} {
+		t := append([]time.Duration(nil), times[i]...)
+		if len(t) == 0 {
+			continue
+		}
+		sort.Slice(t, func(a, b int) bool { return t[a] < t[b] })
+		var total time.Duration
+		for _, d := range t {
+			total += d
+		}
+		fmt.Fprintf(w, "%-9s %9s %9s %9s %9s\n", label, total/time.Duration(len(t)), percentile(t, 0.5), percentile(t, 0.95), t[len(t)-1])
+	}
+}
+
+// percentile of sorted durations
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+// exportGames writes one game per line: which engine moved first, the
+// columns played as digits 1-7 from the first move on, and the result from
+// the first mover's side (1-0, 0-1 or 1/2-1/2).
+func exportGames(path string, specs [2]string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# A: %s\n# B: %s\n", specs[0], specs[1])
+	for _, r := range results {
+		var moves strings.Builder
+		for _, col := range r.moves {
+			moves.WriteByte(byte('1' + col))
+		}
+		outcome := "1/2-1/2"
+		switch r.winner {
+		case r.first:
+			outcome = "1-0"
+		case 1 - r.first:
+			outcome = "0-1"
+		}
+		fmt.Fprintf(w, "%c %s %s\n", "AB"[r.first], moves.String(), outcome)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,172 @@
+// Command engine connects a local engine program to the server as an
+// external engine. The program is started with the arguments after the
+// flags and spoken to over stdin/stdout, one command per line:
+//
+//	isready                    -> readyok
+//	newgame <symbol>              the engine plays discs of <symbol> (1 or 2)
+//	position <board> <symbol>     six rows, top first, "/" separated, e.g.
+//	                              0000000/0000000/0000000/0000000/0000000/0001200
+//	go movetime <ms>           -> bestmove <column 1-7>
+//	quit
+//
+// Lines the engine prints that don't answer a command are ignored, so it
+// may report progress. If the program exits, the connection is closed and
+// any game it was playing is forfeited.
+//
+// Usage:
+//
+//	ENGINE_TOKEN=eng_... go run ./cmd/engine -url ws://localhost:8080/engine -- ./my-engine --depth 8
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectfour/pkg/client"
+	"connectfour/pkg/models"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/engine", "engine websocket endpoint")
+	token := flag.String("token", os.Getenv("ENGINE_TOKEN"), "engine token (default $ENGINE_TOKEN)")
+	margin := flag.Duration("margin", 200*time.Millisecond, "part of the server's move time kept back for the network")
+	verbose := flag.Bool("v", false, "log every line exchanged with the engine")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: engine [flags] -- <engine command> [args...]")
+	}
+	if *token == "" {
+		log.Fatal("-token or ENGINE_TOKEN is required")
+	}
+
+	proc, err := start(flag.Args(), *verbose)
+	if err != nil {
+		log.Fatalf("Could not start engine: %v", err)
+	}
+	defer proc.stop()
+	if err := proc.send("isready"); err != nil {
+		log.Fatalf("Engine not responding: %v", err)
+	}
+	if _, err := proc.expect("readyok", 10*time.Second); err != nil {
+		log.Fatalf("Engine not ready: %v", err)
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + *token}}
+	c, err := client.Dial(*url, client.Options{Header: header})
+	if err != nil {
+		log.Fatalf("Could not connect: %v", err)
+	}
+	defer c.Close()
+	log.Printf("Connected to %s, waiting for opponents", *url)
+
+	a := &adapter{proc: proc, client: c, margin: *margin}
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				return
+			}
+			if err := a.handle(ev); err != nil {
+				log.Printf("Engine failed: %v", err)
+				return
+			}
+		case <-proc.exited:
+			log.Print("Engine exited")
+			return
+		}
+	}
+}
+
+// adapter turns server messages into engine commands and back
+type adapter struct {
+	proc   *process
+	client *client.Client
+	margin time.Duration
+
+	symbol   int
+	moveTime time.Duration
+}
+
+func (a *adapter) handle(ev client.Event) error {
+	if ev.Err != nil && ev.Type != client.Disconnected {
+		log.Printf("Unreadable %s: %v", ev.Type, ev.Err)
+		return nil
+	}
+
+	switch ev.Type {
+	case models.MsgGameStart:
+		a.symbol = ev.Start.Symbol
+		a.moveTime = time.Duration(ev.Start.MoveTime) * time.Millisecond
+		log.Printf("Game %s against %s", ev.Start.GameID, ev.Start.Opponent)
+		if err := a.proc.send("newgame %d", a.symbol); err != nil {
+			return err
+		}
+		if ev.Start.IsTurn {
+			return a.move([6][7]int{})
+		}
+	case models.MsgUpdate:
+		if ev.Update.IsYourTurn {
+			return a.move(ev.Update.Board)
+		}
+	case models.MsgGameOver:
+		log.Printf("Game over: %s (%s)", ev.GameOver.Winner, ev.GameOver.Reason)
+	case models.MsgError:
+		log.Printf("Server error: %s", ev.Error.Message)
+	case client.Disconnected:
+		log.Printf("Disconnected (%v), reconnecting", ev.Err)
+	case client.Reconnected:
+		log.Print("Reconnected, waiting for opponents")
+	}
+	return nil
+}
+
+// move asks the engine for a move on board and plays it. An engine that
+// answers with an illegal move resigns; one that doesn't answer in time
+// is given up on, as its late answer would be for the wrong position.
+func (a *adapter) move(board [6][7]int) error {
+	think := a.moveTime - a.margin
+	if a.moveTime == 0 || think < a.moveTime/2 {
+		think = a.moveTime / 2
+	}
+	if err := a.proc.send("position %s %d", encodeBoard(board), a.symbol); err != nil {
+		return err
+	}
+	if err := a.proc.send("go movetime %d", think.Milliseconds()); err != nil {
+		return err
+	}
+
+	wait := a.moveTime
+	if wait == 0 {
+		wait = time.Minute
+	}
+	answer, err := a.proc.expect("bestmove", wait)
+	if err != nil {
+		return err
+	}
+	col, err := strconv.Atoi(answer)
+	if err != nil || col < 1 || col > 7 || board[0][col-1] != 0 {
+		log.Printf("Illegal move %q, resigning", answer)
+		return a.client.Resign()
+	}
+	return a.client.Move(col - 1)
+}
+
+// encodeBoard writes the rows top first, as the server sends them
+func encodeBoard(board [6][7]int) string {
+	rows := make([]string, len(board))
+	for r, row := range board {
+		var b strings.Builder
+		for _, cell := range row {
+			fmt.Fprint(&b, cell)
+		}
+		rows[r] = b.String()
+	}
+	return strings.Join(rows, "/")
+}
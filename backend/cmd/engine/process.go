@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var errExited = errors.New("engine process exited")
+
+// process is a running engine, spoken to one line at a time
+type process struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan string   // Closed when stdout ends
+	exited  chan struct{} // Closed once the process is gone
+	verbose bool
+}
+
+func start(args []string, verbose bool) (*process, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{cmd: cmd, stdin: stdin, lines: make(chan string, 16), exited: make(chan struct{}), verbose: verbose}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+		close(p.lines)
+		cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+func (p *process) send(format string, args ...interface{}) error {
+	line := fmt.Sprintf(format, args...)
+	if p.verbose {
+		log.Printf("> %s", line)
+	}
+	_, err := io.WriteString(p.stdin, line+"\n")
+	return err
+}
+
+// expect waits for a line starting with keyword and returns the rest of
+// it. Other lines, such as progress info, are skipped.
+func (p *process) expect(keyword string, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return "", errExited
+			}
+			if p.verbose {
+				log.Printf("< %s", line)
+			}
+			fields := strings.Fields(line)
+			if len(fields) > 0 && fields[0] == keyword {
+				return strings.Join(fields[1:], " "), nil
+			}
+		case <-deadline:
+			return "", fmt.Errorf("no %q within %s", keyword, timeout)
+		}
+	}
+}
+
+// stop asks the engine to quit and kills it if it doesn't
+func (p *process) stop() {
+	p.send("quit")
+	p.stdin.Close()
+	select {
+	case <-p.exited:
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// script is a tiny engine: it reports progress before answering, and exits
+// on quit
+const script = `
+while read cmd rest; do
+	case "$cmd" in
+	isready) echo readyok ;;
+	go) echo "info depth 1"; echo "bestmove 4" ;;
+	quit) exit 0 ;;
+	esac
+done`
+
+func TestProcessExpect(t *testing.T) {
+	p, err := start([]string{"sh", "-c", script}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.stop()
+
+	if err := p.send("isready"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.expect("readyok", time.Second); err != nil {
+		t.Fatalf("expect readyok: %v", err)
+	}
+
+	p.send("go movetime %d", 100)
+	move, err := p.expect("bestmove", time.Second)
+	if err != nil || move != "4" {
+		t.Fatalf("expect bestmove = %q, %v, want 4", move, err)
+	}
+
+	// Nothing answers newgame
+	p.send("newgame 1")
+	if _, err := p.expect("bestmove", 50*time.Millisecond); err == nil {
+		t.Fatal("expect returned without an answer")
+	}
+
+	p.send("quit")
+	if _, err := p.expect("bestmove", time.Second); !errors.Is(err, errExited) {
+		t.Fatalf("expect after quit: %v, want errExited", err)
+	}
+}
+
+func TestProcessStopKillsStuckEngine(t *testing.T) {
+	p, err := start([]string{"sh", "-c", "trap '' TERM; while :; do sleep 1; done"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		p.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("stop waited on an engine that ignores quit")
+	}
+}
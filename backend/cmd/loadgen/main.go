@@ -0,0 +1,89 @@
+// Command loadgen simulates many players against a running server to see
+// how it holds up. Every player connects to /ws, JOINs, plays random legal
+// moves after a think time and queues again after each game. Some drop
+// their connection mid-game and rejoin, to exercise the reconnect path.
+//
+// Usage:
+//
+//	go run ./cmd/loadgen -url ws://localhost:8080/ws -players 1000 -duration 2m
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+type options struct {
+	url         string
+	prefix      string
+	think       time.Duration
+	disconnect  float64
+	rejoinAfter time.Duration
+	idle        time.Duration
+	bot         bool
+	casual      bool
+}
+
+func main() {
+	var opts options
+	players := flag.Int("players", 100, "simulated players")
+	duration := flag.Duration("duration", time.Minute, "how long to run")
+	ramp := flag.Duration("ramp", 10*time.Second, "time over which players connect")
+	every := flag.Duration("progress", 10*time.Second, "interval between progress lines")
+	flag.StringVar(&opts.url, "url", "ws://localhost:8080/ws", "websocket endpoint")
+	flag.StringVar(&opts.prefix, "prefix", fmt.Sprintf("load-%04d", rand.Intn(10000)), "username prefix, unique per run")
+	flag.DurationVar(&opts.think, "think", 500*time.Millisecond, "average think time per move (±50%)")
+	flag.Float64Var(&opts.disconnect, "disconnect", 0.02, "chance (0-1) to drop the connection before a move and rejoin")
+	flag.DurationVar(&opts.rejoinAfter, "rejoin-after", 2*time.Second, "time a dropped player stays away")
+	flag.DurationVar(&opts.idle, "timeout", 30*time.Second, "longest wait for the server before counting a timeout")
+	flag.BoolVar(&opts.bot, "bot", false, "let the server fall back to the bot for unmatched players")
+	flag.BoolVar(&opts.casual, "casual", true, "queue for casual games, so no ratings are touched")
+	flag.Parse()
+
+	if *players < 1 {
+		log.Fatal("-players must be positive")
+	}
+	if opts.disconnect < 0 || opts.disconnect > 1 {
+		log.Fatal("-disconnect must be between 0 and 1")
+	}
+
+	fmt.Printf("Running %d players against %s for %s\n", *players, opts.url, *duration)
+	stats := newStats()
+	start := time.Now()
+	deadline := start.Add(*duration)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(*every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				stats.progress(os.Stdout, time.Since(start))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *players; i++ {
+		wg.Add(1)
+		delay := time.Duration(int64(*ramp) * int64(i) / int64(*players))
+		p := &player{opts: opts, stats: stats, username: fmt.Sprintf("%s-%d", opts.prefix, i)}
+		go func() {
+			defer wg.Done()
+			time.Sleep(delay)
+			p.run(deadline)
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	stats.report(os.Stdout, time.Since(start))
+}
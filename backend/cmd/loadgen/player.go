@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"connectfour/pkg/client"
+	"connectfour/pkg/models"
+)
+
+var (
+	errDropped = errors.New("dropped on purpose") // Ends a session the player hung up on purpose
+	errTimeout = errors.New("timed out waiting for the server")
+)
+
+// player is one simulated client
+type player struct {
+	opts     options
+	stats    *stats
+	username string
+
+	client   *client.Client // Reconnects are driven here, to time them
+	joinedAt time.Time      // Last JOIN, for match and rejoin times
+	moveAt   time.Time      // Last MOVE not yet answered by an UPDATE
+	rejoin   bool           // The last JOIN was a rejoin
+	playing  bool
+}
+
+// run plays until the deadline, reconnecting after every drop
+func (p *player) run(deadline time.Time) {
+	for time.Now().Before(deadline) {
+		err := p.session(deadline)
+		if p.client != nil {
+			p.client.Close()
+			p.client = nil
+		}
+		switch {
+		case err == errDropped:
+			time.Sleep(p.opts.rejoinAfter)
+			p.rejoin = p.playing
+		case err != nil:
+			p.stats.fail(err)
+			p.rejoin = p.playing
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// session is one connection: JOIN, then games until the deadline or a drop
+func (p *player) session(deadline time.Time) error {
+	c, err := client.Dial(p.opts.url, client.Options{NoReconnect: true})
+	if err != nil {
+		return err
+	}
+	p.client = c
+	p.stats.count("connects")
+	if err := p.join(); err != nil {
+		return err
+	}
+
+	for time.Now().Before(deadline) {
+		// Opponents stop at the deadline too, so waiting past it is no error
+		wait := min(p.opts.idle, time.Until(deadline))
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				return nil
+			}
+			if ev.Type == client.Disconnected {
+				return ev.Err
+			}
+			if err := p.handle(ev, deadline); err != nil {
+				return err
+			}
+		case <-time.After(wait):
+			if time.Now().Before(deadline) {
+				return errTimeout
+			}
+		}
+	}
+	return nil
+}
+
+func (p *player) join() error {
+	p.joinedAt = time.Now()
+	return p.client.Join(models.JoinPayload{Username: p.username, Casual: p.opts.casual, NoBot: !p.opts.bot})
+}
+
+func (p *player) handle(ev client.Event, deadline time.Time) error {
+	if ev.Err != nil {
+		p.stats.protocol("bad " + string(ev.Type) + " payload")
+		return nil
+	}
+
+	switch ev.Type {
+	case models.MsgGameStart:
+		p.moveAt = time.Time{}
+		if p.rejoin {
+			// The board follows in an UPDATE
+			p.stats.observe("rejoin", time.Since(p.joinedAt))
+			p.rejoin = false
+			p.playing = true
+			return nil
+		}
+		if !p.playing {
+			p.stats.observe("match", time.Since(p.joinedAt))
+		}
+		p.playing = true
+		if ev.Start.IsTurn {
+			return p.move([6][7]int{})
+		}
+
+	case models.MsgUpdate:
+		if !p.moveAt.IsZero() {
+			p.stats.observe("move", time.Since(p.moveAt))
+			p.moveAt = time.Time{}
+		}
+		if ev.Update.IsYourTurn {
+			return p.move(ev.Update.Board)
+		}
+
+	case models.MsgGameOver:
+		over := ev.GameOver
+		p.stats.count("games")
+		p.stats.count("reason " + over.Reason)
+		p.moveAt = time.Time{}
+		if over.Series != nil && !over.Series.Finished {
+			return nil // The next game of the series starts by itself
+		}
+		p.playing = false
+		if time.Now().Before(deadline) {
+			return p.join()
+		}
+
+	case models.MsgQueueStatus:
+		// A rejoin that lands in the queue means the game was lost meanwhile
+		if p.rejoin {
+			p.stats.count("rejoins lost")
+			p.rejoin = false
+			p.playing = false
+			p.joinedAt = time.Now()
+		}
+
+	case models.MsgError:
+		p.stats.protocol("ERROR: " + ev.Error.Message)
+
+	case models.MsgShutdown, models.MsgRematchOffer, models.MsgRematchDecline, models.MsgPresence:
+		// Not part of the load pattern
+
+	default:
+		p.stats.protocol("unexpected " + string(ev.Type))
+	}
+	return nil
+}
+
+// move thinks, then plays a random legal column, unless it is time to drop
+func (p *player) move(board [6][7]int) error {
+	var cols []int
+	for c := 0; c < 7; c++ {
+		if board[0][c] == 0 {
+			cols = append(cols, c)
+		}
+	}
+	if len(cols) == 0 {
+		p.stats.protocol("asked to move on a full board")
+		return nil
+	}
+
+	if rand.Float64() < p.opts.disconnect {
+		p.stats.count("drops")
+		return errDropped
+	}
+	if p.opts.think > 0 {
+		time.Sleep(p.opts.think/2 + time.Duration(rand.Int63n(int64(p.opts.think))))
+	}
+	p.moveAt = time.Now()
+	p.stats.count("moves")
+	return p.client.Move(cols[rand.Intn(len(cols))])
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats collects what every player saw
+type stats struct {
+	mutex     sync.Mutex
+	counts    map[string]int
+	durations map[string][]time.Duration // "move", "match", "rejoin"
+	protocols map[string]int             // Protocol errors by kind
+	failures  map[string]int             // Connection errors by kind
+}
+
+func newStats() *stats {
+	return &stats{
+		counts:    map[string]int{},
+		durations: map[string][]time.Duration{},
+		protocols: map[string]int{},
+		failures:  map[string]int{},
+	}
+}
+
+func (s *stats) count(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counts[name]++
+}
+
+func (s *stats) observe(name string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.durations[name] = append(s.durations[name], d)
+}
+
+func (s *stats) protocol(kind string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.protocols[kind]++
+}
+
+// fail records a connection error, without the addresses that would make
+// every one of them distinct
+func (s *stats) fail(err error) {
+	kind := err.Error()
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		kind = opErr.Op + ": " + opErr.Err.Error()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[kind]++
+}
+
+// progress prints a one-line summary while the run goes on
+func (s *stats) progress(w io.Writer, elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	errs := 0
+	for _, n := range s.protocols {
+		errs += n
+	}
+	for _, n := range s.failures {
+		errs += n
+	}
+	fmt.Fprintf(w, "[%s] moves=%d games=%d drops=%d errors=%d move p50=%s\n",
+		elapsed.Round(time.Second), s.counts["moves"], s.counts["games"], s.counts["drops"], errs, quantile(s.durations["move"], 0.5))
+}
+
+// report prints the final numbers
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	secs := elapsed.Seconds()
+	fmt.Fprintf(w, "\nRan for %s\n", elapsed.Round(time.Second))
+	fmt.Fprintf(w, "Connections: %d  Moves: %d (%.1f/s)  Games: %d (%.1f/s)\n",
+		s.counts["connects"], s.counts["moves"], float64(s.counts["moves"])/secs, s.counts["games"], float64(s.counts["games"])/secs)
+	fmt.Fprintf(w, "Drops: %d  Rejoins: %d  Rejoins that lost their game: %d\n",
+		s.counts["drops"], len(s.durations["rejoin"]), s.counts["rejoins lost"])
+
+	fmt.Fprintf(w, "\n%-22s %7s %10s %10s %10s %10s\n", "", "count", "p50", "p90", "p99", "max")
+	for _, row := range []struct{ name, label string }{
+		{"move", "Move -> UPDATE"},
+		{"match", "JOIN -> START"},
+		{"rejoin", "Rejoin -> START"},
+	} {
+		d := s.durations[row.name]
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+		fmt.Fprintf(w, "%-22s %7d %10s %10s %10s %10s\n", row.label, len(d), quantile(d, 0.5), quantile(d, 0.9), quantile(d, 0.99), quantile(d, 1))
+	}
+
+	var reasons []string
+	for name, n := range s.counts {
+		if r, ok := strings.CutPrefix(name, "reason "); ok {
+			reasons = append(reasons, fmt.Sprintf("%s=%d", r, n))
+		}
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(w, "\nGame results: %s\n", strings.Join(reasons, " "))
+
+	printTally(w, "Protocol errors", s.protocols)
+	printTally(w, "Connection errors", s.failures)
+}
+
+func printTally(w io.Writer, title string, tally map[string]int) {
+	if len(tally) == 0 {
+		fmt.Fprintf(w, "%s: none\n", title)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	keys := make([]string, 0, len(tally))
+	for k := range tally {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return tally[keys[a]] > tally[keys[b]] })
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %6d  %s\n", tally[k], k)
+	}
+}
+
+// quantile of durations, sorted or not; q=1 is the maximum
+func quantile(d []time.Duration, q float64) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	if !sort.SliceIsSorted(d, func(a, b int) bool { return d[a] < d[b] }) {
+		d = append([]time.Duration(nil), d...)
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+	}
+	return d[int(q*float64(len(d)-1))]
+}
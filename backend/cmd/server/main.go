@@ -2,13 +2,24 @@ package main
 
 import (
 	"connectfour/internal/api"
+	"connectfour/internal/cluster"
+	"connectfour/internal/config"
 	"connectfour/internal/db"
 	"connectfour/internal/event"
 	"connectfour/internal/game"
-	"fmt"
+	"connectfour/internal/health"
+	"connectfour/internal/metrics"
+	"connectfour/internal/tournament"
+	"connectfour/internal/webhook"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
@@ -27,17 +38,16 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 func main() {
 	log.Println("Starting Connect 4 Server...")
 
-	// 1. Database Connection (Required)
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = fmt.Sprintf("postgres://%s:%s@localhost:5432/%s?sslmode=disable",
-			getEnv("DB_USER", "user"),
-			getEnv("DB_PASSWORD", "password"),
-			getEnv("DB_NAME", "connect4"),
-		)
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	repository, err := db.NewRepository(dsn)
+	// 1. Database Connection (Required)
+	repository, err := db.NewRepository(cfg.Database)
 	if err != nil {
 		// It is okay to crash if DB fails, as game state depends on it
 		log.Printf("WARNING: Could not connect to Database: %v", err)
@@ -45,51 +55,102 @@ func main() {
 		log.Println("Connected to Postgres successfully.")
 	}
 
-	// 2. Kafka Connection (Optional - Graceful Degradation)
+	// 2. Event Sinks (Optional - Graceful Degradation)
+	var sinks []event.EventSink
 	var producer *event.Producer
-	kafkaURL := os.Getenv("KAFKA_URL")
-	
-	if kafkaURL != "" {
-		// Cloud / Configured Mode
-		log.Println("Attempting to connect to Cloud Kafka...")
-		brokers := []string{kafkaURL}
-		p, err := event.NewProducer(brokers)
+	var consumer *event.Consumer
+	if cfg.Kafka.Enabled() {
+		log.Printf("Connecting to Kafka at %v...", cfg.Kafka.Brokers)
+		p, err := event.NewProducer(cfg.Kafka)
 		if err != nil {
-			log.Printf("⚠️ WARNING: Kafka Connection Failed (%v). Analytics will be disabled.", err)
+			log.Printf("⚠️ WARNING: Kafka Connection Failed (%v).", err)
 		} else {
 			producer = p
+			sinks = append(sinks, producer)
 			log.Println("✅ Kafka Producer Connected")
-			defer producer.Close()
 
 			// Only start Consumer if Producer worked
-			consumer, err := event.NewConsumer(brokers)
+			c, err := event.NewConsumer(cfg.Kafka, repository)
 			if err == nil {
+				consumer = c
 				consumer.Start()
 				log.Println("✅ Kafka Consumer Started")
 			}
 		}
-	} else if os.Getenv("KAFKA_ENABLE_LOCAL") == "true" {
-		// Local Docker Mode
-		log.Println("Connecting to Local Docker Kafka...")
-		p, err := event.NewProducer([]string{"localhost:9092"})
-		if err == nil {
-			producer = p
-			log.Println("✅ Local Kafka Connected")
-			defer producer.Close()
-			
-			c, err := event.NewConsumer([]string{"localhost:9092"})
-			if err == nil { c.Start() }
+	}
+	if consumer == nil && repository != nil {
+		// No broker: record analytics in-process instead
+		sinks = append(sinks, event.NewAnalyticsSink(repository))
+		log.Println("ℹ️ No Kafka consumer. Recording analytics in-process.")
+	}
+
+	var natsSink *event.NATSSink
+	if cfg.Events.NATS.URL != "" {
+		n, err := event.NewNATSSink(cfg.Events.NATS)
+		if err != nil {
+			log.Printf("⚠️ WARNING: NATS Connection Failed (%v). Events will not be published there.", err)
+		} else {
+			natsSink = n
+			sinks = append(sinks, natsSink)
+			log.Println("✅ NATS Connected")
+		}
+	}
+	if cfg.Events.Webhook.URL != "" {
+		sinks = append(sinks, event.NewWebhookSink(cfg.Events.Webhook))
+		log.Printf("✅ Posting events to %s", cfg.Events.Webhook.URL)
+	}
+	if cfg.Events.File.Path != "" {
+		f, err := event.NewFileSink(cfg.Events.File.Path)
+		if err != nil {
+			log.Printf("⚠️ WARNING: Could not open event file (%v).", err)
+		} else {
+			sinks = append(sinks, f)
+			log.Printf("✅ Writing events to %s", cfg.Events.File.Path)
+		}
+	}
+	// Webhook subscriptions are stored in the database
+	var webhooks *webhook.Dispatcher
+	if repository != nil {
+		webhooks = webhook.NewDispatcher(cfg.Webhooks, repository)
+		sinks = append(sinks, webhooks)
+	}
+	if len(sinks) == 0 {
+		log.Println("ℹ️ No event sinks configured. Running in NO-ANALYTICS mode.")
+	}
+	sink := event.Fanout(sinks...)
+
+	// 3. Cluster (Optional - lets several instances share one matchmaking queue)
+	var node *cluster.Node
+	if cfg.Cluster.Enabled {
+		if repository == nil {
+			log.Println("⚠️ WARNING: Clustering needs the database. Running as a single instance.")
+		} else {
+			n, err := cluster.NewNode(cfg.Database.DSN(), cfg.Cluster.InstanceID)
+			if err != nil {
+				log.Printf("⚠️ WARNING: Could not join cluster (%v). Running as a single instance.", err)
+			} else {
+				node = n
+				log.Printf("✅ Joined cluster as instance %s", node.ID)
+			}
 		}
-	} else {
-		log.Println("ℹ️ Kafka URL not found. Running in NO-ANALYTICS mode.")
 	}
 
-	// 3. Hub (Handles nil producer gracefully)
-	hub := game.NewHub(repository, producer)
+	// 4. Hub (Handles nil node gracefully)
+	hub := game.NewHub(cfg.Game, repository, sink, node)
+	tournaments := tournament.NewManager(cfg.Tournament, hub, repository)
 
-	// 4. Routes
+	// 5. Routes
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		api.ServeWs(hub, w, r)
+		api.ServeWs(hub, tournaments, w, r)
+	})
+
+	// External engines, registered through the admin API
+	http.HandleFunc("/engine", func(w http.ResponseWriter, r *http.Request) {
+		if repository == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		api.ServeEngine(hub, repository, w, r)
 	})
 	
 	http.HandleFunc("/leaderboard", enableCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -100,22 +161,169 @@ func main() {
 		api.HandleLeaderboard(repository, w, r)
 	}))
 
-	http.HandleFunc("/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("OK"))
+	http.HandleFunc("/ratings", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if repository == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		api.HandleRatings(repository, w, r)
+	}))
+
+	http.HandleFunc("/analytics/summary", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if repository == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		api.HandleAnalyticsSummary(repository, w, r)
 	}))
 
-	// 5. Start
-	port := getEnv("PORT", "8080")
-	log.Printf("Server running on http://0.0.0.0:%s", port)
-	err = http.ListenAndServe(":"+port, nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	http.HandleFunc("/analytics/timeseries", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if repository == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		api.HandleAnalyticsTimeseries(repository, w, r)
+	}))
+
+	// Tournaments (creating and starting them is for organizers, i.e. the admin token)
+	http.HandleFunc("GET /tournaments", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		api.HandleListTournaments(tournaments, w, r)
+	}))
+	http.HandleFunc("POST /tournaments", api.RequireAdmin(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+		api.HandleCreateTournament(tournaments, w, r)
+	}))
+	http.HandleFunc("GET /tournaments/{id}", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		api.HandleGetTournament(tournaments, w, r)
+	}))
+	http.HandleFunc("GET /tournaments/{id}/standings", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTournamentStandings(tournaments, w, r)
+	}))
+	http.HandleFunc("POST /tournaments/{id}/players", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		api.HandleRegisterTournament(tournaments, w, r)
+	}))
+	http.HandleFunc("POST /tournaments/{id}/start", api.RequireAdmin(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+		api.HandleStartTournament(tournaments, w, r)
+	}))
+
+	// Admin API (disabled unless ADMIN_TOKEN is set)
+	adminWebhooks := func(handle func(*webhook.Dispatcher, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+		return api.RequireAdmin(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+			if webhooks == nil {
+				http.Error(w, "Database not available", http.StatusServiceUnavailable)
+				return
+			}
+			handle(webhooks, w, r)
+		})
 	}
-}
+	http.HandleFunc("GET /admin/webhooks", adminWebhooks(api.HandleListWebhooks))
+	http.HandleFunc("POST /admin/webhooks", adminWebhooks(api.HandleCreateWebhook))
+	http.HandleFunc("GET /admin/webhooks/{id}", adminWebhooks(api.HandleGetWebhook))
+	http.HandleFunc("PATCH /admin/webhooks/{id}", adminWebhooks(api.HandleUpdateWebhook))
+	http.HandleFunc("DELETE /admin/webhooks/{id}", adminWebhooks(api.HandleDeleteWebhook))
+	http.HandleFunc("GET /admin/webhooks/{id}/deliveries", adminWebhooks(api.HandleWebhookDeliveries))
+	http.HandleFunc("POST /admin/webhooks/{id}/test", adminWebhooks(api.HandleTestWebhook))
+	http.HandleFunc("GET /admin/games/{id}/chat", api.RequireAdmin(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+		if repository == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		api.HandleGameChat(repository, w, r)
+	}))
+	adminEngines := func(handle func(*db.Repository, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+		return api.RequireAdmin(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+			if repository == nil {
+				http.Error(w, "Database not available", http.StatusServiceUnavailable)
+				return
+			}
+			handle(repository, w, r)
+		})
+	}
+	http.HandleFunc("GET /admin/engines", adminEngines(func(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+		api.HandleListEngines(repo, hub, w, r)
+	}))
+	http.HandleFunc("POST /admin/engines", adminEngines(api.HandleCreateEngine))
+	http.HandleFunc("DELETE /admin/engines/{name}", adminEngines(api.HandleDeleteEngine))
+
+	metrics.WatchHub(hub.QueueLength, hub.ActiveGames)
+	http.Handle("/metrics", metrics.Handler())
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	// Readiness fails when any configured dependency is down
+	checker := health.NewChecker(cfg.Server.HealthCheckTimeout)
+	checker.Add("postgres", func(ctx context.Context) error {
+		if repository == nil {
+			return errors.New("not connected")
+		}
+		return repository.Ping(ctx)
+	})
+	if cfg.Kafka.Enabled() {
+		checker.Add("kafka", func(ctx context.Context) error {
+			if producer == nil {
+				return errors.New("not connected")
+			}
+			return producer.Ping(ctx)
+		})
+	}
+	if cfg.Events.NATS.URL != "" {
+		checker.Add("nats", func(ctx context.Context) error {
+			if natsSink == nil {
+				return errors.New("not connected")
+			}
+			return natsSink.Ping(ctx)
+		})
+	}
+	if node != nil {
+		checker.Add("cluster", node.Ping)
+	}
+	checker.Add("matchmaker", hub.CheckMatchmaker)
+
+	// /health is kept for existing monitors
+	http.HandleFunc("/health", enableCORS(api.HandleLiveness))
+	http.HandleFunc("/healthz", api.HandleLiveness)
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleReadiness(checker, w, r)
+	})
+
+	// 6. Start
+	srv := &http.Server{Addr: ":" + cfg.Server.Port}
+	go func() {
+		log.Printf("Server running on http://0.0.0.0:%s", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+
+	// 7. Graceful Shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	grace := cfg.Server.ShutdownGracePeriod
+	log.Printf("Shutdown signal received. Draining games for up to %s...", grace)
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), grace)
+	defer cancelDrain()
+	hub.Shutdown(drainCtx)
+	// Every result is in once the hub is down
+	tournaments.Shutdown()
+
+	// Sockets are hijacked, so this only closes the listener and idle HTTP requests
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("WARNING: HTTP shutdown: %v", err)
 	}
-	return fallback
-}
\ No newline at end of file
+
+	if node != nil {
+		node.Close()
+	}
+	sink.Close()
+	if consumer != nil {
+		if err := consumer.Close(); err != nil {
+			log.Printf("WARNING: Analytics consumer shutdown: %v", err)
+		}
+	}
+	if repository != nil {
+		repository.Close()
+	}
+	log.Println("Server stopped.")
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"connectfour/internal/db"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HandleAnalyticsSummary serves the all-time aggregates
+func HandleAnalyticsSummary(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	summary, err := repo.GetAnalyticsSummary()
+	if err != nil {
+		http.Error(w, "Failed to fetch analytics", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// HandleAnalyticsTimeseries serves games per hour or day.
+// Query: interval=hour|day (default hour), from/to as RFC3339 (default the last 24 hours, or 30 days by day).
+func HandleAnalyticsTimeseries(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "hour"
+	}
+	if interval != "hour" && interval != "day" {
+		http.Error(w, "interval must be hour or day", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if interval == "day" {
+		from = to.AddDate(0, 0, -30)
+	}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "from must be an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "to must be an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := repo.GetAnalyticsTimeseries(interval, from, to)
+	if err != nil {
+		http.Error(w, "Failed to fetch analytics", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval": interval,
+		"from":     from.UTC(),
+		"to":       to.UTC(),
+		"series":   series,
+	})
+}
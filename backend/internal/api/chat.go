@@ -0,0 +1,17 @@
+package api
+
+import (
+	"connectfour/internal/db"
+	"net/http"
+)
+
+// HandleGameChat serves GET /admin/games/{id}/chat, the full chat log of a
+// game with what was typed next to what was delivered
+func HandleGameChat(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	messages, err := repo.ListChatMessages(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Failed to fetch chat log", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
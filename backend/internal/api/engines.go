@@ -0,0 +1,168 @@
+package api
+
+import (
+	"connectfour/internal/db"
+	"connectfour/internal/game"
+	"connectfour/internal/metrics"
+	"connectfour/pkg/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+var engineName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,31}$`)
+
+// hashToken is how engine tokens are stored, so a database dump can't be
+// used to connect as an engine
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeEngine handles the websocket of an external engine. The engine
+// authenticates with "Authorization: Bearer <token>" and then speaks the
+// player protocol: it is sent START, UPDATE and GAME_OVER and answers with
+// MOVE (or RESIGN, DRAW_* and TAKEBACK_*). It never sends JOIN; the hub
+// offers it to waiting players whenever it is free.
+func ServeEngine(hub *game.Hub, repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name, err := repo.FindEngine(hashToken(token))
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Engine lookup failed", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Upgrade Error:", err)
+		return
+	}
+	serveEngine(hub, conn, name)
+}
+
+// serveEngine runs the connection of an authenticated engine
+func serveEngine(hub *game.Hub, conn *websocket.Conn, name string) {
+	metrics.Connections.Inc()
+	defer func() {
+		hub.HandleDisconnect(conn)
+		conn.Close()
+		metrics.Connections.Dec()
+	}()
+
+	if err := hub.AddEngine(conn, name); err != nil {
+		game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+		return
+	}
+
+	for {
+		var msg struct {
+			Type    models.MessageType `json:"type"`
+			Payload json.RawMessage    `json:"payload"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			log.Printf("Engine %s disconnected: %v", name, err)
+			return
+		}
+
+		switch msg.Type {
+		case models.MsgMove:
+			var move models.MovePayload
+			if err := json.Unmarshal(msg.Payload, &move); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: "invalid MOVE payload"}})
+				continue
+			}
+			hub.HandleMove(conn, move.Column)
+
+		case models.MsgResign, models.MsgDrawOffer, models.MsgDrawAccept, models.MsgDrawDecline,
+			models.MsgTakebackRequest, models.MsgTakebackAccept, models.MsgTakebackDecline:
+			if err := hub.HandleAction(conn, msg.Type); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		default:
+			game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: string(msg.Type) + " is not available to engines"}})
+		}
+	}
+}
+
+// HandleListEngines serves GET /admin/engines, with each engine's rating and
+// open connections on this instance
+func HandleListEngines(repo *db.Repository, hub *game.Hub, w http.ResponseWriter, r *http.Request) {
+	engines, err := repo.ListEngines(game.EnginePrefix)
+	if err != nil {
+		http.Error(w, "Failed to fetch engines", http.StatusInternalServerError)
+		return
+	}
+	connected := hub.EnginesConnected()
+	for i := range engines {
+		engines[i].Connected = connected[engines[i].Name]
+	}
+	writeJSON(w, http.StatusOK, engines)
+}
+
+// HandleCreateEngine serves POST /admin/engines. Body: {"name": "..."}.
+// The response is the only place the engine's token is shown.
+func HandleCreateEngine(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !engineName.MatchString(body.Name) {
+		http.Error(w, "name must be 2-32 lowercase letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+	token := "eng_" + hex.EncodeToString(secret)
+
+	engine, err := repo.CreateEngine(body.Name, hashToken(token))
+	if errors.Is(err, db.ErrExists) {
+		http.Error(w, "Engine already registered", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Engine storage failed", http.StatusInternalServerError)
+		return
+	}
+	engine.Token = token
+	writeJSON(w, http.StatusCreated, engine)
+}
+
+// HandleDeleteEngine serves DELETE /admin/engines/{name}. Connected engines
+// finish their current connection; new ones are turned away.
+func HandleDeleteEngine(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	err := repo.DeleteEngine(r.PathValue("name"))
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Engine not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Engine storage failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
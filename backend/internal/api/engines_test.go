@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeEngineRequiresBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "no header"},
+		{name: "other scheme", header: "Basic ZW5naW5lOnNlY3JldA=="},
+		{name: "empty token", header: "Bearer "},
+		{name: "lowercase scheme", header: "bearer eng_0123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/engine", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			// Turned away before the hub or the store are needed
+			ServeEngine(nil, nil, w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	const want = "20c2e7774b069a4c761384c722433ede6c0ad6baf639b17773c2d5e93b356554"
+	if got := hashToken("eng_test"); got != want {
+		t.Errorf("hashToken = %s, want %s", got, want)
+	}
+	if hashToken("eng_test") == hashToken("eng_tesT") {
+		t.Error("different tokens hash the same")
+	}
+}
+
+func TestEngineName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"deep-thought":                      true,
+		"a1":                                true,
+		"x":                                 false, // Too short
+		"Deep":                              false,
+		"-dash":                             false,
+		"has space":                         false,
+		"engine:deep":                       false,
+		"abcdefghijklmnopqrstuvwxyz012345":  true,
+		"abcdefghijklmnopqrstuvwxyz0123456": false,
+	} {
+		if got := engineName.MatchString(name); got != valid {
+			t.Errorf("%q valid = %t, want %t", name, got, valid)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"connectfour/internal/db"
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 func HandleLeaderboard(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
@@ -28,3 +29,26 @@ func HandleLeaderboard(repo *db.Repository, w http.ResponseWriter, r *http.Reque
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(entries)
 }
+
+// HandleRatings serves the highest rated players.
+// Query: limit (default 10, at most 100).
+func HandleRatings(repo *db.Repository, w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ratings, err := repo.GetRatings(limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch ratings", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
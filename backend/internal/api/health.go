@@ -0,0 +1,25 @@
+package api
+
+import (
+	"connectfour/internal/health"
+	"encoding/json"
+	"net/http"
+)
+
+// HandleLiveness reports that the process is up and serving HTTP
+func HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+// HandleReadiness runs every dependency check and answers 503 if any failed,
+// so the orchestrator stops routing players to this instance.
+func HandleReadiness(checker *health.Checker, w http.ResponseWriter, r *http.Request) {
+	report := checker.Run(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectfour/internal/health"
+)
+
+func TestHandleReadiness(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		status string
+	}{
+		{"ready", nil, http.StatusOK, "ready"},
+		{"degraded", errors.New("broker unreachable"), http.StatusServiceUnavailable, "not_ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(time.Second)
+			checker.Add("postgres", func(context.Context) error { return nil })
+			checker.Add("kafka", func(context.Context) error { return tt.err })
+
+			w := httptest.NewRecorder()
+			HandleReadiness(checker, w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.code {
+				t.Errorf("status %d, want %d", w.Code, tt.code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type %q, want application/json", ct)
+			}
+			var report health.Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status || len(report.Checks) != 2 {
+				t.Errorf("report = %+v, want %s with both checks", report, tt.status)
+			}
+		})
+	}
+}
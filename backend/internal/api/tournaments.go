@@ -0,0 +1,97 @@
+package api
+
+import (
+	"connectfour/internal/tournament"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HandleListTournaments serves GET /tournaments
+func HandleListTournaments(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.List())
+}
+
+// HandleCreateTournament serves POST /tournaments (organizers only).
+// Body: {"name": "...", "format": "round_robin|swiss|single_elimination|double_elimination", "rounds": 0}.
+// rounds only applies to Swiss, and defaults to log2 of the player count.
+func HandleCreateTournament(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name   string `json:"name"`
+		Format string `json:"format"`
+		Rounds int    `json:"rounds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	format, err := tournament.ParseFormat(body.Format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := m.Create(body.Name, format, body.Rounds)
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, v)
+}
+
+// HandleGetTournament serves GET /tournaments/{id} with matches and standings
+func HandleGetTournament(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	v, err := m.Get(r.PathValue("id"))
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// HandleTournamentStandings serves GET /tournaments/{id}/standings
+func HandleTournamentStandings(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	v, err := m.Get(r.PathValue("id"))
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v.Standings)
+}
+
+// HandleRegisterTournament serves POST /tournaments/{id}/players. Body: {"username": "..."}
+func HandleRegisterTournament(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	v, err := m.Register(r.PathValue("id"), body.Username)
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// HandleStartTournament serves POST /tournaments/{id}/start (organizers only)
+func HandleStartTournament(m *tournament.Manager, w http.ResponseWriter, r *http.Request) {
+	v, err := m.Start(r.PathValue("id"))
+	if err != nil {
+		tournamentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func tournamentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tournament.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, tournament.ErrNotRegistering), errors.Is(err, tournament.ErrAlreadyJoined):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
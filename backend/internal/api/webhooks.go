@@ -0,0 +1,117 @@
+package api
+
+import (
+	"connectfour/internal/db"
+	"connectfour/internal/webhook"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// HandleListWebhooks serves GET /admin/webhooks
+func HandleListWebhooks(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	hooks, err := d.List()
+	if err != nil {
+		http.Error(w, "Failed to fetch webhooks", 500)
+		return
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+// HandleCreateWebhook serves POST /admin/webhooks. Body: {"url": "...", "events": ["GAME_OVER"]}.
+// The response is the only place the signing secret is shown.
+func HandleCreateWebhook(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	var s webhook.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	hook, err := d.Create(s)
+	if err != nil {
+		webhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// HandleGetWebhook serves GET /admin/webhooks/{id}
+func HandleGetWebhook(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	hook, err := d.Get(r.PathValue("id"))
+	if err != nil {
+		webhookError(w, err)
+		return
+	}
+	hook.Secret = ""
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// HandleUpdateWebhook serves PATCH /admin/webhooks/{id}. Body fields url, events and active are optional.
+func HandleUpdateWebhook(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	var s webhook.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	hook, err := d.Update(r.PathValue("id"), s)
+	if err != nil {
+		webhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// HandleDeleteWebhook serves DELETE /admin/webhooks/{id}
+func HandleDeleteWebhook(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	if err := d.Delete(r.PathValue("id")); err != nil {
+		webhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleWebhookDeliveries serves GET /admin/webhooks/{id}/deliveries?limit=N (default 50, max 500)
+func HandleWebhookDeliveries(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	deliveries, err := d.Deliveries(r.PathValue("id"), limit)
+	if err != nil {
+		webhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// HandleTestWebhook serves POST /admin/webhooks/{id}/test, queueing a PING delivery
+func HandleTestWebhook(d *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	hook, err := d.Get(r.PathValue("id"))
+	if err != nil {
+		webhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"deliveryId": d.Test(hook)})
+}
+
+func webhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Webhook storage failed", 500)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
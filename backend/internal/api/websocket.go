@@ -2,6 +2,8 @@ package api
 
 import (
 	"connectfour/internal/game"
+	"connectfour/internal/metrics"
+	"connectfour/internal/tournament"
 	"connectfour/pkg/models"
 	"log"
 	"net/http"
@@ -17,17 +19,21 @@ var upgrader = websocket.Upgrader{
 }
 
 // ServeWs handles websocket requests from the peer.
-func ServeWs(hub *game.Hub, w http.ResponseWriter, r *http.Request) {
+func ServeWs(hub *game.Hub, tournaments *tournament.Manager, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Upgrade Error:", err)
 		return
 	}
 
+	metrics.Connections.Inc()
+
 	// Ensure connection closes when function returns
 	defer func() {
+		tournaments.HandleDisconnect(conn)
 		hub.HandleDisconnect(conn)
 		conn.Close()
+		metrics.Connections.Dec()
 	}()
 
 	log.Println("New Client Connected")
@@ -48,7 +54,9 @@ func ServeWs(hub *game.Hub, w http.ResponseWriter, r *http.Request) {
 			data, ok := msg.Payload.(map[string]interface{})
 			if ok {
 				username := data["username"].(string)
-				hub.AddPlayer(conn, username)
+				casual, _ := data["casual"].(bool)
+				noBot, _ := data["noBot"].(bool)
+				hub.AddPlayer(conn, username, game.QueueOptions{Casual: casual, NoBot: noBot})
 			}
 		
 		case models.MsgMove:
@@ -59,6 +67,119 @@ func ServeWs(hub *game.Hub, w http.ResponseWriter, r *http.Request) {
 				colFloat := data["column"].(float64)
 				hub.HandleMove(conn, int(colFloat))
 			}
+
+		case models.MsgLeaveQueue:
+			if err := hub.LeaveQueue(conn); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgLobbyEnter:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			username, _ := data["username"].(string)
+			if err := hub.EnterLobby(conn, username); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgChallenge, models.MsgChallengeAccept, models.MsgChallengeDecline:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			username, _ := data["username"].(string)
+			var err error
+			switch msg.Type {
+			case models.MsgChallenge:
+				casual, _ := data["casual"].(bool)
+				err = hub.Challenge(conn, username, casual)
+			case models.MsgChallengeAccept:
+				err = hub.AcceptChallenge(conn, username)
+			default:
+				err = hub.DeclineChallenge(conn, username)
+			}
+			if err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgResign, models.MsgDrawOffer, models.MsgDrawAccept, models.MsgDrawDecline,
+			models.MsgTakebackRequest, models.MsgTakebackAccept, models.MsgTakebackDecline:
+			if err := hub.HandleAction(conn, msg.Type); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgRematchOffer, models.MsgRematchAccept, models.MsgRematchDecline:
+			var err error
+			switch msg.Type {
+			case models.MsgRematchOffer:
+				err = hub.OfferRematch(conn)
+			case models.MsgRematchAccept:
+				err = hub.AcceptRematch(conn)
+			default:
+				err = hub.DeclineRematch(conn)
+			}
+			if err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgChat, models.MsgEmote:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			text, _ := data["text"].(string)
+			if msg.Type == models.MsgEmote {
+				text, _ = data["emote"].(string)
+			}
+			if err := hub.HandleChat(conn, msg.Type, text); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgMute, models.MsgUnmute, models.MsgBlock, models.MsgUnblock:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			target, _ := data["username"].(string)
+			var err error
+			switch msg.Type {
+			case models.MsgMute, models.MsgUnmute:
+				err = hub.HandleMute(conn, target, msg.Type == models.MsgMute)
+			default:
+				err = hub.HandleBlock(conn, target, msg.Type == models.MsgBlock)
+			}
+			if err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgSpectate:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			gameID, _ := data["gameId"].(string)
+			username, _ := data["username"].(string)
+			if err := hub.Spectate(conn, gameID, username); err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
+
+		case models.MsgTournamentJoin, models.MsgTournamentWatch:
+			data, ok := msg.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			id, _ := data["tournamentId"].(string)
+			var err error
+			if msg.Type == models.MsgTournamentJoin {
+				username, _ := data["username"].(string)
+				err = tournaments.Join(conn, id, username)
+			} else {
+				err = tournaments.Watch(conn, id)
+			}
+			if err != nil {
+				game.WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: err.Error()}})
+			}
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Filter masks blocked words in chat lines. Words match whole and in any
+// case, so "Shit!" is caught but "Shitake" is left alone.
+type Filter struct {
+	pattern *regexp.Regexp // nil when there is nothing to filter
+}
+
+func NewFilter(words []string) *Filter {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &Filter{}
+	}
+	return &Filter{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// Clean returns text with every blocked word replaced by asterisks
+func (f *Filter) Clean(text string) string {
+	if f.pattern == nil {
+		return text
+	}
+	return f.pattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	})
+}
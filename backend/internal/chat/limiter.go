@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows each key a number of events per sliding interval. Keys
+// with nothing left in their window are dropped once per interval, so
+// players who stopped chatting don't stay in memory.
+type Limiter struct {
+	limit    int
+	interval time.Duration
+
+	mutex  sync.Mutex
+	recent map[string][]time.Time
+	swept  time.Time
+}
+
+func NewLimiter(limit int, interval time.Duration) *Limiter {
+	return &Limiter{limit: limit, interval: interval, recent: make(map[string][]time.Time)}
+}
+
+// Allow records an event for key unless it is over its limit
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.swept) >= l.interval {
+		l.sweep(now)
+	}
+
+	// Drop events that have left the window
+	kept := l.recent[key][:0]
+	for _, t := range l.recent[key] {
+		if now.Sub(t) < l.interval {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= l.limit {
+		l.recent[key] = kept
+		return false
+	}
+	l.recent[key] = append(kept, now)
+	return true
+}
+
+// sweep must be called with l.mutex held
+func (l *Limiter) sweep(now time.Time) {
+	for key, times := range l.recent {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= l.interval {
+			delete(l.recent, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Now()
+	l := NewLimiter(2, time.Second)
+
+	steps := []struct {
+		key   string
+		after time.Duration
+		want  bool
+	}{
+		{"alice", 0, true},
+		{"alice", 100 * time.Millisecond, true},
+		{"alice", 200 * time.Millisecond, false}, // Third in the window
+		{"bob", 200 * time.Millisecond, true},
+		{"alice", 1050 * time.Millisecond, true}, // The first one left the window
+		{"alice", 1150 * time.Millisecond, true},
+		{"alice", 1200 * time.Millisecond, false},
+	}
+	for i, s := range steps {
+		if got := l.Allow(s.key, start.Add(s.after)); got != s.want {
+			t.Errorf("step %d: Allow(%s) = %v, want %v", i, s.key, got, s.want)
+		}
+	}
+}
+
+func TestLimiterDropsIdleKeys(t *testing.T) {
+	start := time.Now()
+	l := NewLimiter(5, time.Second)
+	l.Allow("alice", start)
+
+	// alice has been quiet for a whole interval when bob next chats
+	l.Allow("bob", start.Add(1500*time.Millisecond))
+	if _, ok := l.recent["alice"]; ok {
+		t.Error("idle key was kept")
+	}
+	if _, ok := l.recent["bob"]; !ok {
+		t.Error("active key was dropped")
+	}
+}
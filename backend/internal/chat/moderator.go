@@ -0,0 +1,131 @@
+// Package chat checks what players say to each other: length and rate
+// limits, a word filter, and per player mutes and blocks. Routing messages
+// is up to the game hub.
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"connectfour/internal/config"
+	"connectfour/internal/db"
+)
+
+// Emotes are the quick reactions players can send
+var Emotes = []string{"hello", "gg", "good_move", "oops", "thinking", "wow", "thanks"}
+
+var (
+	ErrEmpty       = errors.New("message is empty")
+	ErrRateLimited = errors.New("you are sending messages too fast")
+	ErrBadEmote    = fmt.Errorf("emote must be one of %s", strings.Join(Emotes, ", "))
+)
+
+// Moderator is shared by every game on an instance
+type Moderator struct {
+	cfg     config.Chat
+	filter  *Filter
+	limiter *Limiter
+	repo    *db.Repository
+
+	mutex sync.Mutex
+	// Muted players by muter. Mutes last until undone or the server
+	// restarts; blocks are stored and last until undone.
+	mutes map[string]map[string]bool
+}
+
+func NewModerator(cfg config.Chat, repo *db.Repository) *Moderator {
+	return &Moderator{
+		cfg:     cfg,
+		filter:  NewFilter(cfg.BlockedWords),
+		limiter: NewLimiter(cfg.RateLimit, cfg.RateInterval),
+		repo:    repo,
+		mutes:   make(map[string]map[string]bool),
+	}
+}
+
+// Check vets a chat line from a player and returns it as it should be
+// delivered
+func (m *Moderator) Check(from, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrEmpty
+	}
+	if n := utf8.RuneCountInString(text); n > m.cfg.MaxLength {
+		return "", fmt.Errorf("message is %d characters, the limit is %d", n, m.cfg.MaxLength)
+	}
+	if !m.limiter.Allow(from, time.Now()) {
+		return "", ErrRateLimited
+	}
+	return m.filter.Clean(text), nil
+}
+
+// CheckEmote vets an emote from a player
+func (m *Moderator) CheckEmote(from, emote string) error {
+	if !slices.Contains(Emotes, emote) {
+		return ErrBadEmote
+	}
+	if !m.limiter.Allow(from, time.Now()) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Mute hides (or shows again) target's messages from username
+func (m *Moderator) Mute(username, target string, on bool) error {
+	if target == "" || target == username {
+		return errors.New("pick another player to mute")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if on {
+		if m.mutes[username] == nil {
+			m.mutes[username] = make(map[string]bool)
+		}
+		m.mutes[username][target] = true
+	} else {
+		delete(m.mutes[username], target)
+	}
+	return nil
+}
+
+// Block is a mute that is stored, so it holds in every later game
+func (m *Moderator) Block(username, target string, on bool) error {
+	if target == "" || target == username {
+		return errors.New("pick another player to block")
+	}
+	if m.repo == nil {
+		return errors.New("blocking needs the database, mute instead")
+	}
+	return m.repo.SetBlocked(username, target, on)
+}
+
+// Hidden reports whether messages from sender should not reach recipient
+func (m *Moderator) Hidden(recipient, sender string) bool {
+	m.mutex.Lock()
+	muted := m.mutes[recipient][sender]
+	m.mutex.Unlock()
+	if muted || m.repo == nil {
+		return muted
+	}
+
+	blocked, err := m.repo.IsBlocked(recipient, sender)
+	if err != nil {
+		log.Printf("ERROR: Could not check chat blocks of %s: %v", recipient, err)
+	}
+	return blocked
+}
+
+// Log keeps a delivered message for moderation
+func (m *Moderator) Log(gameID, sender, kind, text, original string) {
+	if m.repo == nil {
+		return
+	}
+	m.repo.SaveChatMessage(db.ChatMessage{GameID: gameID, Sender: sender, Kind: kind, Text: text, Original: original, SentAt: time.Now().UTC()})
+}
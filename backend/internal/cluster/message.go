@@ -0,0 +1,41 @@
+package cluster
+
+import "encoding/json"
+
+// Kind identifies what an instance is asking of another
+type Kind string
+
+const (
+	// MATCH tells the host instance to start a game between its queued
+	// player (Username) and Opponent, who is connected to Instance. Casual
+	// says whether they queued for a casual game.
+	KindMatch Kind = "MATCH"
+	// MOVE relays a move from a remote player to the host
+	KindMove Kind = "MOVE"
+	// DELIVER carries a websocket message from the host to a remote player
+	KindDeliver Kind = "DELIVER"
+	// DISCONNECT tells the host a remote player's socket closed
+	KindDisconnect Kind = "DISCONNECT"
+	// REJOIN tells the host a player is back, connected to the sender
+	KindRejoin Kind = "REJOIN"
+	// CHAT relays a CHAT or EMOTE message (Payload) from a remote player to
+	// the host
+	KindChat Kind = "CHAT"
+	// ACTION relays a RESIGN, DRAW or TAKEBACK message (Payload) from a
+	// remote player to the host
+	KindAction Kind = "ACTION"
+)
+
+// Message is the envelope instances exchange over NOTIFY
+type Message struct {
+	Kind     Kind            `json:"kind"`
+	From     string          `json:"from"`
+	GameID   string          `json:"gameId,omitempty"`
+	Username string          `json:"username,omitempty"`
+	Opponent string          `json:"opponent,omitempty"`
+	Instance string          `json:"instance,omitempty"`
+	Symbol   int             `json:"symbol,omitempty"`
+	Column   int             `json:"column"`
+	Casual   bool            `json:"casual,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
@@ -0,0 +1,230 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Queue entries not refreshed by their instance for this long are dropped,
+// and the instance itself is taken for gone
+const staleAfter = 10 * time.Second
+
+// Node connects one server instance to the others through Postgres. The
+// shared matchmaking queue is a table, and instances talk to each other with
+// LISTEN/NOTIFY on a channel per instance.
+type Node struct {
+	ID string
+
+	// Single connection so NOTIFYs from this node arrive in the order sent
+	db       *sql.DB
+	listener *pq.Listener
+}
+
+// QueueEntry is a player waiting in the shared queue
+type QueueEntry struct {
+	Username string
+	Instance string
+	JoinedAt time.Time
+	Casual   bool // Only matched with other casual players
+}
+
+func NewNode(dsn, id string) (*Node, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS matchmaking_queue (
+		username TEXT PRIMARY KEY,
+		instance_id TEXT NOT NULL,
+		joined_at TIMESTAMP NOT NULL,
+		seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE matchmaking_queue ADD COLUMN IF NOT EXISTS casual BOOLEAN NOT NULL DEFAULT FALSE;
+
+	CREATE TABLE IF NOT EXISTS cluster_instances (
+		instance_id TEXT PRIMARY KEY,
+		seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return nil, fmt.Errorf("failed to migrate matchmaking queue: %v", err)
+	}
+
+	// Anything left over from a previous run of this instance is stale
+	db.Exec(`DELETE FROM matchmaking_queue WHERE instance_id = $1`, id)
+
+	listener := pq.NewListener(dsn, 1*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("CLUSTER: Listener event %d: %v", ev, err)
+		}
+	})
+	if err := listener.Listen(channel(id)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	n := &Node{ID: id, db: db, listener: listener}
+	if err := n.Heartbeat(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func channel(instance string) string {
+	return "connect4_" + instance
+}
+
+// Listen delivers messages addressed to this node to handle, one at a time
+func (n *Node) Listen(handle func(Message)) {
+	go func() {
+		for {
+			select {
+			case notification, ok := <-n.listener.Notify:
+				if !ok {
+					return
+				}
+				// nil means the connection was re-established
+				if notification == nil {
+					continue
+				}
+				var m Message
+				if err := json.Unmarshal([]byte(notification.Extra), &m); err != nil {
+					log.Printf("CLUSTER: Bad message: %v", err)
+					continue
+				}
+				handle(m)
+			case <-time.After(90 * time.Second):
+				go n.listener.Ping()
+			}
+		}
+	}()
+}
+
+// Send delivers m to the given instance
+func (n *Node) Send(instance string, m Message) error {
+	m.From = n.ID
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = n.db.Exec(`SELECT pg_notify($1, $2)`, channel(instance), string(payload))
+	if err != nil {
+		log.Printf("CLUSTER ERROR: Failed to send %s to %s: %v", m.Kind, instance, err)
+	}
+	return err
+}
+
+// Enqueue adds a player to the shared queue
+func (n *Node) Enqueue(e QueueEntry) error {
+	query := `
+		INSERT INTO matchmaking_queue (username, instance_id, joined_at, casual, seen_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (username) DO UPDATE SET instance_id = EXCLUDED.instance_id, joined_at = EXCLUDED.joined_at,
+			casual = EXCLUDED.casual, seen_at = CURRENT_TIMESTAMP`
+	_, err := n.db.Exec(query, e.Username, e.Instance, e.JoinedAt, e.Casual)
+	return err
+}
+
+// Dequeue removes a player from the shared queue. It returns false if the
+// player was no longer queued, i.e. another instance already matched them.
+func (n *Node) Dequeue(username string) (bool, error) {
+	res, err := n.db.Exec(`DELETE FROM matchmaking_queue WHERE username = $1 AND instance_id = $2`, username, n.ID)
+	if err != nil {
+		return false, err
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+// Heartbeat marks this instance and its queue entries as still alive
+func (n *Node) Heartbeat() error {
+	_, err := n.db.Exec(`
+		INSERT INTO cluster_instances (instance_id, seen_at) VALUES ($1, CURRENT_TIMESTAMP)
+		ON CONFLICT (instance_id) DO UPDATE SET seen_at = CURRENT_TIMESTAMP`, n.ID)
+	if err != nil {
+		return err
+	}
+	_, err = n.db.Exec(`UPDATE matchmaking_queue SET seen_at = CURRENT_TIMESTAMP WHERE instance_id = $1`, n.ID)
+	return err
+}
+
+// Alive reports whether an instance has sent a heartbeat lately
+func (n *Node) Alive(instance string) (bool, error) {
+	stale := fmt.Sprintf("%d seconds", int(staleAfter.Seconds()))
+	var alive bool
+	err := n.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM cluster_instances
+		WHERE instance_id = $1 AND seen_at >= CURRENT_TIMESTAMP - $2::interval)`, instance, stale).Scan(&alive)
+	return alive, err
+}
+
+// ClaimPair takes the two longest waiting casual or rated players off the
+// shared queue. Concurrent claims from other instances skip the rows locked
+// here.
+func (n *Node) ClaimPair(casual bool) ([2]QueueEntry, bool, error) {
+	var pair [2]QueueEntry
+
+	tx, err := n.db.Begin()
+	if err != nil {
+		return pair, false, err
+	}
+	defer tx.Rollback()
+
+	stale := fmt.Sprintf("%d seconds", int(staleAfter.Seconds()))
+	if _, err := tx.Exec(`DELETE FROM matchmaking_queue WHERE seen_at < CURRENT_TIMESTAMP - $1::interval`, stale); err != nil {
+		return pair, false, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT username, instance_id, joined_at, casual FROM matchmaking_queue
+		WHERE casual = $1
+		ORDER BY joined_at
+		LIMIT 2
+		FOR UPDATE SKIP LOCKED`, casual)
+	if err != nil {
+		return pair, false, err
+	}
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(&pair[count].Username, &pair[count].Instance, &pair[count].JoinedAt, &pair[count].Casual); err != nil {
+			rows.Close()
+			return pair, false, err
+		}
+		count++
+	}
+	rows.Close()
+	if count < 2 {
+		return pair, false, nil
+	}
+
+	_, err = tx.Exec(`DELETE FROM matchmaking_queue WHERE username IN ($1, $2)`, pair[0].Username, pair[1].Username)
+	if err != nil {
+		return pair, false, err
+	}
+	return pair, true, tx.Commit()
+}
+
+// Ping checks the connection used for the shared queue and messaging
+func (n *Node) Ping(ctx context.Context) error {
+	return n.db.PingContext(ctx)
+}
+
+func (n *Node) Close() {
+	n.listener.Close()
+	n.db.Exec(`DELETE FROM matchmaking_queue WHERE instance_id = $1`, n.ID)
+	n.db.Exec(`DELETE FROM cluster_instances WHERE instance_id = $1`, n.ID)
+	n.db.Close()
+}
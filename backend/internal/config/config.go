@@ -0,0 +1,379 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every setting the server reads at startup. Values come from the
+// defaults below, then a YAML file, then environment variables, then command
+// line flags, each overriding the one before.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Database   Database   `yaml:"database"`
+	Kafka      Kafka      `yaml:"kafka"`
+	Events     Events     `yaml:"events"`
+	Webhooks   Webhooks   `yaml:"webhooks"`
+	Admin      Admin      `yaml:"admin"`
+	Tournament Tournament `yaml:"tournament"`
+	Cluster    Cluster    `yaml:"cluster"`
+	Game       Game       `yaml:"game"`
+}
+
+type Server struct {
+	Port string `yaml:"port"`
+	// How long running games may take to finish after SIGTERM
+	ShutdownGracePeriod time.Duration `yaml:"shutdownGracePeriod"`
+	// Per-dependency timeout for /readyz
+	HealthCheckTimeout time.Duration `yaml:"healthCheckTimeout"`
+}
+
+type Database struct {
+	// URL wins over the individual fields when set
+	URL      string `yaml:"url"`
+	Host     string `yaml:"host"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	// 0 means no limit
+	MaxOpenConns int `yaml:"maxOpenConns"`
+}
+
+type Kafka struct {
+	// Empty disables analytics
+	Brokers       []string `yaml:"brokers"`
+	Topic         string   `yaml:"topic"`
+	ConsumerGroup string   `yaml:"consumerGroup"`
+	TLS           TLS      `yaml:"tls"`
+	SASL          SASL     `yaml:"sasl"`
+	// Events the broker hasn't accepted are kept here across restarts
+	OutboxPath string `yaml:"outboxPath"`
+}
+
+// TLS secures the broker connection. The broker certificate is verified
+// against the system roots plus CAFile.
+type TLS struct {
+	Enabled bool   `yaml:"enabled"`
+	CAFile  string `yaml:"caFile"`
+	// Client certificate for mTLS
+	CertFile   string `yaml:"certFile"`
+	KeyFile    string `yaml:"keyFile"`
+	ServerName string `yaml:"serverName"`
+	// Only for brokers with self-signed certificates during development
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+// SASL mechanisms supported for Kafka
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+	SASLOAuthBearer = "OAUTHBEARER"
+)
+
+// SASL authenticates to the broker. An empty Mechanism with a User set
+// means SCRAM-SHA-256.
+type SASL struct {
+	Mechanism string `yaml:"mechanism"`
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+	OAuth     OAuth  `yaml:"oauth"`
+}
+
+// OAuth supplies OAUTHBEARER tokens: either a fixed Token, or tokens fetched
+// from TokenURL with the client credentials grant.
+type OAuth struct {
+	Token        string   `yaml:"token"`
+	TokenURL     string   `yaml:"tokenUrl"`
+	ClientID     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// Events lists the sinks game events go to besides Kafka. Each one is
+// enabled by setting its URL or path.
+type Events struct {
+	NATS    NATS    `yaml:"nats"`
+	Webhook Webhook `yaml:"webhook"`
+	File    File    `yaml:"file"`
+}
+
+type NATS struct {
+	URL string `yaml:"url"`
+	// Events are published on <subject>.<EVENT_TYPE>
+	Subject string `yaml:"subject"`
+}
+
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+	// Extra attempts after a failed POST
+	Retries int `yaml:"retries"`
+}
+
+type File struct {
+	// Append-only JSONL file
+	Path string `yaml:"path"`
+}
+
+// Webhooks tunes delivery to the subscriptions managed through the admin API
+type Webhooks struct {
+	Workers     int           `yaml:"workers"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxAttempts int           `yaml:"maxAttempts"`
+	// Doubled after every failed attempt
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// How often subscriptions changed on other instances are picked up
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+type Tournament struct {
+	// How long a player has to show up for a tournament match before forfeiting
+	NoShowAfter time.Duration `yaml:"noShowAfter"`
+}
+
+type Admin struct {
+	// Bearer token for /admin endpoints. Empty disables them.
+	Token string `yaml:"token"`
+}
+
+type Cluster struct {
+	Enabled    bool   `yaml:"enabled"`
+	InstanceID string `yaml:"instanceId"`
+}
+
+type Game struct {
+	// How long a player waits for a human opponent before getting the bot
+	BotFallbackAfter time.Duration `yaml:"botFallbackAfter"`
+	// How long a disconnected player has to come back before forfeiting
+	ForfeitAfter time.Duration `yaml:"forfeitAfter"`
+	// How long games restored after a restart wait for their players
+	ResumeWindow time.Duration `yaml:"resumeWindow"`
+	// Games per matchmade series; the first to win a majority takes it
+	BestOf int `yaml:"bestOf"`
+	// Pause between the games of a series, so players see the result
+	NextGameAfter time.Duration `yaml:"nextGameAfter"`
+	// How long after a series its players can agree to a rematch
+	RematchWindow time.Duration `yaml:"rematchWindow"`
+	// How long a lobby challenge waits for an answer
+	ChallengeTimeout time.Duration `yaml:"challengeTimeout"`
+	Bot              Bot           `yaml:"bot"`
+	Engine           Engine        `yaml:"engine"`
+	Chat             Chat          `yaml:"chat"`
+}
+
+type Bot struct {
+	// Username the bot plays under
+	Name string `yaml:"name"`
+	// Pause before each bot move so it doesn't feel instant
+	MoveDelay time.Duration `yaml:"moveDelay"`
+	// Chance (0-1) of passing over a preferred column, so games vary
+	Randomness float64 `yaml:"randomness"`
+}
+
+// Engine configures games against external engines
+type Engine struct {
+	// Time an engine has for each move before it loses on time
+	MoveTime time.Duration `yaml:"moveTime"`
+}
+
+type Chat struct {
+	// Longest chat line accepted, in characters
+	MaxLength int `yaml:"maxLength"`
+	// Chat lines and emotes a player may send per RateInterval
+	RateLimit    int           `yaml:"rateLimit"`
+	RateInterval time.Duration `yaml:"rateInterval"`
+	// Words masked out of chat lines, matched as whole words in any case
+	BlockedWords []string `yaml:"blockedWords"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	hostname, _ := os.Hostname()
+	return Config{
+		Server: Server{
+			Port:                "8080",
+			ShutdownGracePeriod: 30 * time.Second,
+			HealthCheckTimeout:  2 * time.Second,
+		},
+		Database: Database{
+			Host:     "localhost:5432",
+			User:     "user",
+			Password: "password",
+			Name:     "connect4",
+		},
+		Kafka: Kafka{
+			Topic:         "game-analytics",
+			ConsumerGroup: "connect4-analytics",
+			OutboxPath:    "data/event-outbox.jsonl",
+		},
+		Events: Events{
+			NATS:    NATS{Subject: "connect4.events"},
+			Webhook: Webhook{Timeout: 5 * time.Second, Retries: 3},
+		},
+		Webhooks: Webhooks{
+			Workers:         4,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     6,
+			InitialBackoff:  time.Second,
+			RefreshInterval: 30 * time.Second,
+		},
+		Tournament: Tournament{
+			NoShowAfter: 2 * time.Minute,
+		},
+		Cluster: Cluster{
+			InstanceID: hostname,
+		},
+		Game: Game{
+			BotFallbackAfter: 10 * time.Second,
+			ForfeitAfter:     30 * time.Second,
+			ResumeWindow:     2 * time.Minute,
+			BestOf:           1,
+			NextGameAfter:    5 * time.Second,
+			RematchWindow:    30 * time.Second,
+			ChallengeTimeout: 30 * time.Second,
+			Bot: Bot{
+				Name:       "Bot",
+				MoveDelay:  500 * time.Millisecond,
+				Randomness: 0.2,
+			},
+			Engine: Engine{
+				MoveTime: 5 * time.Second,
+			},
+			Chat: Chat{
+				MaxLength:    200,
+				RateLimit:    5,
+				RateInterval: 10 * time.Second,
+				BlockedWords: []string{"fuck", "shit", "cunt", "bitch", "asshole", "bastard"},
+			},
+		},
+	}
+}
+
+// DSN is the Postgres connection string
+func (d Database) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", d.User, d.Password, d.Host, d.Name)
+}
+
+// Enabled reports whether any brokers are configured
+func (k Kafka) Enabled() bool {
+	return len(k.Brokers) > 0
+}
+
+// Enabled reports whether SASL authentication is configured
+func (s SASL) Enabled() bool {
+	return s.Mechanism != "" || s.User != ""
+}
+
+// MechanismName is the configured mechanism, with the SCRAM-SHA-256 default
+// applied
+func (s SASL) MechanismName() string {
+	if s.Mechanism == "" {
+		return SASLScramSHA256
+	}
+	return strings.ToUpper(s.Mechanism)
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port: %q is not a valid port", c.Server.Port)
+	check(c.Server.ShutdownGracePeriod >= 0, "server.shutdownGracePeriod: must not be negative")
+	check(c.Server.HealthCheckTimeout > 0, "server.healthCheckTimeout: must be positive")
+
+	check(c.Database.URL != "" || c.Database.Name != "", "database: url or name is required")
+	check(c.Database.MaxOpenConns >= 0, "database.maxOpenConns: must not be negative")
+
+	if c.Kafka.Enabled() {
+		for _, broker := range c.Kafka.Brokers {
+			check(broker != "", "kafka.brokers: empty broker address")
+		}
+		check(c.Kafka.Topic != "", "kafka.topic: required")
+		check(c.Kafka.ConsumerGroup != "", "kafka.consumerGroup: required")
+		check(c.Kafka.OutboxPath != "", "kafka.outboxPath: required")
+		errs = append(errs, c.Kafka.validateSecurity()...)
+	}
+
+	if c.Events.NATS.URL != "" {
+		check(c.Events.NATS.Subject != "", "events.nats.subject: required")
+	}
+	if c.Events.Webhook.URL != "" {
+		u, err := url.Parse(c.Events.Webhook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "events.webhook.url: %q is not an http(s) URL", c.Events.Webhook.URL)
+		check(c.Events.Webhook.Timeout > 0, "events.webhook.timeout: must be positive")
+		check(c.Events.Webhook.Retries >= 0, "events.webhook.retries: must not be negative")
+	}
+
+	check(c.Webhooks.Workers > 0, "webhooks.workers: must be positive")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout: must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.maxAttempts: must be positive")
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initialBackoff: must be positive")
+	check(c.Webhooks.RefreshInterval > 0, "webhooks.refreshInterval: must be positive")
+
+	check(c.Tournament.NoShowAfter > 0, "tournament.noShowAfter: must be positive")
+
+	check(!c.Cluster.Enabled || c.Cluster.InstanceID != "", "cluster.instanceId: required when clustering is enabled")
+
+	check(c.Game.BotFallbackAfter > 0, "game.botFallbackAfter: must be positive")
+	check(c.Game.ForfeitAfter > 0, "game.forfeitAfter: must be positive")
+	check(c.Game.ResumeWindow > 0, "game.resumeWindow: must be positive")
+	check(c.Game.BestOf > 0, "game.bestOf: must be positive")
+	check(c.Game.NextGameAfter >= 0, "game.nextGameAfter: must not be negative")
+	check(c.Game.RematchWindow > 0, "game.rematchWindow: must be positive")
+	check(c.Game.ChallengeTimeout > 0, "game.challengeTimeout: must be positive")
+	check(c.Game.Bot.Name != "", "game.bot.name: required")
+	check(c.Game.Bot.MoveDelay >= 0, "game.bot.moveDelay: must not be negative")
+	check(c.Game.Bot.Randomness >= 0 && c.Game.Bot.Randomness <= 1, "game.bot.randomness: must be between 0 and 1")
+	check(c.Game.Engine.MoveTime > 0, "game.engine.moveTime: must be positive")
+	check(c.Game.Chat.MaxLength > 0, "game.chat.maxLength: must be positive")
+	check(c.Game.Chat.RateLimit > 0, "game.chat.rateLimit: must be positive")
+	check(c.Game.Chat.RateInterval > 0, "game.chat.rateInterval: must be positive")
+
+	return errors.Join(errs...)
+}
+
+func (k Kafka) validateSecurity() []error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	t := k.TLS
+	check(t.Enabled || (t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && t.ServerName == ""),
+		"kafka.tls: certificate settings need kafka.tls.enabled")
+	check((t.CertFile == "") == (t.KeyFile == ""), "kafka.tls: certFile and keyFile must be set together")
+
+	if !k.SASL.Enabled() {
+		return errs
+	}
+	s := k.SASL
+	switch s.MechanismName() {
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		check(s.User != "" && s.Password != "", "kafka.sasl: user and password are required for "+s.MechanismName())
+	case SASLOAuthBearer:
+		o := s.OAuth
+		check(o.Token != "" || o.TokenURL != "", "kafka.sasl.oauth: token or tokenUrl is required for OAUTHBEARER")
+		check(o.TokenURL == "" || (o.ClientID != "" && o.ClientSecret != ""), "kafka.sasl.oauth: clientId and clientSecret are required with tokenUrl")
+	default:
+		check(false, fmt.Sprintf("kafka.sasl.mechanism: unsupported mechanism %q", s.Mechanism))
+	}
+	return errs
+}
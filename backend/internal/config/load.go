@@ -0,0 +1,208 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting ties one field to its environment variable and command line flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(string) error
+}
+
+// settings lists every field that can be overridden outside the file
+func (c *Config) settings() []setting {
+	return []setting{
+		{"PORT", "port", "HTTP listen port", stringVar(&c.Server.Port)},
+		{"SHUTDOWN_GRACE_PERIOD", "shutdown-grace-period", "time running games get to finish on shutdown", durationVar(&c.Server.ShutdownGracePeriod)},
+		{"HEALTH_CHECK_TIMEOUT", "health-check-timeout", "timeout for each readiness check", durationVar(&c.Server.HealthCheckTimeout)},
+
+		{"DATABASE_URL", "database-url", "Postgres connection string", stringVar(&c.Database.URL)},
+		{"DB_HOST", "db-host", "Postgres host:port, when no URL is given", stringVar(&c.Database.Host)},
+		{"DB_USER", "db-user", "Postgres user, when no URL is given", stringVar(&c.Database.User)},
+		{"DB_PASSWORD", "db-password", "Postgres password, when no URL is given", stringVar(&c.Database.Password)},
+		{"DB_NAME", "db-name", "Postgres database, when no URL is given", stringVar(&c.Database.Name)},
+		{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open database connections (0 = no limit)", intVar(&c.Database.MaxOpenConns)},
+
+		{"KAFKA_URL", "kafka-brokers", "comma separated Kafka brokers (empty disables analytics)", listVar(&c.Kafka.Brokers)},
+		{"KAFKA_TOPIC", "kafka-topic", "topic for game events", stringVar(&c.Kafka.Topic)},
+		{"KAFKA_CONSUMER_GROUP", "kafka-consumer-group", "consumer group of the analytics service", stringVar(&c.Kafka.ConsumerGroup)},
+		{"KAFKA_TLS", "kafka-tls", "connect to the brokers over TLS", boolVar(&c.Kafka.TLS.Enabled)},
+		{"KAFKA_TLS_CA_FILE", "kafka-tls-ca-file", "PEM bundle of extra CAs trusted for the brokers", stringVar(&c.Kafka.TLS.CAFile)},
+		{"KAFKA_TLS_CERT_FILE", "kafka-tls-cert-file", "PEM client certificate for mTLS", stringVar(&c.Kafka.TLS.CertFile)},
+		{"KAFKA_TLS_KEY_FILE", "kafka-tls-key-file", "PEM client key for mTLS", stringVar(&c.Kafka.TLS.KeyFile)},
+		{"KAFKA_TLS_SERVER_NAME", "kafka-tls-server-name", "name expected in the broker certificate", stringVar(&c.Kafka.TLS.ServerName)},
+		{"KAFKA_TLS_INSECURE_SKIP_VERIFY", "kafka-tls-insecure-skip-verify", "skip verification of the broker certificate", boolVar(&c.Kafka.TLS.InsecureSkipVerify)},
+		{"KAFKA_SASL_MECHANISM", "kafka-sasl-mechanism", "PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or OAUTHBEARER", stringVar(&c.Kafka.SASL.Mechanism)},
+		{"KAFKA_USER", "kafka-user", "SASL user", stringVar(&c.Kafka.SASL.User)},
+		{"KAFKA_PASSWORD", "kafka-password", "SASL password", stringVar(&c.Kafka.SASL.Password)},
+		{"KAFKA_OAUTH_TOKEN", "kafka-oauth-token", "fixed OAUTHBEARER token", stringVar(&c.Kafka.SASL.OAuth.Token)},
+		{"KAFKA_OAUTH_TOKEN_URL", "kafka-oauth-token-url", "token endpoint for OAUTHBEARER client credentials", stringVar(&c.Kafka.SASL.OAuth.TokenURL)},
+		{"KAFKA_OAUTH_CLIENT_ID", "kafka-oauth-client-id", "OAUTHBEARER client ID", stringVar(&c.Kafka.SASL.OAuth.ClientID)},
+		{"KAFKA_OAUTH_CLIENT_SECRET", "kafka-oauth-client-secret", "OAUTHBEARER client secret", stringVar(&c.Kafka.SASL.OAuth.ClientSecret)},
+		{"KAFKA_OAUTH_SCOPES", "kafka-oauth-scopes", "comma separated OAUTHBEARER scopes", listVar(&c.Kafka.SASL.OAuth.Scopes)},
+		{"EVENT_OUTBOX_PATH", "event-outbox-path", "file holding events the broker hasn't accepted", stringVar(&c.Kafka.OutboxPath)},
+
+		{"EVENTS_NATS_URL", "events-nats-url", "NATS server to publish events to", stringVar(&c.Events.NATS.URL)},
+		{"EVENTS_NATS_SUBJECT", "events-nats-subject", "subject prefix for events on NATS", stringVar(&c.Events.NATS.Subject)},
+		{"EVENTS_WEBHOOK_URL", "events-webhook-url", "URL every event is POSTed to", stringVar(&c.Events.Webhook.URL)},
+		{"EVENTS_WEBHOOK_TIMEOUT", "events-webhook-timeout", "timeout of each webhook request", durationVar(&c.Events.Webhook.Timeout)},
+		{"EVENTS_WEBHOOK_RETRIES", "events-webhook-retries", "extra attempts after a failed webhook request", intVar(&c.Events.Webhook.Retries)},
+		{"EVENTS_FILE_PATH", "events-file-path", "JSONL file every event is appended to", stringVar(&c.Events.File.Path)},
+
+		{"WEBHOOK_WORKERS", "webhook-workers", "concurrent webhook deliveries", intVar(&c.Webhooks.Workers)},
+		{"WEBHOOK_TIMEOUT", "webhook-timeout", "timeout of each webhook delivery", durationVar(&c.Webhooks.Timeout)},
+		{"WEBHOOK_MAX_ATTEMPTS", "webhook-max-attempts", "attempts before a webhook delivery is given up", intVar(&c.Webhooks.MaxAttempts)},
+		{"WEBHOOK_INITIAL_BACKOFF", "webhook-initial-backoff", "wait before the first retry, doubled each time", durationVar(&c.Webhooks.InitialBackoff)},
+		{"WEBHOOK_REFRESH_INTERVAL", "webhook-refresh-interval", "how often webhook subscriptions are reloaded", durationVar(&c.Webhooks.RefreshInterval)},
+		{"ADMIN_TOKEN", "admin-token", "bearer token for the admin API (empty disables it)", stringVar(&c.Admin.Token)},
+
+		{"TOURNAMENT_NO_SHOW_AFTER", "tournament-no-show-after", "time a player has to show up for a tournament match", durationVar(&c.Tournament.NoShowAfter)},
+
+		{"CLUSTER_ENABLED", "cluster", "share matchmaking with other instances", boolVar(&c.Cluster.Enabled)},
+		{"INSTANCE_ID", "instance-id", "stable name of this instance in the cluster", stringVar(&c.Cluster.InstanceID)},
+
+		{"BOT_FALLBACK_AFTER", "bot-fallback-after", "queue time before a player is matched with the bot", durationVar(&c.Game.BotFallbackAfter)},
+		{"FORFEIT_AFTER", "forfeit-after", "time a disconnected player has to rejoin", durationVar(&c.Game.ForfeitAfter)},
+		{"RESUME_WINDOW", "resume-window", "time restored games wait for their players after a restart", durationVar(&c.Game.ResumeWindow)},
+		{"SERIES_BEST_OF", "series-best-of", "games per matchmade series", intVar(&c.Game.BestOf)},
+		{"SERIES_NEXT_GAME_AFTER", "series-next-game-after", "pause between the games of a series", durationVar(&c.Game.NextGameAfter)},
+		{"REMATCH_WINDOW", "rematch-window", "time players have to agree to a rematch", durationVar(&c.Game.RematchWindow)},
+		{"CHALLENGE_TIMEOUT", "challenge-timeout", "time a lobby challenge waits for an answer", durationVar(&c.Game.ChallengeTimeout)},
+		{"BOT_NAME", "bot-name", "username of the bot", stringVar(&c.Game.Bot.Name)},
+		{"BOT_MOVE_DELAY", "bot-move-delay", "pause before each bot move", durationVar(&c.Game.Bot.MoveDelay)},
+		{"BOT_RANDOMNESS", "bot-randomness", "chance (0-1) the bot skips its preferred column", floatVar(&c.Game.Bot.Randomness)},
+		{"ENGINE_MOVE_TIME", "engine-move-time", "time an external engine has for each move", durationVar(&c.Game.Engine.MoveTime)},
+		{"CHAT_MAX_LENGTH", "chat-max-length", "longest chat line accepted", intVar(&c.Game.Chat.MaxLength)},
+		{"CHAT_RATE_LIMIT", "chat-rate-limit", "chat lines and emotes a player may send per interval", intVar(&c.Game.Chat.RateLimit)},
+		{"CHAT_RATE_INTERVAL", "chat-rate-interval", "interval of the chat rate limit", durationVar(&c.Game.Chat.RateInterval)},
+		{"CHAT_BLOCKED_WORDS", "chat-blocked-words", "comma separated words masked out of chat", listVar(&c.Game.Chat.BlockedWords)},
+	}
+}
+
+// Load builds the configuration from the defaults, the file named by -config
+// or CONFIG_FILE, the environment and the given command line arguments.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	// Flags are only recorded here and applied last, after the file and
+	// the environment
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	flags := map[string]string{}
+	for _, s := range cfg.settings() {
+		name := s.flag
+		fs.Func(name, s.usage+" (env "+s.env+")", func(v string) error {
+			flags[name] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %v", *path, err)
+		}
+	}
+
+	settings := cfg.settings()
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(v); err != nil {
+				return cfg, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+	// Older deployments switch on the local docker broker this way
+	if os.Getenv("KAFKA_ENABLE_LOCAL") == "true" && !cfg.Kafka.Enabled() {
+		cfg.Kafka.Brokers = []string{"localhost:9092"}
+	}
+	// ...and got TLS implicitly with KAFKA_USER (Upstash)
+	if _, set := os.LookupEnv("KAFKA_TLS"); !set && os.Getenv("KAFKA_USER") != "" {
+		cfg.Kafka.TLS.Enabled = true
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok {
+			if err := s.set(v); err != nil {
+				return cfg, fmt.Errorf("-%s: %v", s.flag, err)
+			}
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func stringVar(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			*p = b
+		}
+		return err
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			*p = n
+		}
+		return err
+	}
+}
+
+func floatVar(p *float64) func(string) error {
+	return func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			*p = f
+		}
+		return err
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			*p = d
+		}
+		return err
+	}
+}
+
+func listVar(p *[]string) func(string) error {
+	return func(v string) error {
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
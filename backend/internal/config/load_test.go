@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	const file = `
+server:
+  port: "8081"
+game:
+  forfeitAfter: 45s
+  bestOf: 3
+`
+	tests := []struct {
+		name    string
+		file    bool
+		env     map[string]string
+		args    []string
+		port    string
+		forfeit time.Duration
+		bestOf  int
+	}{
+		{name: "defaults", port: "8080", forfeit: 30 * time.Second, bestOf: 1},
+		{name: "file over defaults", file: true, port: "8081", forfeit: 45 * time.Second, bestOf: 3},
+		{
+			name:    "env over file",
+			file:    true,
+			env:     map[string]string{"PORT": "8082", "FORFEIT_AFTER": "1m"},
+			port:    "8082",
+			forfeit: time.Minute,
+			bestOf:  3,
+		},
+		{
+			name:    "flags over env",
+			file:    true,
+			env:     map[string]string{"PORT": "8082", "SERIES_BEST_OF": "5"},
+			args:    []string{"-port", "8083", "-forfeit-after=2m"},
+			port:    "8083",
+			forfeit: 2 * time.Minute,
+			bestOf:  5,
+		},
+		{
+			name:    "flags without a file",
+			env:     map[string]string{"FORFEIT_AFTER": "1m"},
+			args:    []string{"-series-best-of", "7"},
+			port:    "8080",
+			forfeit: time.Minute,
+			bestOf:  7,
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetenv(t, "CONFIG_FILE", "PORT", "FORFEIT_AFTER", "SERIES_BEST_OF")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file {
+				args = append([]string{"-config", path}, args...)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Port != tt.port {
+				t.Errorf("port %q, want %q", cfg.Server.Port, tt.port)
+			}
+			if cfg.Game.ForfeitAfter != tt.forfeit {
+				t.Errorf("forfeitAfter %v, want %v", cfg.Game.ForfeitAfter, tt.forfeit)
+			}
+			if cfg.Game.BestOf != tt.bestOf {
+				t.Errorf("bestOf %d, want %d", cfg.Game.BestOf, tt.bestOf)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{name: "bad env", env: map[string]string{"FORFEIT_AFTER": "soon"}},
+		{name: "bad flag", args: []string{"-series-best-of", "many"}},
+		{name: "invalid after flags", env: map[string]string{"PORT": "8082"}, args: []string{"-port", "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetenv(t, "CONFIG_FILE", "PORT", "FORFEIT_AFTER", "SERIES_BEST_OF")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(tt.args); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
+
+// unsetenv clears variables for the rest of the test
+func unsetenv(t *testing.T, keys ...string) {
+	for _, k := range keys {
+		t.Setenv(k, "") // Restores the old value afterwards
+		os.Unsetenv(k)
+	}
+}
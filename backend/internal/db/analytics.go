@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GameStats is what the analytics service records about one finished game
+type GameStats struct {
+	GameID         string
+	FinishedAt     time.Time
+	Duration       float64
+	Draw           bool
+	BotGame        bool
+	BotWon         bool
+	BoardWin       bool // Decided by four in a row, not by forfeit etc.
+	FirstPlayerWon bool // Only meaningful for board wins
+	Abandoned      bool // Forfeited or nobody came back
+}
+
+// AnalyticsSummary aggregates every game recorded so far
+type AnalyticsSummary struct {
+	TotalGames       int     `json:"totalGames"`
+	GamesLastHour    int     `json:"gamesLastHour"` // Finished in the last 60 minutes
+	GamesLastDay     int     `json:"gamesLastDay"`  // Finished in the last 24 hours
+	AvgDuration      float64 `json:"avgDurationSeconds"`
+	DrawRate         float64 `json:"drawRate"`
+	BotWinRate       float64 `json:"botWinRate"`       // Share of bot games the bot won
+	FirstMoveWinRate float64 `json:"firstMoveWinRate"` // Share of board wins that went to the first player
+	AbandonmentRate  float64 `json:"abandonmentRate"`
+}
+
+// AnalyticsBucket is one point of the games time series
+type AnalyticsBucket struct {
+	Bucket      time.Time `json:"bucket"`
+	Games       int       `json:"games"`
+	AvgDuration float64   `json:"avgDurationSeconds"`
+	Draws       int       `json:"draws"`
+	BotGames    int       `json:"botGames"`
+	BotWins     int       `json:"botWins"`
+	Abandoned   int       `json:"abandoned"`
+}
+
+// RecordGameStats adds a game to the hourly aggregates. Games already
+// recorded are skipped, so replayed events are harmless.
+func (r *Repository) RecordGameStats(s GameStats) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO analytics_games (game_id, finished_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`, s.GameID, s.FinishedAt.UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO analytics_hourly AS a (bucket, games, total_duration, draws, bot_games, bot_wins, board_wins, first_player_wins, abandoned)
+		VALUES (date_trunc('hour', $1::timestamp), 1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (bucket) DO UPDATE SET
+			games = a.games + 1,
+			total_duration = a.total_duration + EXCLUDED.total_duration,
+			draws = a.draws + EXCLUDED.draws,
+			bot_games = a.bot_games + EXCLUDED.bot_games,
+			bot_wins = a.bot_wins + EXCLUDED.bot_wins,
+			board_wins = a.board_wins + EXCLUDED.board_wins,
+			first_player_wins = a.first_player_wins + EXCLUDED.first_player_wins,
+			abandoned = a.abandoned + EXCLUDED.abandoned`
+	_, err = tx.Exec(query, s.FinishedAt.UTC(), s.Duration,
+		count(s.Draw), count(s.BotGame), count(s.BotWon), count(s.BoardWin), count(s.FirstPlayerWon), count(s.Abandoned))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetAnalyticsSummary() (AnalyticsSummary, error) {
+	var s AnalyticsSummary
+	var duration float64
+	var draws, botGames, botWins, boardWins, firstWins, abandoned int
+
+	query := `
+		SELECT COALESCE(SUM(games), 0), COALESCE(SUM(total_duration), 0), COALESCE(SUM(draws), 0),
+			COALESCE(SUM(bot_games), 0), COALESCE(SUM(bot_wins), 0), COALESCE(SUM(board_wins), 0),
+			COALESCE(SUM(first_player_wins), 0), COALESCE(SUM(abandoned), 0)
+		FROM analytics_hourly`
+	err := r.db.QueryRow(query).Scan(&s.TotalGames, &duration, &draws, &botGames, &botWins,
+		&boardWins, &firstWins, &abandoned)
+	if err != nil {
+		return s, err
+	}
+
+	// Hourly buckets are too coarse for a sliding window, so recent games
+	// are counted one by one
+	query = `
+		SELECT COUNT(*) FILTER (WHERE finished_at >= NOW() AT TIME ZONE 'UTC' - INTERVAL '1 hour'), COUNT(*)
+		FROM analytics_games
+		WHERE finished_at >= NOW() AT TIME ZONE 'UTC' - INTERVAL '1 day'`
+	if err := r.db.QueryRow(query).Scan(&s.GamesLastHour, &s.GamesLastDay); err != nil {
+		return s, err
+	}
+
+	if s.TotalGames > 0 {
+		s.AvgDuration = duration / float64(s.TotalGames)
+	}
+	s.DrawRate = ratio(draws, s.TotalGames)
+	s.BotWinRate = ratio(botWins, botGames)
+	s.FirstMoveWinRate = ratio(firstWins, boardWins)
+	s.AbandonmentRate = ratio(abandoned, s.TotalGames)
+	return s, nil
+}
+
+// GetAnalyticsTimeseries returns games per interval ("hour" or "day") in [from, to)
+func (r *Repository) GetAnalyticsTimeseries(interval string, from, to time.Time) ([]AnalyticsBucket, error) {
+	query := `
+		SELECT date_trunc($1, bucket) AS b, SUM(games), SUM(total_duration), SUM(draws),
+			SUM(bot_games), SUM(bot_wins), SUM(abandoned)
+		FROM analytics_hourly
+		WHERE bucket >= $2 AND bucket < $3
+		GROUP BY b
+		ORDER BY b`
+	rows, err := r.db.Query(query, interval, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []AnalyticsBucket{}
+	for rows.Next() {
+		var b AnalyticsBucket
+		var duration sql.NullFloat64
+		if err := rows.Scan(&b.Bucket, &b.Games, &duration, &b.Draws, &b.BotGames, &b.BotWins, &b.Abandoned); err != nil {
+			return nil, err
+		}
+		if b.Games > 0 {
+			b.AvgDuration = duration.Float64 / float64(b.Games)
+		}
+		series = append(series, b)
+	}
+	return series, rows.Err()
+}
+
+func count(flag bool) int {
+	if flag {
+		return 1
+	}
+	return 0
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
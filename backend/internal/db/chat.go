@@ -0,0 +1,72 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatMessage is one chat line or emote sent during a game
+type ChatMessage struct {
+	ID       int64     `json:"id"`
+	GameID   string    `json:"gameId"`
+	Sender   string    `json:"sender"`
+	Kind     string    `json:"kind"`     // "chat" or "emote"
+	Text     string    `json:"text"`     // As delivered, after filtering
+	Original string    `json:"original"` // As typed, for moderation
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// SaveChatMessage appends to the chat log of a game
+func (r *Repository) SaveChatMessage(m ChatMessage) {
+	query := `INSERT INTO chat_messages (game_id, sender, kind, text, original, sent_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	start := time.Now()
+	_, err := r.db.Exec(query, m.GameID, m.Sender, m.Kind, m.Text, m.Original, m.SentAt)
+	observeWrite("chat_message", start, err)
+	if err != nil {
+		log.Printf("ERROR: Failed to log chat for game %s: %v", m.GameID, err)
+	}
+}
+
+// ListChatMessages returns the chat log of a game, oldest first
+func (r *Repository) ListChatMessages(gameID string) ([]ChatMessage, error) {
+	if uuid.Validate(gameID) != nil {
+		return []ChatMessage{}, nil
+	}
+	query := `SELECT id, game_id, sender, kind, text, original, sent_at FROM chat_messages WHERE game_id = $1 ORDER BY id`
+	rows, err := r.db.Query(query, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []ChatMessage{}
+	for rows.Next() {
+		var m ChatMessage
+		if err := rows.Scan(&m.ID, &m.GameID, &m.Sender, &m.Kind, &m.Text, &m.Original, &m.SentAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// SetBlocked records whether blocker hides every chat message from blocked
+func (r *Repository) SetBlocked(blocker, blocked string, on bool) error {
+	query := `INSERT INTO chat_blocks (blocker, blocked) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if !on {
+		query = `DELETE FROM chat_blocks WHERE blocker = $1 AND blocked = $2`
+	}
+	start := time.Now()
+	_, err := r.db.Exec(query, blocker, blocked)
+	observeWrite("chat_block", start, err)
+	return err
+}
+
+// IsBlocked reports whether blocker has blocked blocked
+func (r *Repository) IsBlocked(blocker, blocked string) (bool, error) {
+	var found bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM chat_blocks WHERE blocker = $1 AND blocked = $2)`, blocker, blocked).Scan(&found)
+	return found, err
+}
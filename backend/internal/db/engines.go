@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Engine is an external engine registered to play matchmade games
+type Engine struct {
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`  // Only returned when registered
+	Rating    int       `json:"rating,omitempty"` // Once it played a rated game
+	Games     int       `json:"games"`            // Rated games played
+	Connected int       `json:"connected"`        // Open connections, filled in by the API
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ErrExists is returned when registering a name that is taken
+var ErrExists = errors.New("already exists")
+
+// CreateEngine registers an engine under the hash of its token
+func (r *Repository) CreateEngine(name, tokenHash string) (Engine, error) {
+	e := Engine{Name: name}
+	query := `INSERT INTO engines (name, token_hash) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING created_at`
+	err := r.db.QueryRow(query, name, tokenHash).Scan(&e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return e, ErrExists
+	}
+	return e, err
+}
+
+// ListEngines returns every registered engine with its rating. Engines are
+// rated under their name with usernamePrefix in front.
+func (r *Repository) ListEngines(usernamePrefix string) ([]Engine, error) {
+	query := `
+		SELECT e.name, COALESCE(ROUND(r.rating)::int, 0), COALESCE(r.games, 0), e.created_at
+		FROM engines e
+		LEFT JOIN ratings r ON r.username = $1 || e.name
+		ORDER BY e.name`
+	rows, err := r.db.Query(query, usernamePrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	engines := []Engine{}
+	for rows.Next() {
+		var e Engine
+		if err := rows.Scan(&e.Name, &e.Rating, &e.Games, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		engines = append(engines, e)
+	}
+	return engines, rows.Err()
+}
+
+// FindEngine returns the name of the engine a token hash belongs to
+func (r *Repository) FindEngine(tokenHash string) (string, error) {
+	var name string
+	err := r.db.QueryRow(`SELECT name FROM engines WHERE token_hash = $1`, tokenHash).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return name, err
+}
+
+// DeleteEngine unregisters an engine. Its rating is kept.
+func (r *Repository) DeleteEngine(name string) error {
+	res, err := r.db.Exec(`DELETE FROM engines WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"time"
+
+	"connectfour/internal/rating"
+)
+
+// Rating is a player's Elo rating and rated record
+type Rating struct {
+	Username  string    `json:"username"`
+	Rating    float64   `json:"rating"`
+	Games     int       `json:"games"`
+	Wins      int       `json:"wins"`
+	Draws     int       `json:"draws"`
+	Losses    int       `json:"losses"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RecordRating updates the ratings of two players after a rated game.
+// score1 is what player1 scored: 1 for a win, 0.5 for a draw, 0 for a loss.
+func (r *Repository) RecordRating(player1, player2 string, score1 float64) error {
+	start := time.Now()
+	err := r.recordRating(player1, player2, score1)
+	observeWrite("record_rating", start, err)
+	return err
+}
+
+func (r *Repository) recordRating(player1, player2 string, score1 float64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO ratings (username, rating) VALUES ($1, $3), ($2, $3) ON CONFLICT DO NOTHING`,
+		player1, player2, rating.Initial)
+	if err != nil {
+		return err
+	}
+	// Lock both rows, in a fixed order, so concurrent games cannot deadlock
+	rows, err := tx.Query(`SELECT username, rating FROM ratings WHERE username IN ($1, $2) ORDER BY username FOR UPDATE`, player1, player2)
+	if err != nil {
+		return err
+	}
+	current := map[string]float64{}
+	for rows.Next() {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		current[name] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	new1, new2 := rating.Update(current[player1], current[player2], score1)
+	update := `
+		UPDATE ratings SET rating = $2, games = games + 1,
+			wins = wins + CASE WHEN $3::float8 = 1 THEN 1 ELSE 0 END,
+			draws = draws + CASE WHEN $3::float8 = 0.5 THEN 1 ELSE 0 END,
+			losses = losses + CASE WHEN $3::float8 = 0 THEN 1 ELSE 0 END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE username = $1`
+	if _, err := tx.Exec(update, player1, new1, score1); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(update, player2, new2, 1-score1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRatings returns the highest rated players, best first
+func (r *Repository) GetRatings(limit int) ([]Rating, error) {
+	rows, err := r.db.Query(`
+		SELECT username, rating, games, wins, draws, losses, updated_at
+		FROM ratings ORDER BY rating DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var e Rating
+		if err := rows.Scan(&e.Username, &e.Rating, &e.Games, &e.Wins, &e.Draws, &e.Losses, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, e)
+	}
+	return ratings, rows.Err()
+}
@@ -1,9 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/metrics"
 
 	_ "github.com/lib/pq" // Postgres Driver
 )
@@ -15,13 +21,34 @@ type Repository struct {
 type LeaderboardEntry struct {
 	Username string `json:"username"`
 	Wins     int    `json:"wins"`
+	Rating   int    `json:"rating,omitempty"` // Elo rating, once they played a rated game
+}
+
+// ActiveGame is a checkpoint of a game that is still being played
+type ActiveGame struct {
+	ID        string
+	Player1   string
+	Player2   string
+	BotGame   bool // Player2 is the built-in bot
+	Engine1   bool // Player1 is an external engine
+	Engine2   bool // Player2 is an external engine
+	Board     [6][7]int
+	Turn      int
+	StartedAt time.Time
+	Host      string // Instance running the game, empty when not clustered
+	SeriesID  string // Empty for checkpoints written before series existed
+	FirstTurn int    // Symbol that moved first
+	// Time each player had left to reconnect, negative while connected
+	Grace1 time.Duration
+	Grace2 time.Duration
 }
 
-func NewRepository(dsn string) (*Repository, error) {
-	db, err := sql.Open("postgres", dsn)
+func NewRepository(cfg config.Database) (*Repository, error) {
+	db, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
 
 	// Ping to verify connection
 	if err := db.Ping(); err != nil {
@@ -37,8 +64,117 @@ func NewRepository(dsn string) (*Repository, error) {
 		winner TEXT,
 		reason TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS active_games (
+		id UUID PRIMARY KEY,
+		player1 TEXT NOT NULL,
+		player2 TEXT NOT NULL,
+		bot_game BOOLEAN NOT NULL DEFAULT FALSE,
+		board JSONB NOT NULL,
+		turn INT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS series (
+		id UUID PRIMARY KEY,
+		player1 TEXT NOT NULL,
+		player2 TEXT NOT NULL,
+		best_of INT NOT NULL,
+		wins1 INT NOT NULL DEFAULT 0,
+		wins2 INT NOT NULL DEFAULT 0,
+		draws INT NOT NULL DEFAULT 0,
+		winner TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		finished BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS series_id UUID REFERENCES series(id);
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS series_game INT;
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS series_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS first_turn INT NOT NULL DEFAULT 1;
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS grace1_ms BIGINT NOT NULL DEFAULT -1;
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS grace2_ms BIGINT NOT NULL DEFAULT -1;
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS engine1 BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE active_games ADD COLUMN IF NOT EXISTS engine2 BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE series ADD COLUMN IF NOT EXISTS rated BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE TABLE IF NOT EXISTS analytics_hourly (
+		bucket TIMESTAMP PRIMARY KEY,
+		games INT NOT NULL DEFAULT 0,
+		total_duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+		draws INT NOT NULL DEFAULT 0,
+		bot_games INT NOT NULL DEFAULT 0,
+		bot_wins INT NOT NULL DEFAULT 0,
+		board_wins INT NOT NULL DEFAULT 0,
+		first_player_wins INT NOT NULL DEFAULT 0,
+		abandoned INT NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS analytics_games (
+		game_id TEXT PRIMARY KEY,
+		processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE analytics_games ADD COLUMN IF NOT EXISTS finished_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS analytics_games_finished_at ON analytics_games (finished_at);
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id UUID PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[] NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		delivery_id UUID NOT NULL,
+		event TEXT NOT NULL,
+		game_id TEXT NOT NULL DEFAULT '',
+		attempt INT NOT NULL,
+		status_code INT NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		success BOOLEAN NOT NULL,
+		duration_ms INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id DESC);
+	CREATE TABLE IF NOT EXISTS chat_messages (
+		id BIGSERIAL PRIMARY KEY,
+		game_id UUID NOT NULL,
+		sender TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		text TEXT NOT NULL,
+		original TEXT NOT NULL,
+		sent_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS chat_messages_game ON chat_messages (game_id, id);
+	CREATE TABLE IF NOT EXISTS chat_blocks (
+		blocker TEXT NOT NULL,
+		blocked TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (blocker, blocked)
+	);
+	CREATE TABLE IF NOT EXISTS tournaments (
+		id UUID PRIMARY KEY,
+		state JSONB NOT NULL,
+		finished BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS ratings (
+		username TEXT PRIMARY KEY,
+		rating DOUBLE PRECISION NOT NULL,
+		games INT NOT NULL DEFAULT 0,
+		wins INT NOT NULL DEFAULT 0,
+		draws INT NOT NULL DEFAULT 0,
+		losses INT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS engines (
+		name TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
-	
+
 	_, err = db.Exec(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate db: %v", err)
@@ -47,21 +183,126 @@ func NewRepository(dsn string) (*Repository, error) {
 	return &Repository{db: db}, nil
 }
 
-func (r *Repository) SaveGame(gameID, p1, p2, winner, reason string) {
-	query := `INSERT INTO games (id, player1, player2, winner, reason) VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.db.Exec(query, gameID, p1, p2, winner, reason)
+// Ping checks that the database is reachable
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close releases the connection pool
+func (r *Repository) Close() error {
+	return r.db.Close()
+}
+
+// SaveActiveGame upserts the checkpoint for a running game
+func (r *Repository) SaveActiveGame(g ActiveGame) {
+	board, _ := json.Marshal(g.Board)
+	query := `
+		INSERT INTO active_games (id, player1, player2, bot_game, board, turn, started_at, host, series_id, first_turn, grace1_ms, grace2_ms, engine1, engine2, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET board = EXCLUDED.board, turn = EXCLUDED.turn, host = EXCLUDED.host,
+			grace1_ms = EXCLUDED.grace1_ms, grace2_ms = EXCLUDED.grace2_ms, updated_at = CURRENT_TIMESTAMP`
+	start := time.Now()
+	_, err := r.db.Exec(query, g.ID, g.Player1, g.Player2, g.BotGame, board, g.Turn, g.StartedAt, g.Host, g.SeriesID, g.FirstTurn,
+		graceMillis(g.Grace1), graceMillis(g.Grace2), g.Engine1, g.Engine2)
+	observeWrite("checkpoint", start, err)
+	if err != nil {
+		log.Printf("ERROR: Failed to checkpoint game %s: %v", g.ID, err)
+	}
+}
+
+// DeleteActiveGame drops the checkpoint once a game is over
+func (r *Repository) DeleteActiveGame(gameID string) {
+	start := time.Now()
+	_, err := r.db.Exec(`DELETE FROM active_games WHERE id = $1`, gameID)
+	observeWrite("delete_checkpoint", start, err)
+	if err != nil {
+		log.Printf("ERROR: Failed to delete checkpoint for game %s: %v", gameID, err)
+	}
+}
+
+// LoadActiveGames returns every game checkpointed by the given host, oldest first
+func (r *Repository) LoadActiveGames(host string) ([]ActiveGame, error) {
+	query := `SELECT ` + activeGameColumns + ` FROM active_games WHERE host = $1 ORDER BY started_at`
+	rows, err := r.db.Query(query, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []ActiveGame
+	for rows.Next() {
+		g, err := scanActiveGame(rows)
+		if err != nil {
+			log.Printf("WARNING: Skipping unreadable checkpoint: %v", err)
+			continue
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// FindActiveGame looks up the unfinished game a player is part of, on any host
+func (r *Repository) FindActiveGame(username string) (ActiveGame, bool, error) {
+	query := `SELECT ` + activeGameColumns + ` FROM active_games WHERE player1 = $1 OR player2 = $1 ORDER BY started_at DESC LIMIT 1`
+	g, err := scanActiveGame(r.db.QueryRow(query, username))
+	if err == sql.ErrNoRows {
+		return g, false, nil
+	}
+	return g, err == nil, err
+}
+
+// ClaimActiveGame moves the checkpoint of a game from a host that is gone to
+// a new one. It returns false if another instance claimed it first.
+func (r *Repository) ClaimActiveGame(gameID, from, to string) (bool, error) {
+	res, err := r.db.Exec(`UPDATE active_games SET host = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND host = $2`, gameID, from, to)
+	if err != nil {
+		return false, err
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+// graceMillis stores a reconnect grace, keeping "connected" apart from no
+// time left
+func graceMillis(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return d.Milliseconds()
+}
+
+const activeGameColumns = `id, player1, player2, bot_game, board, turn, started_at, host, series_id, first_turn, grace1_ms, grace2_ms, engine1, engine2`
+
+func scanActiveGame(row interface{ Scan(...interface{}) error }) (ActiveGame, error) {
+	var g ActiveGame
+	var board []byte
+	var grace1, grace2 int64
+	if err := row.Scan(&g.ID, &g.Player1, &g.Player2, &g.BotGame, &board, &g.Turn, &g.StartedAt, &g.Host, &g.SeriesID, &g.FirstTurn, &grace1, &grace2, &g.Engine1, &g.Engine2); err != nil {
+		return g, err
+	}
+	g.Grace1 = time.Duration(grace1) * time.Millisecond
+	g.Grace2 = time.Duration(grace2) * time.Millisecond
+	if err := json.Unmarshal(board, &g.Board); err != nil {
+		return g, fmt.Errorf("corrupt board in checkpoint %s: %v", g.ID, err)
+	}
+	return g, nil
+}
+
+// observeWrite records the latency and outcome of a write
+func observeWrite(op string, start time.Time, err error) {
+	metrics.DBWriteDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Printf("ERROR: Failed to save game to DB: %v", err)
-	} else {
-		log.Printf("DB: Game %s saved successfully.", gameID)
+		metrics.DBWriteFailures.WithLabelValues(op).Inc()
 	}
 }
 
 func (r *Repository) GetLeaderboard() ([]LeaderboardEntry, error) {
-	// Simple query: Count wins per user (excluding 'Draw')
+	// Simple query: Count wins per user (excluding 'Draw'), however the
+	// game was won
 	query := `
-		SELECT winner, COUNT(*) as wins 
+		SELECT winner, COUNT(*) as wins, COALESCE(ROUND(MAX(r.rating))::int, 0)
 		FROM games 
+		LEFT JOIN ratings r ON r.username = games.winner
 		WHERE winner != 'Draw' 
 		GROUP BY winner 
 		ORDER BY wins DESC 
@@ -76,7 +317,7 @@ func (r *Repository) GetLeaderboard() ([]LeaderboardEntry, error) {
 	var leaderboard []LeaderboardEntry
 	for rows.Next() {
 		var e LeaderboardEntry
-		if err := rows.Scan(&e.Username, &e.Wins); err != nil {
+		if err := rows.Scan(&e.Username, &e.Wins, &e.Rating); err != nil {
 			continue
 		}
 		leaderboard = append(leaderboard, e)
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Series is a best-of-N match between two players and its score so far.
+// Every game of the series is stored in games with its series_id.
+type Series struct {
+	ID        string
+	Player1   string
+	Player2   string
+	BestOf    int
+	Wins1     int
+	Wins2     int
+	Draws     int
+	Winner    string // Username or "Draw", once finished
+	Reason    string
+	Finished  bool
+	Rated     bool // Its games count towards ratings
+	CreatedAt time.Time
+}
+
+const upsertSeries = `
+	INSERT INTO series (id, player1, player2, best_of, wins1, wins2, draws, winner, reason, finished, rated, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, CURRENT_TIMESTAMP)
+	ON CONFLICT (id) DO UPDATE SET wins1 = EXCLUDED.wins1, wins2 = EXCLUDED.wins2, draws = EXCLUDED.draws,
+		winner = EXCLUDED.winner, reason = EXCLUDED.reason, finished = EXCLUDED.finished, updated_at = CURRENT_TIMESTAMP`
+
+func seriesArgs(s Series) []interface{} {
+	return []interface{}{s.ID, s.Player1, s.Player2, s.BestOf, s.Wins1, s.Wins2, s.Draws, s.Winner, s.Reason, s.Finished, s.Rated, s.CreatedAt}
+}
+
+// SaveSeries upserts a series and its score
+func (r *Repository) SaveSeries(s Series) {
+	start := time.Now()
+	_, err := r.db.Exec(upsertSeries, seriesArgs(s)...)
+	observeWrite("save_series", start, err)
+	if err != nil {
+		log.Printf("ERROR: Failed to save series %s: %v", s.ID, err)
+	}
+}
+
+// SaveGame stores a finished game together with the score of its series
+// after it, in one transaction, so the two never disagree. number is the
+// 1-based position of the game in the series.
+func (r *Repository) SaveGame(s Series, gameID string, number int, winner, reason string) {
+	start := time.Now()
+	err := r.saveGame(s, gameID, number, winner, reason)
+	observeWrite("save_game", start, err)
+	if err != nil {
+		log.Printf("ERROR: Failed to save game to DB: %v", err)
+	} else {
+		log.Printf("DB: Game %s saved successfully.", gameID)
+	}
+}
+
+func (r *Repository) saveGame(s Series, gameID string, number int, winner, reason string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(upsertSeries, seriesArgs(s)...); err != nil {
+		return err
+	}
+	query := `INSERT INTO games (id, player1, player2, winner, reason, series_id, series_game) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.Exec(query, gameID, s.Player1, s.Player2, winner, reason, s.ID, number); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadGameResult looks up how a stored game ended
+func (r *Repository) LoadGameResult(gameID string) (winner, reason string, ok bool, err error) {
+	var w, why sql.NullString
+	err = r.db.QueryRow(`SELECT winner, reason FROM games WHERE id = $1`, gameID).Scan(&w, &why)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	return w.String, why.String, err == nil, err
+}
+
+// LoadSeries looks up a series by ID
+func (r *Repository) LoadSeries(id string) (Series, bool, error) {
+	var s Series
+	query := `SELECT id, player1, player2, best_of, wins1, wins2, draws, winner, reason, finished, rated, created_at FROM series WHERE id = $1`
+	err := r.db.QueryRow(query, id).Scan(&s.ID, &s.Player1, &s.Player2, &s.BestOf, &s.Wins1, &s.Wins2, &s.Draws, &s.Winner, &s.Reason, &s.Finished, &s.Rated, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return s, false, nil
+	}
+	return s, err == nil, err
+}
@@ -0,0 +1,35 @@
+package db
+
+import "time"
+
+// SaveTournament stores the full state of a tournament, replacing the
+// previous one. The state is opaque to the repository.
+func (r *Repository) SaveTournament(id string, state []byte, finished bool) error {
+	query := `
+		INSERT INTO tournaments (id, state, finished, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state, finished = EXCLUDED.finished, updated_at = CURRENT_TIMESTAMP`
+	start := time.Now()
+	_, err := r.db.Exec(query, id, state, finished)
+	observeWrite("save_tournament", start, err)
+	return err
+}
+
+// LoadTournaments returns the state of every tournament, oldest first
+func (r *Repository) LoadTournaments() ([][]byte, error) {
+	rows, err := r.db.Query(`SELECT state FROM tournaments ORDER BY (state->>'createdAt')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states [][]byte
+	for rows.Next() {
+		var state []byte
+		if err := rows.Scan(&state); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
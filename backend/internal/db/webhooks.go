@@ -0,0 +1,143 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Webhook is a subscription to game events
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // Only returned when created
+	Events    []string  `json:"events"`           // Event types, or "*" for all
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is one attempt at delivering an event to a webhook.
+// Retries of the same event share a DeliveryID.
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  string    `json:"webhookId"`
+	DeliveryID string    `json:"deliveryId"`
+	Event      string    `json:"event"`
+	GameID     string    `json:"gameId,omitempty"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int       `json:"durationMs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ErrNotFound is returned when a webhook or engine doesn't exist
+var ErrNotFound = errors.New("not found")
+
+func (r *Repository) CreateWebhook(w Webhook) (Webhook, error) {
+	query := `INSERT INTO webhooks (id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	err := r.db.QueryRow(query, w.ID, w.URL, w.Secret, pq.Array(w.Events), w.Active).Scan(&w.CreatedAt)
+	return w, err
+}
+
+// ListWebhooks returns every subscription, secrets included
+func (r *Repository) ListWebhooks() ([]Webhook, error) {
+	rows, err := r.db.Query(`SELECT id, url, secret, events, active, created_at FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
+
+func (r *Repository) GetWebhook(id string) (Webhook, error) {
+	if uuid.Validate(id) != nil {
+		return Webhook{}, ErrNotFound
+	}
+	row := r.db.QueryRow(`SELECT id, url, secret, events, active, created_at FROM webhooks WHERE id = $1`, id)
+	w, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return w, ErrNotFound
+	}
+	return w, err
+}
+
+// UpdateWebhook changes the URL, event filter and active flag
+func (r *Repository) UpdateWebhook(w Webhook) error {
+	res, err := r.db.Exec(`UPDATE webhooks SET url = $2, events = $3, active = $4 WHERE id = $1`, w.ID, w.URL, pq.Array(w.Events), w.Active)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteWebhook removes a subscription and its delivery log
+func (r *Repository) DeleteWebhook(id string) error {
+	if uuid.Validate(id) != nil {
+		return ErrNotFound
+	}
+	res, err := r.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) LogWebhookDelivery(d WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, delivery_id, event, game_id, attempt, status_code, error, success, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	start := time.Now()
+	_, err := r.db.Exec(query, d.WebhookID, d.DeliveryID, d.Event, d.GameID, d.Attempt, d.StatusCode, d.Error, d.Success, d.DurationMs)
+	observeWrite("webhook_delivery", start, err)
+	return err
+}
+
+// ListWebhookDeliveries returns the most recent attempts for a webhook, newest first
+func (r *Repository) ListWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, delivery_id, event, game_id, attempt, status_code, error, success, duration_ms, created_at
+		FROM webhook_deliveries WHERE webhook_id = $1
+		ORDER BY id DESC LIMIT $2`
+	rows, err := r.db.Query(query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.DeliveryID, &d.Event, &d.GameID, &d.Attempt, &d.StatusCode, &d.Error, &d.Success, &d.DurationMs, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (Webhook, error) {
+	var w Webhook
+	err := row.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Active, &w.CreatedAt)
+	return w, err
+}
@@ -0,0 +1,54 @@
+package event
+
+import (
+	"log"
+	"time"
+
+	"connectfour/internal/db"
+)
+
+// AnalyticsSink records GAME_OVER events straight into the analytics tables.
+// It stands in for the Kafka consumer in deployments without a broker.
+type AnalyticsSink struct {
+	*worker
+}
+
+func NewAnalyticsSink(repo *db.Repository) *AnalyticsSink {
+	return &AnalyticsSink{worker: newWorker("ANALYTICS", func(e GameEvent) error {
+		if e.Event != EventGameOver {
+			return nil
+		}
+		return recordGameOver(repo, e)
+	})}
+}
+
+// recordGameOver folds one finished game into the aggregates
+func recordGameOver(repo *db.Repository, e GameEvent) error {
+	finishedAt := e.Timestamp
+	if finishedAt.IsZero() {
+		finishedAt = time.Now() // Version 0 events carry no timestamp
+	}
+
+	stats := db.GameStats{
+		GameID:     e.GameID,
+		FinishedAt: finishedAt,
+		Duration:   e.Duration,
+		Draw:       e.Winner == "Draw",
+		BotGame:    e.BotGame,
+		BotWon:     e.BotGame && e.Winner == e.Player2,
+		BoardWin:   e.Reason == "connect4",
+		Abandoned:  e.Reason == "forfeit" || e.Reason == "abandoned",
+	}
+	first := e.FirstPlayer
+	if first == "" {
+		first = e.Player1
+	}
+	stats.FirstPlayerWon = stats.BoardWin && e.Winner == first
+
+	log.Printf("📊 ANALYTICS PROCESSED: Winner=%s GameID=%s Duration=%.1fs Reason=%s", e.Winner, e.GameID, e.Duration, e.Reason)
+
+	if repo == nil {
+		return nil
+	}
+	return repo.RecordGameStats(stats)
+}
@@ -1,99 +1,166 @@
 package event
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"os"
-	"os/signal"
 	"time"
 
+	"connectfour/internal/config"
+	"connectfour/internal/db"
+
 	"github.com/IBM/sarama"
 )
 
+const recordAttempts = 5 // Tries per game before it is skipped
+
+// recordBackoff is the first wait between tries, doubled each time
+var recordBackoff = time.Second
+
+// Consumer runs the analytics service as a member of a Kafka consumer group.
+// Partitions are shared between every server in the group, and offsets are
+// committed so a restart picks up where the group left off.
 type Consumer struct {
-	consumer sarama.Consumer
-	topic    string
-	
-	// Analytics State
-	totalGames    int
-	totalDuration float64
-	gamesByHour   map[string]int
+	group sarama.ConsumerGroup
+	topic string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// process records one finished game
+	process func(GameEvent) error
+
+	// Aggregates live in the store so they survive restarts and can be
+	// shared by every consumer in the group
+	repo *db.Repository
 }
 
-func NewConsumer(brokers []string) (*Consumer, error) {
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-
-	// CHECK FOR SASL AUTH
-	if user := os.Getenv("KAFKA_USER"); user != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = user
-		config.Net.SASL.Password = os.Getenv("KAFKA_PASSWORD")
-		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		config.Net.TLS.Enable = true
-		config.Net.TLS.Config = &tls.Config{InsecureSkipVerify: true}
+func NewConsumer(cfg config.Kafka, repo *db.Repository) (*Consumer, error) {
+	sc, err := clientConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
+	sc.Consumer.Return.Errors = true
+	// A brand new group starts from the beginning of the topic
+	sc.Consumer.Offsets.Initial = sarama.OffsetOldest
+	sc.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
 
-	c, err := sarama.NewConsumer(brokers, config)
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.ConsumerGroup, sc)
 	if err != nil {
 		return nil, err
 	}
-	return &Consumer{
-		consumer:    c,
-		topic:       "game-analytics",
-		gamesByHour: make(map[string]int),
-	}, nil
-}
-func (c *Consumer) Start() {
-	partitionConsumer, err := c.consumer.ConsumePartition(c.topic, 0, sarama.OffsetNewest)
-	if err != nil {
-		log.Printf("ANALYTICS: Could not start consumer: %v", err)
-		return
+	c := &Consumer{
+		group: group,
+		topic: cfg.Topic,
+		done:  make(chan struct{}),
+		repo:  repo,
 	}
+	c.process = c.processEvent
+	return c, nil
+}
 
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
+// Start joins the group in the background. Call Close to leave it.
+func (c *Consumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
 
-	log.Println("ANALYTICS: Consumer started. Tracking metrics...")
+	go func() {
+		for err := range c.group.Errors() {
+			log.Printf("ANALYTICS ERROR: %v", err)
+		}
+	}()
 
 	go func() {
+		defer close(c.done)
+		log.Println("ANALYTICS: Consumer started. Tracking metrics...")
+
+		// Consume returns on every rebalance, so keep rejoining until closed
 		for {
-			select {
-			case msg := <-partitionConsumer.Messages():
-				var event GameAnalyticsEvent
-				if err := json.Unmarshal(msg.Value, &event); err == nil {
-					c.processEvent(event)
-				}
-			case err := <-partitionConsumer.Errors():
-				log.Printf("ANALYTICS ERROR: %v", err)
-			case <-signals:
+			err := c.group.Consume(ctx, []string{c.topic}, c)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) || ctx.Err() != nil {
 				return
 			}
+			if err != nil {
+				log.Printf("ANALYTICS ERROR: Consume failed: %v", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(5 * time.Second):
+				}
+			}
 		}
 	}()
 }
 
-func (c *Consumer) processEvent(e GameAnalyticsEvent) {
-	// 1. Update Metrics
-	c.totalGames++
-	c.totalDuration += e.Duration
-	
-	// Track Games per Hour (Key: "2025-12-03 15:00")
-	currentHour := time.Now().Format("2006-01-02 15:00")
-	c.gamesByHour[currentHour]++
-
-	// 2. Calculate Derived Stats
-	avgDuration := 0.0
-	if c.totalGames > 0 {
-		avgDuration = c.totalDuration / float64(c.totalGames)
+// Close stops consuming, commits the final offsets and leaves the group
+func (c *Consumer) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
 	}
+	return c.group.Close()
+}
+
+// Setup is run at the start of a new session, before ConsumeClaim
+func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	log.Printf("ANALYTICS: Assigned partitions %v (generation %d)", session.Claims()[c.topic], session.GenerationID())
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (c *Consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	log.Printf("ANALYTICS: Released partitions %v", session.Claims()[c.topic])
+	return nil
+}
 
-	// 3. Log the "Report"
-	log.Printf("📊 [ANALYTICS REPORT]")
-	log.Printf("   Last Game:   %s (Winner: %s, Time: %.2fs)", e.GameID, e.Winner, e.Duration)
-	log.Printf("   Total Games: %d", c.totalGames)
-	log.Printf("   Avg Duration: %.2f seconds", avgDuration)
-	log.Printf("   Games This Hour: %d", c.gamesByHour[currentHour])
-	log.Printf("------------------------------------------------")
-}
\ No newline at end of file
+// ConsumeClaim processes one partition until the session ends
+func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			var event GameEvent
+			if err := json.Unmarshal(msg.Value, &event); err == nil && event.Event == EventGameOver {
+				// Ending the session without marking makes the group redeliver it
+				if !c.record(session.Context(), event) {
+					return nil
+				}
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// record processes a finished game, backing off while the store fails. A
+// game that still can't be recorded after recordAttempts is skipped, so
+// one bad event can't hold up its partition. It returns false if the
+// session ended first.
+func (c *Consumer) record(ctx context.Context, e GameEvent) bool {
+	delay := recordBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.process(e)
+		if err == nil {
+			return true
+		}
+		if attempt == recordAttempts {
+			log.Printf("ANALYTICS ERROR: Skipping game %s after %d attempts: %v", e.GameID, attempt, err)
+			return true
+		}
+		log.Printf("ANALYTICS ERROR: Could not record game %s, retrying in %s: %v", e.GameID, delay, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Consumer) processEvent(e GameEvent) error {
+	return recordGameOver(c.repo, e)
+}
@@ -0,0 +1,87 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// session stands in for a consumer group session, keeping the offsets marked
+type session struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *session) Context() context.Context { return s.ctx }
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// claim stands in for one claimed partition
+type claim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c claim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumeClaim(t *testing.T) {
+	defer func(d time.Duration) { recordBackoff = d }(recordBackoff)
+	recordBackoff = time.Millisecond
+
+	gameOver, _ := json.Marshal(GameEvent{Event: EventGameOver, GameID: "g1"})
+	moveMade, _ := json.Marshal(GameEvent{Event: EventMoveMade, GameID: "g1"})
+	failing := errors.New("store down")
+
+	tests := []struct {
+		name     string
+		value    []byte
+		failures int // Calls that fail before one succeeds
+		closed   bool
+		calls    int
+		marked   string
+	}{
+		{"recorded", gameOver, 0, false, 1, "[0]"},
+		{"retried", gameOver, 2, false, 3, "[0]"},
+		{"skipped", gameOver, 99, false, recordAttempts, "[0]"},
+		{"session ended", gameOver, 99, true, 1, "[]"},
+		{"other event", moveMade, 0, false, 0, "[0]"},
+		{"malformed", []byte("{"), 0, false, 0, "[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			calls := 0
+			c := &Consumer{topic: "games"}
+			c.process = func(GameEvent) error {
+				calls++
+				if tt.closed {
+					cancel()
+				}
+				if calls <= tt.failures {
+					return failing
+				}
+				return nil
+			}
+
+			messages := make(chan *sarama.ConsumerMessage, 1)
+			messages <- &sarama.ConsumerMessage{Value: tt.value}
+			close(messages)
+			s := &session{ctx: ctx, marked: []int64{}}
+			if err := c.ConsumeClaim(s, claim{messages: messages}); err != nil {
+				t.Fatal(err)
+			}
+			if calls != tt.calls || fmt.Sprint(s.marked) != tt.marked {
+				t.Errorf("processed %d time(s), marked %v; want %d, %s", calls, s.marked, tt.calls, tt.marked)
+			}
+		})
+	}
+}
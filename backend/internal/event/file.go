@@ -0,0 +1,39 @@
+package event
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// FileSink appends every event as one JSON line to a file. Rotation is left
+// to the usual log tooling; the file is reopened in append mode per write.
+type FileSink struct {
+	*worker
+	path string
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileSink{path: path}
+	s.worker = newWorker("EVENT FILE", s.write)
+	return s, nil
+}
+
+func (s *FileSink) write(e GameEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
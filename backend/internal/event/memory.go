@@ -0,0 +1,29 @@
+package event
+
+import "sync"
+
+// MemorySink keeps every event in memory, for tests and tools
+type MemorySink struct {
+	mutex  sync.Mutex
+	events []GameEvent
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (m *MemorySink) Emit(e GameEvent) {
+	Stamp(&e)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.events = append(m.events, e)
+}
+
+// Events returns a copy of everything emitted so far
+func (m *MemorySink) Events() []GameEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]GameEvent(nil), m.events...)
+}
+
+func (m *MemorySink) Close() {}
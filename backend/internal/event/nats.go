@@ -0,0 +1,67 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"connectfour/internal/config"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes every event on <subject>.<EVENT_TYPE>. The client
+// buffers while reconnecting, so Emit doesn't wait on the server.
+type NATSSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func NewNATSSink(cfg config.NATS) (*NATSSink, error) {
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name("connect4"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS: Disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.Printf("NATS: Reconnected to %s", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSSink{conn: conn, subject: cfg.Subject}, nil
+}
+
+func (s *NATSSink) Emit(e GameEvent) {
+	Stamp(&e)
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("NATS ERROR: Could not encode %s event: %v", e.Event, err)
+		return
+	}
+	if err := s.conn.Publish(s.subject+"."+string(e.Event), data); err != nil {
+		log.Printf("NATS ERROR: Could not publish %s event: %v", e.Event, err)
+	}
+}
+
+// Ping checks that the server answers a round trip
+func (s *NATSSink) Ping(ctx context.Context) error {
+	if !s.conn.IsConnected() {
+		return errors.New("not connected")
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+// Close flushes buffered events and disconnects
+func (s *NATSSink) Close() {
+	if err := s.conn.FlushTimeout(5 * time.Second); err != nil {
+		log.Printf("NATS ERROR: Events may be lost on close: %v", err)
+	}
+	s.conn.Close()
+}
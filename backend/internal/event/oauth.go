@@ -0,0 +1,93 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"connectfour/internal/config"
+
+	"github.com/IBM/sarama"
+)
+
+// tokenProvider supplies OAUTHBEARER tokens to sarama. Tokens fetched with
+// client credentials are cached until shortly before they expire.
+type tokenProvider struct {
+	cfg    config.OAuth
+	client *http.Client
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newTokenProvider(cfg config.OAuth) *tokenProvider {
+	return &tokenProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (t *tokenProvider) Token() (*sarama.AccessToken, error) {
+	if t.cfg.TokenURL == "" {
+		return &sarama.AccessToken{Token: t.cfg.Token}, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.token == "" || time.Now().After(t.expires) {
+		if err := t.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	return &sarama.AccessToken{Token: t.token}, nil
+}
+
+// refresh runs the client credentials grant. Must be called with t.mutex held.
+func (t *tokenProvider) refresh() error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(t.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.cfg.Scopes, " "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(t.cfg.ClientID), url.QueryEscape(t.cfg.ClientSecret))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka oauth token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka oauth token: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("kafka oauth token: %v", err)
+	}
+	if body.AccessToken == "" {
+		return fmt.Errorf("kafka oauth token: empty access_token")
+	}
+
+	// Refresh a little early so the broker never sees an expired token
+	lifetime := time.Duration(body.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = 5 * time.Minute
+	}
+	t.token = body.AccessToken
+	t.expires = time.Now().Add(lifetime * 9 / 10)
+	return nil
+}
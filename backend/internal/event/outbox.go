@@ -0,0 +1,128 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// outboxRecord is one line of the outbox file
+type outboxRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// outbox is an append-only JSONL file holding events the broker hasn't
+// accepted yet. It survives restarts; whatever is left in it is sent the
+// next time the broker is reachable.
+type outbox struct {
+	mutex   sync.Mutex
+	path    string
+	pending int
+}
+
+func openOutbox(path string) (*outbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	o := &outbox{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	o.pending = bytes.Count(data, []byte("\n"))
+	return o, nil
+}
+
+// Len returns the number of events waiting in the outbox
+func (o *outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.pending
+}
+
+// Append stores records at the end of the outbox and syncs them to disk,
+// once for the lot
+func (o *outbox) Append(recs ...outboxRecord) error {
+	var lines []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	f, err := os.OpenFile(o.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(lines); err != nil {
+		return err
+	}
+	o.pending += len(recs)
+	return f.Sync()
+}
+
+// Drain sends stored records in order until send fails, then rewrites the
+// file with whatever is left. Records appended while draining are kept.
+func (o *outbox) Drain(send func(outboxRecord) error) (int, error) {
+	o.mutex.Lock()
+	data, err := os.ReadFile(o.path)
+	o.mutex.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	// Send outside the lock so Append never waits on the broker
+	consumed := 0
+	sent := 0
+	var sendErr error
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		var rec outboxRecord
+		if json.Unmarshal(line, &rec) == nil {
+			if sendErr = send(rec); sendErr != nil {
+				break
+			}
+			sent++
+		}
+		consumed += len(line)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	current, err := os.ReadFile(o.path)
+	if err != nil {
+		return sent, err
+	}
+	rest := current[consumed:]
+
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, rest, 0o644); err != nil {
+		return sent, err
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return sent, err
+	}
+	o.pending = bytes.Count(rest, []byte("\n"))
+	return sent, sendErr
+}
@@ -1,73 +1,253 @@
 package event
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"log"
-	"os"
+	"net"
+	"sync"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/metrics"
 
 	"github.com/IBM/sarama"
 )
+
+const (
+	queueSize   = 1024            // Events buffered in memory before spilling
+	spillSize   = 4 * queueSize   // Events waiting behind a full queue before they are dropped
+	outboxRetry = 5 * time.Second // How often parked events are retried
+)
+
+// Producer is the Kafka sink. It publishes events without ever blocking the caller. Events go
+// through a bounded in-memory queue to a single sender goroutine; anything
+// the broker doesn't accept is parked in a file outbox and retried in order.
+// When the queue is full, events wait in a bounded spill list for the same
+// goroutine, so callers never touch the outbox file themselves. Events that
+// don't fit there either are dropped, like in the other sinks.
 type Producer struct {
 	producer sarama.SyncProducer
 	topic    string
-}
+	brokers  []string
+
+	queue   chan outboxRecord
+	spilled chan struct{} // Wakes the sender when spill fills up
+	outbox  *outbox
+	done    chan struct{}
 
-type GameAnalyticsEvent struct {
-	Event    string  `json:"event"`
-	GameID   string  `json:"gameId"`
-	Winner   string  `json:"winner"`
-	Duration float64 `json:"duration_seconds"` // Added duration
+	mutex  sync.Mutex
+	spill  []outboxRecord // Emitted while the queue was full, oldest first
+	closed bool
 }
 
-func NewProducer(brokers []string) (*Producer, error) {
-	config := sarama.NewConfig()
-	config.Producer.Return.Successes = true
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
+func NewProducer(cfg config.Kafka) (*Producer, error) {
+	sc, err := clientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sc.Producer.Return.Successes = true
+	sc.Producer.RequiredAcks = sarama.WaitForAll
+	sc.Producer.Retry.Max = 5
 
-	// CHECK FOR SASL AUTH (Required for Upstash)
-	if user := os.Getenv("KAFKA_USER"); user != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = user
-		config.Net.SASL.Password = os.Getenv("KAFKA_PASSWORD")
-		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		config.Net.TLS.Enable = true
-		config.Net.TLS.Config = &tls.Config{InsecureSkipVerify: true}
+	box, err := openOutbox(cfg.OutboxPath)
+	if err != nil {
+		return nil, err
 	}
 
-	p, err := sarama.NewSyncProducer(brokers, config)
+	sp, err := sarama.NewSyncProducer(cfg.Brokers, sc)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Producer{producer: p, topic: "game-analytics"}, nil
+	if n := box.Len(); n > 0 {
+		log.Printf("KAFKA: %d event(s) left in outbox from a previous run", n)
+	}
+	return newProducer(sp, cfg, box), nil
+}
+
+// newProducer starts the sender goroutine for a connected producer
+func newProducer(sp sarama.SyncProducer, cfg config.Kafka, box *outbox) *Producer {
+	p := &Producer{
+		producer: sp,
+		topic:    cfg.Topic,
+		brokers:  cfg.Brokers,
+		queue:    make(chan outboxRecord, queueSize),
+		spilled:  make(chan struct{}, 1),
+		outbox:   box,
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Emit publishes a lifecycle event, stamping the schema version and time
+func (p *Producer) Emit(e GameEvent) {
+	Stamp(&e)
+
+	val, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("KAFKA ERROR: Could not encode %s event: %v", e.Event, err)
+		return
+	}
+
+	rec := outboxRecord{Key: e.Key(), Value: val}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.closed && len(p.spill) == 0 {
+		select {
+		case p.queue <- rec:
+			return
+		default:
+		}
+	}
+	if len(p.spill) >= spillSize {
+		metrics.KafkaEventsDropped.Inc()
+		log.Printf("KAFKA ERROR: Spill full, dropping %s event", e.Event)
+		return
+	}
+	// Queue full or closed: the sender takes it after what's ahead of it
+	p.spill = append(p.spill, rec)
+	select {
+	case p.spilled <- struct{}{}:
+	default:
+	}
+}
+
+// run is the only goroutine talking to the broker, so events leave in the
+// order they were queued.
+func (p *Producer) run() {
+	ticker := time.NewTicker(outboxRetry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case rec, ok := <-p.queue:
+			if !ok {
+				for batch := p.takeSpill(); batch != nil; batch = p.takeSpill() {
+					p.publishAll(batch)
+				}
+				p.redeliver()
+				close(p.done)
+				p.parkLate()
+				return
+			}
+			p.publishAll([]outboxRecord{rec})
+		case <-p.spilled:
+		case <-ticker.C:
+			p.redeliver()
+		}
+		p.publishAll(p.takeSpill())
+	}
+}
+
+// parkLate parks events emitted after Close, which have no broker left to
+// go to, until the process exits
+func (p *Producer) parkLate() {
+	for range p.spilled {
+		for batch := p.takeSpill(); batch != nil; batch = p.takeSpill() {
+			p.park(batch...)
+		}
+	}
+}
+
+// takeSpill returns the events that didn't fit in the queue, behind the ones
+// still in it, which were emitted first
+func (p *Producer) takeSpill() []outboxRecord {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.spill) == 0 {
+		return nil
+	}
+	// Emit can't add to the queue while the lock is held
+	var batch []outboxRecord
+	for len(p.queue) > 0 {
+		batch = append(batch, <-p.queue)
+	}
+	batch = append(batch, p.spill...)
+	p.spill = nil
+	return batch
 }
 
-func (p *Producer) EmitGameOver(gameID, winner string, duration float64) {
-	event := GameAnalyticsEvent{
-		Event:    "GAME_OVER",
-		GameID:   gameID,
-		Winner:   winner,
-		Duration: duration,
+// publishAll sends a batch in order. Once the broker fails, or while older
+// events are still parked (sending now would overtake them), the rest of the
+// batch is parked in one write instead of being tried event by event.
+func (p *Producer) publishAll(batch []outboxRecord) {
+	for i, rec := range batch {
+		if p.outbox.Len() == 0 {
+			err := p.send(rec)
+			if err == nil {
+				continue
+			}
+			log.Printf("KAFKA ERROR: Failed to send event, parking %d in the outbox: %v", len(batch)-i, err)
+		}
+		p.park(batch[i:]...)
+		return
 	}
+}
 
-	val, _ := json.Marshal(event)
+func (p *Producer) park(recs ...outboxRecord) {
+	if err := p.outbox.Append(recs...); err != nil {
+		log.Printf("KAFKA ERROR: Could not write %d event(s) to outbox, they are lost: %v", len(recs), err)
+	}
+}
 
+// redeliver retries parked events, stopping at the first failure
+func (p *Producer) redeliver() {
+	if p.outbox.Len() == 0 {
+		return
+	}
+	sent, err := p.outbox.Drain(p.send)
+	if sent > 0 {
+		log.Printf("KAFKA: Delivered %d parked event(s)", sent)
+	}
+	if err != nil {
+		log.Printf("KAFKA: Broker still unavailable, %d event(s) parked: %v", p.outbox.Len(), err)
+	}
+}
+
+func (p *Producer) send(rec outboxRecord) error {
 	msg := &sarama.ProducerMessage{
 		Topic: p.topic,
-		Key:   sarama.StringEncoder(gameID),
-		Value: sarama.ByteEncoder(val),
+		Key:   sarama.StringEncoder(rec.Key),
+		Value: sarama.ByteEncoder(rec.Value),
 	}
-
 	_, _, err := p.producer.SendMessage(msg)
 	if err != nil {
-		log.Printf("KAFKA ERROR: Failed to send message: %v", err)
-	} else {
-		log.Printf("KAFKA: Event sent for game %s (%.2fs)", gameID, duration)
+		metrics.KafkaPublishFailures.Inc()
 	}
+	return err
 }
 
+// Ping checks that at least one broker accepts connections
+func (p *Producer) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	var err error
+	for _, addr := range p.brokers {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return err
+}
+
+// Close flushes queued events to the broker (or the outbox) and disconnects.
+// Events emitted afterwards still go to the outbox, from the sender.
 func (p *Producer) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mutex.Unlock()
+
+	<-p.done
 	p.producer.Close()
-}
\ No newline at end of file
+}
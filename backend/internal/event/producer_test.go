@@ -0,0 +1,160 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeBroker accepts messages unless it is down. While hold is set, the
+// first send waits for it to be closed.
+type fakeBroker struct {
+	sarama.SyncProducer
+
+	mutex sync.Mutex
+	down  bool
+	hold  chan struct{}
+	keys  []string
+}
+
+func (b *fakeBroker) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	b.mutex.Lock()
+	hold := b.hold
+	b.hold = nil
+	b.mutex.Unlock()
+	if hold != nil {
+		<-hold
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.down {
+		return 0, 0, errors.New("broker down")
+	}
+	key, _ := msg.Key.Encode()
+	b.keys = append(b.keys, string(key))
+	return 0, 0, nil
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+func (b *fakeBroker) setDown(down bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.down = down
+}
+
+func TestProducerKeepsOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		events int
+		down   bool // Broker rejects everything until the producer closes
+		hold   bool // First send stalls until every event was emitted
+	}{
+		{name: "broker up", events: 10},
+		{name: "queue overflow", events: queueSize + 200, hold: true},
+		{name: "parked and redelivered", events: 50, down: true},
+		{name: "overflow while down", events: queueSize + 200, down: true, hold: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, err := openOutbox(filepath.Join(t.TempDir(), "outbox.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			broker := &fakeBroker{down: tt.down}
+			hold := make(chan struct{})
+			if tt.hold {
+				broker.hold = hold
+			}
+			p := newProducer(broker, config.Kafka{Topic: "games"}, box)
+
+			var want []string
+			for i := 0; i < tt.events; i++ {
+				id := fmt.Sprintf("game-%04d", i)
+				want = append(want, id)
+				p.Emit(GameEvent{Event: EventMoveMade, GameID: id})
+			}
+			close(hold)
+			if tt.down {
+				broker.setDown(false)
+			}
+			p.Close()
+
+			if n := box.Len(); n != 0 {
+				t.Errorf("%d event(s) left in the outbox", n)
+			}
+			if len(broker.keys) != len(want) {
+				t.Fatalf("broker got %d events, want %d", len(broker.keys), len(want))
+			}
+			for i := range want {
+				if broker.keys[i] != want[i] {
+					t.Fatalf("event %d is %s, want %s", i, broker.keys[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProducerParksAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	box, err := openOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newProducer(&fakeBroker{}, config.Kafka{Topic: "games"}, box)
+	p.Close()
+
+	p.Emit(GameEvent{Event: EventGameOver, GameID: "late"})
+
+	// The sender parks it, not the caller
+	deadline := time.Now().Add(time.Second)
+	for box.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	reopened, err := openOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reopened.Len(); n != 1 {
+		t.Errorf("outbox holds %d event(s) after a late emit, want 1", n)
+	}
+}
+
+func TestProducerDropsWhenSpillFull(t *testing.T) {
+	box, err := openOutbox(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := make(chan struct{})
+	broker := &fakeBroker{hold: hold}
+	p := newProducer(broker, config.Kafka{Topic: "games"}, box)
+
+	// Stall the sender on the first event before the rest come in
+	p.Emit(GameEvent{Event: EventMoveMade, GameID: "game-00000"})
+	for len(p.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < 1+queueSize+spillSize+100; i++ {
+		p.Emit(GameEvent{Event: EventMoveMade, GameID: fmt.Sprintf("game-%05d", i)})
+	}
+	close(hold)
+	p.Close()
+
+	if n, want := len(broker.keys), 1+queueSize+spillSize; n != want {
+		t.Fatalf("broker got %d events, want the %d that fit", n, want)
+	}
+	for i, key := range broker.keys {
+		if want := fmt.Sprintf("game-%05d", i); key != want {
+			t.Fatalf("event %d is %s, want %s", i, key, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package event
+
+import "time"
+
+// SchemaVersion is bumped whenever a field of GameEvent changes meaning.
+// Version 0 events (before versioning) only ever had GAME_OVER with
+// event, gameId, winner and duration_seconds, which version 1 keeps as is.
+const SchemaVersion = 1
+
+type EventType string
+
+const (
+	EventGameStarted        EventType = "GAME_STARTED"
+	EventMoveMade           EventType = "MOVE_MADE"
+	EventTakeback           EventType = "TAKEBACK"
+	EventPlayerDisconnected EventType = "PLAYER_DISCONNECTED"
+	EventPlayerReconnected  EventType = "PLAYER_RECONNECTED"
+	EventQueueJoined        EventType = "QUEUE_JOINED"
+	EventQueueLeft          EventType = "QUEUE_LEFT"
+	EventBotAssigned        EventType = "BOT_ASSIGNED"    // Matched with the built-in bot
+	EventEngineAssigned     EventType = "ENGINE_ASSIGNED" // Matched with an external engine, named in player2
+	EventGameOver           EventType = "GAME_OVER"
+)
+
+// EventTypes lists every event the server emits
+var EventTypes = []EventType{
+	EventQueueJoined, EventQueueLeft, EventBotAssigned, EventEngineAssigned, EventGameStarted,
+	EventMoveMade, EventTakeback, EventPlayerDisconnected, EventPlayerReconnected, EventGameOver,
+}
+
+// GameEvent is the envelope for everything published to the analytics
+// topic. Game events carry the full board after the change, so a consumer
+// can rebuild any game from its MOVE_MADE and TAKEBACK events or pick up
+// mid-stream.
+type GameEvent struct {
+	Version   int       `json:"version"`
+	Event     EventType `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Instance  string    `json:"instance,omitempty"`
+
+	// Who the event is about (queue and connection events)
+	Player string `json:"player,omitempty"`
+
+	// Game Identity
+	GameID  string `json:"gameId,omitempty"`
+	Player1 string `json:"player1,omitempty"`
+	Player2 string `json:"player2,omitempty"`
+	BotGame bool   `json:"botGame,omitempty"`
+	// Who moved first; Player1 in events from before series
+	FirstPlayer string `json:"firstPlayer,omitempty"`
+	// Best-of-N series the game belongs to, and its 1-based position in it
+	SeriesID   string `json:"seriesId,omitempty"`
+	SeriesGame int    `json:"seriesGame,omitempty"`
+
+	// Game State after the event
+	Board *[6][7]int `json:"board,omitempty"`
+	Turn  int        `json:"turn,omitempty"`
+	Moves int        `json:"moves,omitempty"`
+	Move  *Move      `json:"move,omitempty"`
+
+	// Outcome
+	Winner   string  `json:"winner,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"` // Game length, or time spent queued
+}
+
+// Move describes the disc dropped in a MOVE_MADE event
+type Move struct {
+	Number int    `json:"number"` // 1-based ply
+	Player string `json:"player"`
+	Symbol int    `json:"symbol"`
+	Column int    `json:"column"`
+	Row    int    `json:"row"`
+}
+
+// Key groups events in the same partition: per game where there is one,
+// otherwise per player.
+func (e GameEvent) Key() string {
+	if e.GameID != "" {
+		return e.GameID
+	}
+	return e.Player
+}
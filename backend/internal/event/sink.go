@@ -0,0 +1,123 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventSink receives game lifecycle events. Emit must never block gameplay;
+// Close flushes whatever is still buffered.
+type EventSink interface {
+	Emit(e GameEvent)
+	Close()
+}
+
+// Pinger is implemented by sinks with a remote end worth health checking
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Stamp fills in the schema version and time of an event about to be sent
+func Stamp(e *GameEvent) {
+	e.Version = SchemaVersion
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+}
+
+// Fanout sends every event to all of the given sinks
+func Fanout(sinks ...EventSink) EventSink {
+	return fanout(sinks)
+}
+
+type fanout []EventSink
+
+func (f fanout) Emit(e GameEvent) {
+	for _, s := range f {
+		s.Emit(e)
+	}
+}
+
+func (f fanout) Close() {
+	for _, s := range f {
+		s.Close()
+	}
+}
+
+// Ping checks every member that can be checked
+func (f fanout) Ping(ctx context.Context) error {
+	var errs []error
+	for _, s := range f {
+		if p, ok := s.(Pinger); ok {
+			if err := p.Ping(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// worker hands events to a slow deliver function on a single goroutine.
+// Events are dropped (and logged) if the buffer is full.
+type worker struct {
+	name    string
+	deliver func(GameEvent) error
+	queue   chan GameEvent
+	done    chan struct{}
+
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+func newWorker(name string, deliver func(GameEvent) error) *worker {
+	w := &worker{
+		name:    name,
+		deliver: deliver,
+		queue:   make(chan GameEvent, queueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *worker) Emit(e GameEvent) {
+	Stamp(&e)
+
+	w.closeMutex.RLock()
+	defer w.closeMutex.RUnlock()
+
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- e:
+	default:
+		log.Printf("%s ERROR: Buffer full, dropping %s event", w.name, e.Event)
+	}
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+	for e := range w.queue {
+		if err := w.deliver(e); err != nil {
+			log.Printf("%s ERROR: Could not deliver %s event: %v", w.name, e.Event, err)
+		}
+	}
+}
+
+// Close delivers everything still queued
+func (w *worker) Close() {
+	w.closeMutex.Lock()
+	if w.closed {
+		w.closeMutex.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.queue)
+	w.closeMutex.Unlock()
+
+	<-w.done
+}
@@ -0,0 +1,77 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// gameIDs lists the game of every event, in order
+func gameIDs(events []GameEvent) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.GameID
+	}
+	return ids
+}
+
+// pingSink is a sink with a remote end that may be down
+type pingSink struct {
+	*MemorySink
+	err error
+}
+
+func (p pingSink) Ping(context.Context) error { return p.err }
+
+func TestFanout(t *testing.T) {
+	a, b := NewMemorySink(), NewMemorySink()
+	sink := Fanout(a, b)
+	for _, id := range []string{"g1", "g2", "g3"} {
+		sink.Emit(GameEvent{Event: EventMoveMade, GameID: id})
+	}
+	sink.Close()
+
+	for name, m := range map[string]*MemorySink{"first": a, "second": b} {
+		events := m.Events()
+		if got := fmt.Sprint(gameIDs(events)); got != "[g1 g2 g3]" {
+			t.Errorf("%s sink got %s, want [g1 g2 g3]", name, got)
+		}
+		for _, e := range events {
+			if e.Version != SchemaVersion || e.Timestamp.IsZero() {
+				t.Errorf("%s sink got an unstamped event: %+v", name, e)
+			}
+		}
+	}
+
+	down := errors.New("down")
+	pinged := Fanout(NewMemorySink(), pingSink{NewMemorySink(), nil}, pingSink{NewMemorySink(), down})
+	if err := pinged.(Pinger).Ping(context.Background()); !errors.Is(err, down) {
+		t.Errorf("Ping = %v, want the failing member's error", err)
+	}
+}
+
+func TestWorkerDeliversInOrder(t *testing.T) {
+	delivered := NewMemorySink()
+	w := newWorker("TEST", func(e GameEvent) error {
+		delivered.Emit(e)
+		if e.GameID == "game-0002" {
+			return errors.New("rejected") // Logged, and the next one still goes
+		}
+		return nil
+	})
+
+	var want []string
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("game-%04d", i)
+		want = append(want, id)
+		w.Emit(GameEvent{Event: EventMoveMade, GameID: id})
+	}
+	w.Close()
+	w.Emit(GameEvent{Event: EventMoveMade, GameID: "late"})
+	w.Close()
+
+	if got := gameIDs(delivered.Events()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("delivered %d event(s) %v, want %d in emit order", len(got), got, len(want))
+	}
+}
@@ -0,0 +1,63 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"connectfour/internal/config"
+)
+
+// WebhookSink POSTs every event as JSON to a single URL, retrying a few
+// times with backoff before giving up on it.
+type WebhookSink struct {
+	*worker
+	cfg    config.Webhook
+	client *http.Client
+}
+
+func NewWebhookSink(cfg config.Webhook) *WebhookSink {
+	s := &WebhookSink{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+	s.worker = newWorker("EVENT WEBHOOK", s.post)
+	return s
+}
+
+func (s *WebhookSink) post(e GameEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err = s.send(body)
+		if err == nil || attempt > s.cfg.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *WebhookSink) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
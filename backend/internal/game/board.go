@@ -27,6 +27,34 @@ func (b *Board) DropDisc(col int, player int) int {
 	return -1
 }
 
+// RemoveDisc takes the top disc out of a column, undoing DropDisc.
+// Returns the row it was in, or -1 if the column is empty.
+func (b *Board) RemoveDisc(col int) int {
+	if col < 0 || col >= Cols {
+		return -1
+	}
+	for r := 0; r < Rows; r++ {
+		if b[r][col] != 0 {
+			b[r][col] = 0
+			return r
+		}
+	}
+	return -1
+}
+
+// DiscCount returns how many discs have been played
+func (b *Board) DiscCount() int {
+	count := 0
+	for r := 0; r < Rows; r++ {
+		for c := 0; c < Cols; c++ {
+			if b[r][c] != 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
 // IsFull checks if the board is a draw
 func (b *Board) IsFull() bool {
 	for c := 0; c < Cols; c++ {
@@ -3,18 +3,28 @@ package game
 import (
 	"math/rand"
 	"time"
+
+	"connectfour/internal/config"
 )
 
+// Engine picks moves for a computer player. Bot is the built-in one.
+type Engine interface {
+	// GetMove returns the column to play on b, or -1 if there is none
+	GetMove(b *Board) int
+}
+
 // Bot logic for single player mode
 type Bot struct {
-	Symbol int
-	Name   string
+	Symbol     int
+	Name       string
+	Randomness float64 // Chance of passing over a preferred column
 }
 
-func NewBot(symbol int) *Bot {
+func NewBot(symbol int, cfg config.Bot) *Bot {
 	return &Bot{
-		Symbol: symbol,
-		Name:   "AI_Bot_v1",
+		Symbol:     symbol,
+		Name:       cfg.Name,
+		Randomness: cfg.Randomness,
 	}
 }
 
@@ -41,7 +51,7 @@ func (bot *Bot) GetMove(b *Board) int {
 	for _, col := range priorities {
 		if canPlay(b, col) {
 			// Add a little randomness so it's not identical every time
-			if rand.Intn(10) > 1 { 
+			if rand.Float64() >= bot.Randomness {
 				return col
 			}
 		}
@@ -0,0 +1,270 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"connectfour/internal/cluster"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrNotPlaying   = errors.New("you are not in a game")
+	ErrGameNotFound = errors.New("game not found")
+)
+
+// HandleChat relays a CHAT line or an EMOTE from a player to their opponent
+// and the game's spectators. The sender gets it back as delivered.
+func (h *Hub) HandleChat(conn *websocket.Conn, kind models.MessageType, text string) error {
+	h.mutex.Lock()
+	g, p := h.playerFor(conn)
+	seat := h.seats[conn]
+	h.mutex.Unlock()
+
+	if seat != nil {
+		msg := models.WSMessage{Type: kind, Payload: models.ChatPayload{Text: text}}
+		if kind == models.MsgEmote {
+			msg.Payload = models.EmotePayload{Emote: text}
+		}
+		payload, _ := json.Marshal(msg)
+		h.node.Send(seat.host, cluster.Message{Kind: cluster.KindChat, GameID: seat.gameID, Symbol: seat.symbol, Payload: payload})
+		return nil
+	}
+	if g == nil {
+		return ErrNotPlaying
+	}
+	return h.say(g, p, kind, text)
+}
+
+// say checks and delivers a message from p, wherever they are connected
+func (h *Hub) say(g *Game, p *Player, kind models.MessageType, text string) error {
+	msg := models.WSMessage{Type: kind}
+	switch kind {
+	case models.MsgChat:
+		clean, err := h.chat.Check(p.Username, text)
+		if err != nil {
+			return err
+		}
+		msg.Payload = models.ChatPayload{From: p.Username, Text: clean}
+		h.chat.Log(g.ID, p.Username, "chat", clean, text)
+	case models.MsgEmote:
+		if err := h.chat.CheckEmote(p.Username, text); err != nil {
+			return err
+		}
+		msg.Payload = models.EmotePayload{From: p.Username, Emote: text}
+		h.chat.Log(g.ID, p.Username, "emote", text, text)
+	default:
+		return fmt.Errorf("%s is not a chat message", kind)
+	}
+
+	// Remote opponents are filtered by their own instance on delivery
+	opponent := g.Player1
+	if opponent == p { opponent = g.Player2 }
+	hide := opponent.Remote == "" && !opponent.IsBot && h.chat.Hidden(opponent.Username, p.Username)
+	g.relayChat(p, msg, hide)
+	return nil
+}
+
+// handleRemoteChat takes a chat message from a player connected elsewhere
+func (h *Hub) handleRemoteChat(m cluster.Message) {
+	h.mutex.Lock()
+	g := h.gameByID(m.GameID)
+	h.mutex.Unlock()
+	if g == nil {
+		return
+	}
+	p := g.Player1
+	if m.Symbol == 2 { p = g.Player2 }
+	if p.Remote != m.From {
+		return
+	}
+
+	var msg struct {
+		Type    models.MessageType `json:"type"`
+		Payload struct {
+			Text  string `json:"text"`
+			Emote string `json:"emote"`
+		} `json:"payload"`
+	}
+	if json.Unmarshal(m.Payload, &msg) != nil {
+		return
+	}
+	text := msg.Payload.Text
+	if msg.Type == models.MsgEmote { text = msg.Payload.Emote }
+	if err := h.say(g, p, msg.Type, text); err != nil {
+		g.tell(p, models.MsgError, models.ErrorPayload{Message: err.Error()})
+	}
+}
+
+// HandleMute mutes (or unmutes) another player's chat for the sender,
+// until the server restarts
+func (h *Hub) HandleMute(conn *websocket.Conn, target string, on bool) error {
+	username := h.usernameOf(conn)
+	if username == "" {
+		return ErrNotPlaying
+	}
+	return h.chat.Mute(username, target, on)
+}
+
+// HandleBlock is HandleMute, but kept for good
+func (h *Hub) HandleBlock(conn *websocket.Conn, target string, on bool) error {
+	username := h.usernameOf(conn)
+	if username == "" {
+		return ErrNotPlaying
+	}
+	return h.chat.Block(username, target, on)
+}
+
+// Spectate subscribes a socket to a game hosted here, picked by ID or by one
+// of its players. Spectators get the board, UPDATE, GAME_OVER and chat, and
+// follow a series from game to game.
+func (h *Hub) Spectate(conn *websocket.Conn, gameID, username string) error {
+	h.mutex.Lock()
+	g := h.games[gameID]
+	for _, game := range h.games {
+		if g == nil && username != "" && (game.Player1.Username == username || game.Player2.Username == username) {
+			g = game
+		}
+	}
+	if g == nil {
+		h.mutex.Unlock()
+		return ErrGameNotFound
+	}
+	if old := h.spectating[conn]; old != nil {
+		old.removeSpectator(conn)
+	}
+	h.spectating[conn] = g
+	h.mutex.Unlock()
+
+	g.addSpectator(conn)
+	return nil
+}
+
+// playerFor finds the game and seat of a local player.
+// Must be called with h.mutex held.
+func (h *Hub) playerFor(conn *websocket.Conn) (*Game, *Player) {
+	g := h.playerGameMap[conn]
+	if g == nil {
+		return nil, nil
+	}
+	if g.Player1.Conn == conn {
+		return g, g.Player1
+	}
+	if g.Player2.Conn == conn {
+		return g, g.Player2
+	}
+	return nil, nil
+}
+
+// usernameOf returns who is behind a socket, if they are playing, queued
+// or deciding on a rematch
+func (h *Hub) usernameOf(conn *websocket.Conn) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, p := h.playerFor(conn); p != nil {
+		return p.Username
+	}
+	if seat := h.seats[conn]; seat != nil {
+		return seat.username
+	}
+	if r := h.rematches[conn]; r != nil {
+		me, _ := r.opponent(conn)
+		return me.Username
+	}
+	for _, wp := range h.waiting {
+		if wp.Player.Conn == conn {
+			return wp.Player.Username
+		}
+	}
+	return ""
+}
+
+// gameByID finds a running game, or the last game of a series waiting for
+// its next one. Must be called with h.mutex held.
+func (h *Hub) gameByID(id string) *Game {
+	if g, ok := h.games[id]; ok {
+		return g
+	}
+	for _, s := range h.series {
+		if s.between && s.current.ID == id {
+			return s.current
+		}
+	}
+	return nil
+}
+
+// relayChat sends a message from p to both players and the spectators.
+// hideFromOpponent is set when the opponent muted or blocked p.
+func (g *Game) relayChat(p *Player, msg models.WSMessage, hideFromOpponent bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, to := range []*Player{g.Player1, g.Player2} {
+		if to != p && hideFromOpponent {
+			continue
+		}
+		g.sendTo(to, msg.Type, msg.Payload)
+	}
+	g.toSpectators(msg.Type, msg.Payload)
+}
+
+// tell sends a message to one player
+func (g *Game) tell(p *Player, msgType models.MessageType, data interface{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.sendTo(p, msgType, data)
+}
+
+// addSpectator starts sending the game to conn, beginning with its state
+func (g *Game) addSpectator(conn *websocket.Conn) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.specMutex.Lock()
+	g.spectators[conn] = true
+	g.specMutex.Unlock()
+
+	WriteJSON(conn, models.WSMessage{Type: models.MsgSpectate, Payload: g.spectateState()})
+}
+
+func (g *Game) removeSpectator(conn *websocket.Conn) {
+	g.specMutex.Lock()
+	defer g.specMutex.Unlock()
+	delete(g.spectators, conn)
+}
+
+// takeSpectators removes and returns every spectator, to move them to the
+// next game of a series
+func (g *Game) takeSpectators() map[*websocket.Conn]bool {
+	g.specMutex.Lock()
+	defer g.specMutex.Unlock()
+	spectators := g.spectators
+	g.spectators = make(map[*websocket.Conn]bool)
+	return spectators
+}
+
+// toSpectators must be called with the game locked
+func (g *Game) toSpectators(msgType models.MessageType, data interface{}) {
+	g.specMutex.Lock()
+	defer g.specMutex.Unlock()
+	for conn := range g.spectators {
+		WriteJSON(conn, models.WSMessage{Type: msgType, Payload: data})
+	}
+}
+
+// spectateState must be called with the game locked
+func (g *Game) spectateState() models.SpectatePayload {
+	board := [6][7]int(*g.Board)
+	return models.SpectatePayload{
+		GameID:  g.ID,
+		Player1: g.Player1.Username,
+		Player2: g.Player2.Username,
+		Board:   &board,
+		Turn:    g.Turn,
+		Series:  g.seriesScore(),
+	}
+}
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"time"
+
+	"connectfour/internal/db"
+)
+
+// checkpoint queues a running game to be saved so it survives a restart.
+// Checkpoints are written in the background and coalesced: a game that
+// changes again before its write starts is written once, as it is by then.
+// Safe to call with any lock held.
+func (h *Hub) checkpoint(g *Game) {
+	h.queueCheckpoint(g, false)
+}
+
+// dropCheckpoint queues the removal of a finished game's checkpoint, behind
+// any write of it that is still queued
+func (h *Hub) dropCheckpoint(g *Game) {
+	h.queueCheckpoint(g, true)
+}
+
+// saveSeries queues a series to be saved along with the checkpoints. It is
+// written as it stands by then. Safe to call with any lock held.
+func (h *Hub) saveSeries(s *Series) {
+	if h.repo == nil {
+		return
+	}
+	h.ckMutex.Lock()
+	h.ckSeries[s] = true
+	h.ckMutex.Unlock()
+	h.wakeWriter()
+}
+
+func (h *Hub) queueCheckpoint(g *Game, drop bool) {
+	if h.repo == nil {
+		return
+	}
+	h.ckMutex.Lock()
+	h.ckPending[g] = drop || h.ckPending[g]
+	h.ckMutex.Unlock()
+	h.wakeWriter()
+}
+
+func (h *Hub) wakeWriter() {
+	select {
+	case h.ckWake <- struct{}{}:
+	default: // A write is already due
+	}
+}
+
+// checkpointLoop writes queued checkpoints as they come in
+func (h *Hub) checkpointLoop() {
+	for range h.ckWake {
+		h.writeCheckpoints()
+	}
+}
+
+// writeCheckpoints writes everything queued so far. Batches are written one
+// at a time, so a game's writes reach the store in the order they were queued.
+func (h *Hub) writeCheckpoints() {
+	h.ckWriting.Lock()
+	defer h.ckWriting.Unlock()
+
+	h.ckMutex.Lock()
+	batch, series := h.ckPending, h.ckSeries
+	h.ckPending = make(map[*Game]bool)
+	h.ckSeries = make(map[*Series]bool)
+	h.ckMutex.Unlock()
+
+	// A checkpoint names its series, so the series goes first
+	for s := range series {
+		h.repo.SaveSeries(s.row())
+	}
+	for g, drop := range batch {
+		if drop {
+			h.repo.DeleteActiveGame(g.ID)
+			continue
+		}
+		if saved, ok := h.snapshot(g); ok {
+			h.repo.SaveActiveGame(saved)
+		}
+	}
+}
+
+// snapshot reads the checkpoint of a game as it stands. Finished games have
+// nothing left to save.
+func (h *Hub) snapshot(g *Game) (db.ActiveGame, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if g.Status == "finished" {
+		return db.ActiveGame{}, false
+	}
+	return db.ActiveGame{
+		ID:        g.ID,
+		Player1:   g.Player1.Username,
+		Player2:   g.Player2.Username,
+		BotGame:   g.Player2.IsBot,
+		Engine1:   g.Player1.Engine,
+		Engine2:   g.Player2.Engine,
+		Board:     *g.Board,
+		Turn:      g.Turn,
+		StartedAt: g.StartTime,
+		Host:      h.instanceID(),
+		SeriesID:  g.Series.ID,
+		FirstTurn: g.First,
+		Grace1:    g.grace(1),
+		Grace2:    g.grace(2),
+	}, true
+}
+
+// grace is the time an absent player has left to come back, or -1 while
+// they are connected. Must be called with h.mutex held.
+func (g *Game) grace(symbol int) time.Duration {
+	if g.deadlines[symbol].IsZero() {
+		return -1
+	}
+	return max(0, time.Until(g.deadlines[symbol]))
+}
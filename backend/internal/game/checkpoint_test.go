@@ -0,0 +1,102 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/db"
+	"connectfour/pkg/models"
+)
+
+// checkpointed plays one move of a game between alice and bob and returns
+// its checkpoint, as the background writer would save it
+func checkpointed(t *testing.T) db.ActiveGame {
+	t.Helper()
+	h, _ := testHub(t, config.Game{})
+	conn1, client1 := pipe(t)
+	conn2, client2 := pipe(t)
+	id, err := h.StartMatch(conn1, "alice", conn2, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var start models.GameStartPayload
+	expect(t, client1, models.MsgGameStart, &start)
+	mover := conn1
+	if !start.IsTurn {
+		mover = conn2
+	}
+	h.HandleMove(mover, 3)
+	expect(t, client2, models.MsgUpdate, nil)
+
+	h.mutex.Lock()
+	g := h.games[id]
+	h.mutex.Unlock()
+	saved, ok := h.snapshot(g)
+	if !ok {
+		t.Fatal("running game has no checkpoint")
+	}
+	saved.SeriesID = "" // Nothing to load it from without a store
+	return saved
+}
+
+// restored installs a checkpoint on a fresh hub, as a restart would
+func restored(t *testing.T, cfg config.Game, saved db.ActiveGame) (*Hub, *Game) {
+	t.Helper()
+	h, _ := testHub(t, cfg)
+	g := h.restoreGame(saved)
+	h.mutex.Lock()
+	h.installGame(g, saved)
+	h.mutex.Unlock()
+	return h, g
+}
+
+func TestRestoredGameResumesOnceBothRejoin(t *testing.T) {
+	saved := checkpointed(t)
+	if board := Board(saved.Board); board.DiscCount() != 1 || saved.Grace1 != -1 || saved.Grace2 != -1 {
+		t.Fatalf("checkpoint = %+v, want one disc and both players connected", saved)
+	}
+	h, g := restored(t, config.Game{ResumeWindow: time.Minute}, saved)
+
+	conn1, client1 := pipe(t)
+	h.AddPlayer(conn1, "alice", QueueOptions{})
+	var start models.GameStartPayload
+	expect(t, client1, models.MsgGameStart, &start)
+	if start.GameID != saved.ID || start.Opponent != "bob" {
+		t.Errorf("rejoined %s against %s, want %s against bob", start.GameID, start.Opponent, saved.ID)
+	}
+	var update models.GameUpdatePayload
+	expect(t, client1, models.MsgUpdate, &update)
+	if update.Board != saved.Board {
+		t.Error("rejoined to a different board")
+	}
+	g.mutex.Lock()
+	status := g.Status
+	g.mutex.Unlock()
+	if status != "resuming" {
+		t.Fatalf("status with one player back = %q, want resuming", status)
+	}
+
+	conn2, client2 := pipe(t)
+	h.AddPlayer(conn2, "bob", QueueOptions{})
+	expect(t, client2, models.MsgGameStart, nil)
+	g.mutex.Lock()
+	status, turn := g.Status, g.Turn
+	g.mutex.Unlock()
+	if status != "playing" || turn != saved.Turn {
+		t.Errorf("status %q with turn %d, want playing with turn %d", status, turn, saved.Turn)
+	}
+}
+
+func TestRestoredGameForfeitsAbsentPlayer(t *testing.T) {
+	saved := checkpointed(t)
+	h, _ := restored(t, config.Game{ResumeWindow: 100 * time.Millisecond}, saved)
+
+	conn, client := pipe(t)
+	h.AddPlayer(conn, "bob", QueueOptions{})
+	var over models.GameOverPayload
+	expect(t, client, models.MsgGameOver, &over)
+	if over.Winner != "bob" || over.Reason != "forfeit" {
+		t.Errorf("game ended %q by %q, want bob by forfeit", over.Winner, over.Reason)
+	}
+}
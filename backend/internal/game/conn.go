@@ -0,0 +1,53 @@
+package game
+
+import (
+	"sync"
+
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// A gorilla connection allows only one writer at a time, and games, the hub
+// and other subsystems all write to the same sockets. Every write goes
+// through here, serialized per connection.
+var writeLocks sync.Map // *websocket.Conn -> *sync.Mutex
+
+func writeLock(conn *websocket.Conn) *sync.Mutex {
+	mu, _ := writeLocks.LoadOrStore(conn, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// WriteJSON sends v on conn. Safe to call from any goroutine.
+func WriteJSON(conn *websocket.Conn, v interface{}) error {
+	mu := writeLock(conn)
+	mu.Lock()
+	defer mu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+func writeRaw(conn *websocket.Conn, data []byte) error {
+	mu := writeLock(conn)
+	mu.Lock()
+	defer mu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// outgoing is a message put together under the hub lock and written once
+// the lock is released, so a slow socket holds up nobody else
+type outgoing struct {
+	conn *websocket.Conn
+	msg  models.WSMessage
+}
+
+// send writes collected messages. Must be called without h.mutex held.
+func send(out []outgoing) {
+	for _, o := range out {
+		WriteJSON(o.conn, o.msg)
+	}
+}
+
+// forgetConn drops the write lock of a closed connection
+func forgetConn(conn *websocket.Conn) {
+	writeLocks.Delete(conn)
+}
@@ -0,0 +1,92 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/event"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// received is a message read back by a test client
+type received struct {
+	Type    models.MessageType `json:"type"`
+	Payload json.RawMessage    `json:"payload"`
+}
+
+// pipe opens a websocket through a test server. The hub gets server; the
+// test reads what was sent to it from client.
+func pipe(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+// expect reads from a test client until a message of type want arrives,
+// and decodes its payload into v if v isn't nil
+func expect(t *testing.T, client *websocket.Conn, want models.MessageType, v interface{}) {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg received
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatalf("no %s: %v", want, err)
+		}
+		if msg.Type != want {
+			continue
+		}
+		if v != nil {
+			if err := json.Unmarshal(msg.Payload, v); err != nil {
+				t.Fatalf("bad %s payload: %v", want, err)
+			}
+		}
+		return
+	}
+}
+
+// testHub runs a single instance hub without a store. Its events are kept
+// in the returned sink.
+func testHub(t *testing.T, cfg config.Game) (*Hub, *event.MemorySink) {
+	t.Helper()
+	if cfg.BestOf == 0 {
+		cfg.BestOf = 1
+	}
+	if cfg.ForfeitAfter == 0 {
+		cfg.ForfeitAfter = time.Minute
+	}
+	if cfg.BotFallbackAfter == 0 {
+		cfg.BotFallbackAfter = time.Hour
+	}
+	if cfg.Bot.Name == "" {
+		cfg.Bot.Name = "Bot"
+	}
+	sink := event.NewMemorySink()
+	return NewHub(cfg, nil, sink, nil), sink
+}
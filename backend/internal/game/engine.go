@@ -0,0 +1,119 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EnginePrefix starts the username of every external engine, so engines
+// are rated on their own and no player can pass for one
+const EnginePrefix = "engine:"
+
+var ErrReservedName = errors.New(`usernames starting with "engine:" are reserved for engines`)
+
+// engine is an external engine connected to this instance. It is offered
+// to waiting players whenever it isn't playing.
+type engine struct {
+	username  string
+	idleSince time.Time
+}
+
+// IsEngine reports whether username belongs to an external engine
+func IsEngine(username string) bool {
+	return strings.HasPrefix(username, EnginePrefix)
+}
+
+// AddEngine makes an authenticated engine connection available as an
+// opponent for players who waited BotFallbackAfter. One connection plays
+// one game at a time; an engine can open several.
+func (h *Hub) AddEngine(conn *websocket.Conn, name string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.draining {
+		return ErrDraining
+	}
+	h.engines[conn] = &engine{username: EnginePrefix + name, idleSince: time.Now()}
+	fmt.Printf("🤖 Engine %s connected\n", name)
+	return nil
+}
+
+// EnginesConnected counts connections per engine name
+func (h *Hub) EnginesConnected() map[string]int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	counts := map[string]int{}
+	for _, e := range h.engines {
+		counts[strings.TrimPrefix(e.username, EnginePrefix)]++
+	}
+	return counts
+}
+
+// takeEngine seats the engine that has been idle the longest, if any.
+// Must be called with h.mutex held.
+func (h *Hub) takeEngine() *Player {
+	var conn *websocket.Conn
+	var idlest *engine
+	for c, e := range h.engines {
+		if _, busy := h.playerGameMap[c]; busy {
+			continue
+		}
+		if idlest == nil || e.idleSince.Before(idlest.idleSince) {
+			conn, idlest = c, e
+		}
+	}
+	if idlest == nil {
+		return nil
+	}
+	return &Player{Conn: conn, Username: idlest.username, Engine: true}
+}
+
+// releaseEngines puts the engines of a finished series back in line.
+// Must be called with h.mutex held.
+func (h *Hub) releaseEngines(g *Game) {
+	for _, p := range []*Player{g.Player1, g.Player2} {
+		if e := h.engines[p.Conn]; p.Engine && e != nil {
+			e.idleSince = time.Now()
+		}
+	}
+}
+
+// moveTime is the time per move, in milliseconds, announced to p if it is
+// an engine
+func (g *Game) moveTime(p *Player) int {
+	if !p.Engine {
+		return 0
+	}
+	return int(g.cfg.Engine.MoveTime.Milliseconds())
+}
+
+// startMoveClock stops the running move clock and, if an engine is to move,
+// starts a new one. An engine that runs out of time loses the game.
+// Must be called with the game locked.
+func (g *Game) startMoveClock() {
+	if g.moveClock != nil {
+		g.moveClock.Stop()
+		g.moveClock = nil
+	}
+	p := g.player(g.Turn)
+	if !p.Engine || g.Status != "playing" {
+		return
+	}
+
+	moves, takebacks := g.MoveCount, g.takebacks
+	g.moveClock = time.AfterFunc(g.cfg.Engine.MoveTime, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if g.Status != "playing" || g.MoveCount != moves || g.takebacks != takebacks {
+			return // It moved just in time
+		}
+		fmt.Printf("⏰ %s ran out of time in game %s\n", p.Username, g.ID)
+		g.Status = "finished"
+		g.endGame(g.player(3-p.Symbol).Username, "timeout")
+	})
+}
@@ -0,0 +1,69 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// engineGame seats alice, on conn, against a connected engine. She moves
+// first.
+func engineGame(t *testing.T, h *Hub, conn *websocket.Conn) (engine *Player) {
+	t.Helper()
+	engineConn, _ := pipe(t)
+	if err := h.AddEngine(engineConn, "deep"); err != nil {
+		t.Fatal(err)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	engine = h.takeEngine()
+	if engine == nil {
+		t.Fatal("no engine to take")
+	}
+	s := newSeries(&Player{Conn: conn, Username: "alice"}, engine, 1, true)
+	s.first = 1
+	h.startSeries(s)
+	return engine
+}
+
+func TestEngineLosesOnTime(t *testing.T) {
+	h, _ := testHub(t, config.Game{Engine: config.Engine{MoveTime: 50 * time.Millisecond}})
+	conn, client := pipe(t)
+	engineGame(t, h, conn)
+
+	var start models.GameStartPayload
+	expect(t, client, models.MsgGameStart, &start)
+	if !start.IsTurn {
+		t.Fatal("player doesn't move first")
+	}
+	h.HandleMove(conn, 3)
+
+	var over models.GameOverPayload
+	expect(t, client, models.MsgGameOver, &over)
+	if over.Winner != "alice" || over.Reason != "timeout" {
+		t.Errorf("game ended %q by %q, want alice by timeout", over.Winner, over.Reason)
+	}
+}
+
+func TestEngineForfeitsWhenItDisconnects(t *testing.T) {
+	h, _ := testHub(t, config.Game{Engine: config.Engine{MoveTime: time.Minute}})
+	conn, client := pipe(t)
+	engine := engineGame(t, h, conn)
+	expect(t, client, models.MsgGameStart, nil)
+
+	h.HandleDisconnect(engine.Conn)
+
+	var over models.GameOverPayload
+	expect(t, client, models.MsgGameOver, &over)
+	if over.Winner != "alice" || over.Reason != "forfeit" {
+		t.Errorf("game ended %q by %q, want alice by forfeit", over.Winner, over.Reason)
+	}
+	if n := h.EnginesConnected()["deep"]; n != 0 {
+		t.Errorf("%d connection(s) of the engine left after it went away", n)
+	}
+}
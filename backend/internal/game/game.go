@@ -1,6 +1,8 @@
 package game
 
 import (
+	"connectfour/internal/config"
+	"connectfour/internal/metrics"
 	"connectfour/pkg/models"
 	"sync"
 	"time"
@@ -13,6 +15,13 @@ type Player struct {
 	Username string
 	Symbol   int // 1 or 2
 	IsBot    bool
+	Engine   bool   // External engine: moves against a clock and forfeits when it drops
+	Remote   string // Instance the player is connected to, if not this one
+}
+
+// connected reports whether the player has a socket here or on another instance
+func (p *Player) connected() bool {
+	return p.Conn != nil || p.Remote != ""
 }
 
 type Game struct {
@@ -21,32 +30,73 @@ type Game struct {
 	Player1   *Player
 	Player2   *Player
 	Turn      int // 1 or 2
-	Status    string // "playing", "finished"
+	First     int // Symbol that moved first
+	Status    string // "playing", "resuming", "suspended", "finished"
+	MoveCount int
 	CreatedAt time.Time
 	StartTime time.Time // <--- New Field to track actual start
 
-	// Reconnection Timers
-	P1Timer *time.Timer
-	P2Timer *time.Timer
+	// Series the game belongs to, and its 1-based position in it
+	Series *Series
+	Number int
+	// Rated games count towards ratings. Only casual games allow takebacks.
+	Rated bool
+
+	// Symbol with a draw offer on the table, 0 if none, and the move count
+	// at each player's last offer (plus one), so they can offer once a move
+	drawOffer   int
+	drawOffered [3]int
+
+	// Columns played this session, most recent last, and the same request
+	// bookkeeping for takebacks. Moves from before a restart can't be
+	// taken back.
+	moves         []int
+	takeback      int
+	takebackAsked [3]int
+	takebacks     int // Takebacks granted, so a stale bot move can tell
+
+	// Reconnection Timers, and when each absent player forfeits (zero while
+	// connected). Guarded by the hub's mutex.
+	P1Timer   *time.Timer
+	P2Timer   *time.Timer
+	deadlines [3]time.Time
+	// Runs while an engine is to move
+	moveClock *time.Timer
 
 	broadcast chan models.WSMessage
 	mutex     sync.Mutex
+	cfg       config.Game
+
+	// Sockets watching the game. Guarded by specMutex, which may be taken
+	// with or without the game lock but never the other way round.
+	spectators map[*websocket.Conn]bool
+	specMutex  sync.Mutex
 	
 	// Callback updated to include duration
 	OnGameOver func(game *Game, winner string, reason string, duration float64)
+	// Called with the game locked after every move, once Turn and Status
+	// reflect it and before any GAME_OVER
+	OnMove func(game *Game, symbol, col, row int)
+	// Called with the game locked after moves were taken back
+	OnTakeback func(game *Game)
+	// Sends a message to a player connected to another instance
+	Deliver func(game *Game, p *Player, msg models.WSMessage)
 }
 
-func NewGame(id string, p1, p2 *Player, onGameOver func(*Game, string, string, float64)) *Game {
+func NewGame(id string, p1, p2 *Player, cfg config.Game, onGameOver func(*Game, string, string, float64)) *Game {
 	g := &Game{
 		ID:         id,
 		Board:      NewBoard(),
 		Player1:    p1,
 		Player2:    p2,
 		Turn:       1,
+		First:      1,
 		Status:     "playing",
 		CreatedAt:  time.Now(),
 		StartTime:  time.Now(), // Initialize
 		broadcast:  make(chan models.WSMessage),
+		cfg:        cfg,
+		spectators: make(map[*websocket.Conn]bool),
 		OnGameOver: onGameOver,
 	}
 	p1.Symbol = 1
@@ -54,24 +104,50 @@ func NewGame(id string, p1, p2 *Player, onGameOver func(*Game, string, string, f
 	return g
 }
 
+// startWith sets who moves first. Must be called before the game starts.
+func (g *Game) startWith(symbol int) {
+	g.First = symbol
+	g.Turn = symbol
+}
+
 func (g *Game) Start() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// Forfeited before it started, e.g. by an engine that had gone away
+	if g.Status != "playing" { return }
 	g.StartTime = time.Now() // Reset start time when game actually begins
+	series := g.seriesScore()
 	
 	g.sendTo(g.Player1, models.MsgGameStart, models.GameStartPayload{
-		GameID: g.ID, Opponent: g.Player2.Username, Symbol: 1, IsTurn: true,
+		GameID: g.ID, Opponent: g.Player2.Username, Symbol: 1, IsTurn: g.Turn == 1, Rated: g.Rated, Series: series, MoveTime: g.moveTime(g.Player1),
 	})
 	
 	if !g.Player2.IsBot {
 		g.sendTo(g.Player2, models.MsgGameStart, models.GameStartPayload{
-			GameID: g.ID, Opponent: g.Player1.Username, Symbol: 2, IsTurn: false,
+			GameID: g.ID, Opponent: g.Player1.Username, Symbol: 2, IsTurn: g.Turn == 2, Rated: g.Rated, Series: series, MoveTime: g.moveTime(g.Player2),
 		})
 	}
+	g.toSpectators(models.MsgSpectate, g.spectateState())
+	g.scheduleBotMove()
+}
+
+// seriesScore returns the score of the game's series, if it has one
+func (g *Game) seriesScore() *models.SeriesScore {
+	if g.Series == nil {
+		return nil
+	}
+	return g.Series.Score(g.Number)
 }
 
 func (g *Game) MakeMove(playerSymbol, col int) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
+	g.makeMove(playerSymbol, col)
+}
 
+// makeMove must be called with the game locked
+func (g *Game) makeMove(playerSymbol, col int) {
 	if g.Status != "playing" || g.Turn != playerSymbol {
 		return
 	}
@@ -80,6 +156,14 @@ func (g *Game) MakeMove(playerSymbol, col int) {
 	if row == -1 {
 		return // Column full
 	}
+	g.MoveCount++
+	g.moves = append(g.moves, col)
+	if g.drawOffer == 3-playerSymbol {
+		g.drawOffer = 0 // Playing on declines the offer
+	}
+	if g.takeback == 3-playerSymbol {
+		g.takeback = 0
+	}
 
 	// Check Win
 	if g.Board.CheckWin(row, col, playerSymbol) {
@@ -88,6 +172,7 @@ func (g *Game) MakeMove(playerSymbol, col int) {
 		if playerSymbol == 2 {
 			winnerName = g.Player2.Username
 		}
+		g.moveMade(playerSymbol, col, row)
 		g.broadcastUpdate()
 		g.endGame(winnerName, "connect4")
 		return
@@ -96,6 +181,7 @@ func (g *Game) MakeMove(playerSymbol, col int) {
 	// Check Draw
 	if g.Board.IsFull() {
 		g.Status = "finished"
+		g.moveMade(playerSymbol, col, row)
 		g.broadcastUpdate()
 		g.endGame("Draw", "draw")
 		return
@@ -103,19 +189,104 @@ func (g *Game) MakeMove(playerSymbol, col int) {
 
 	// Switch Turn
 	g.Turn = 3 - g.Turn 
+	g.moveMade(playerSymbol, col, row)
 	g.broadcastUpdate()
 
-	// Bot Logic
+	g.scheduleBotMove()
+}
+
+func (g *Game) moveMade(symbol, col, row int) {
+	if g.OnMove != nil {
+		g.OnMove(g, symbol, col, row)
+	}
+}
+
+// scheduleBotMove lets the bot play if it is its turn, and starts the clock
+// if an engine is to move. Must be called with the game locked.
+func (g *Game) scheduleBotMove() {
+	g.startMoveClock()
 	if g.Turn == 2 && g.Player2.IsBot {
+		takebacks := g.takebacks
 		go func() {
-			time.Sleep(500 * time.Millisecond)
-			bot := NewBot(2)
-			botMove := bot.GetMove(g.Board)
-			g.MakeMove(2, botMove)
+			time.Sleep(g.cfg.Bot.MoveDelay)
+			g.mutex.Lock()
+			board := *g.Board
+			g.mutex.Unlock()
+
+			bot := NewBot(2, g.cfg.Bot)
+			thinkStart := time.Now()
+			botMove := bot.GetMove(&board)
+			metrics.BotMoveDuration.Observe(time.Since(thinkStart).Seconds())
+
+			g.mutex.Lock()
+			defer g.mutex.Unlock()
+			if g.takebacks != takebacks {
+				return // The position it answered was taken back
+			}
+			g.makeMove(2, botMove)
 		}()
 	}
 }
 
+// Resume puts a game restored from a checkpoint back into play once every
+// human player has reconnected. Returns true if this call resumed it.
+func (g *Game) Resume() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "resuming" {
+		return false
+	}
+	if !g.Player1.connected() || (!g.Player2.IsBot && !g.Player2.connected()) {
+		return false
+	}
+	g.Status = "playing"
+	g.broadcastUpdate()
+	g.scheduleBotMove()
+	return true
+}
+
+// Suspend freezes a running game so it can be resumed from its checkpoint
+// by the next server process.
+func (g *Game) Suspend() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" && g.Status != "resuming" {
+		return
+	}
+	g.Status = "suspended"
+	if g.P1Timer != nil { g.P1Timer.Stop() }
+	if g.P2Timer != nil { g.P2Timer.Stop() }
+	if g.moveClock != nil { g.moveClock.Stop() }
+}
+
+// Finish ends a running game from outside the normal move flow (forfeits,
+// server shutdown). It is a no-op if the game is already over.
+func (g *Game) Finish(winner, reason string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.finish(winner, reason)
+}
+
+// finish must be called with the game locked
+func (g *Game) finish(winner, reason string) {
+	if g.Status != "playing" && g.Status != "resuming" {
+		return
+	}
+	g.Status = "finished"
+	g.endGame(winner, reason)
+}
+
+// Notify sends a message to both human players
+func (g *Game) Notify(msgType models.MessageType, data interface{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.sendTo(g.Player1, msgType, data)
+	g.sendTo(g.Player2, msgType, data)
+}
+
 func (g *Game) broadcastUpdate() {
 	payload := models.GameUpdatePayload{
 		Board: *g.Board,
@@ -129,28 +300,35 @@ func (g *Game) broadcastUpdate() {
 		payload.IsYourTurn = (g.Turn == 2)
 		g.sendTo(g.Player2, models.MsgUpdate, payload)
 	}
+
+	payload.IsYourTurn = false
+	g.toSpectators(models.MsgUpdate, payload)
 }
 
 func (g *Game) endGame(winner, reason string) {
 	// If timers are running, stop them
 	if g.P1Timer != nil { g.P1Timer.Stop() }
 	if g.P2Timer != nil { g.P2Timer.Stop() }
+	if g.moveClock != nil { g.moveClock.Stop() }
 
 	// Calculate Duration
 	duration := time.Since(g.StartTime).Seconds()
 
+	if g.Series != nil {
+		g.Series.record(winner, reason)
+	}
 	msg := models.WSMessage{
 		Type: models.MsgGameOver,
 		Payload: models.GameOverPayload{
 			Winner: winner,
 			Reason: reason,
+			Series: g.seriesScore(),
 		},
 	}
 	
-	g.safeWrite(g.Player1.Conn, msg)
-	if !g.Player2.IsBot {
-		g.safeWrite(g.Player2.Conn, msg)
-	}
+	g.sendTo(g.Player1, msg.Type, msg.Payload)
+	g.sendTo(g.Player2, msg.Type, msg.Payload)
+	g.toSpectators(msg.Type, msg.Payload)
 	
 	if g.OnGameOver != nil {
 		g.OnGameOver(g, winner, reason, duration)
@@ -160,10 +338,14 @@ func (g *Game) endGame(winner, reason string) {
 func (g *Game) sendTo(p *Player, msgType models.MessageType, data interface{}) {
 	if p.IsBot { return }
 	msg := models.WSMessage{Type: msgType, Payload: data}
+	if p.Remote != "" && g.Deliver != nil {
+		g.Deliver(g, p, msg)
+		return
+	}
 	g.safeWrite(p.Conn, msg)
 }
 
 func (g *Game) safeWrite(conn *websocket.Conn, msg interface{}) {
 	if conn == nil { return }
-	conn.WriteJSON(msg)
+	WriteJSON(conn, msg)
 }
\ No newline at end of file
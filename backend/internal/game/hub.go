@@ -1,12 +1,19 @@
 package game
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"connectfour/internal/chat"
+	"connectfour/internal/cluster"
+	"connectfour/internal/config"
 	"connectfour/internal/db"
 	"connectfour/internal/event"
+	"connectfour/internal/metrics"
 	"connectfour/pkg/models"
 
 	"github.com/google/uuid"
@@ -16,25 +23,100 @@ import (
 type WaitingPlayer struct {
 	Player   *Player
 	JoinedAt time.Time
+	Options  QueueOptions
+}
+
+// QueueOptions is how a player asked to be matched
+type QueueOptions struct {
+	// Casual games are unrated and allow takebacks. Casual and rated
+	// players are never paired with each other.
+	Casual bool
+	// NoBot keeps the player waiting for a human instead of falling back to
+	// the bot after BotFallbackAfter
+	NoBot bool
 }
 
 type Hub struct {
 	waiting       []*WaitingPlayer
 	games         map[string]*Game
 	playerGameMap map[*websocket.Conn]*Game
+	series        map[string]*Series // Unfinished series, by ID
+	rematches     map[*websocket.Conn]*rematch
+	spectating    map[*websocket.Conn]*Game
+	lobby         map[*websocket.Conn]*member
+	challenges    map[*challenge]bool
+	engines       map[*websocket.Conn]*engine // External engines connected here
 	mutex         sync.Mutex
 
-	repo     *db.Repository
-	producer *event.Producer
+	// Last time the matchmaker loop ran (unix nanos), for health checks
+	lastTick atomic.Int64
+	// Moving average of queue waits that ended in a human match
+	humanWait time.Duration
+
+	// Shutdown State
+	draining bool
+	pending  sync.WaitGroup // Results still being saved/emitted
+	drained  bool           // Shutdown is waiting on pending, which takes no more
+
+	// Checkpoints waiting to be written, true for the ones to delete, and
+	// series waiting to be saved. ckMutex is taken last; ckWriting is held while a batch is written.
+	ckPending map[*Game]bool
+	ckSeries  map[*Series]bool
+	ckMutex   sync.Mutex
+	ckWriting sync.Mutex
+	ckWake    chan struct{}
+
+	// Cluster State (nil node = single instance)
+	node  *cluster.Node
+	seats map[*websocket.Conn]*remoteSeat // Local players in games hosted elsewhere
+
+	cfg  config.Game
+	repo *db.Repository
+	sink event.EventSink
+	chat *chat.Moderator
+
+	resultListeners []func(Result)
+}
+
+// Result is the outcome of a finished game
+type Result struct {
+	GameID  string
+	Player1 string
+	Player2 string
+	Winner  string // Username or "Draw"
+	Reason  string
 }
 
-func NewHub(repo *db.Repository, producer *event.Producer) *Hub {
+var (
+	ErrBusy     = errors.New("player is already in a game")
+	ErrDraining = errors.New("server is shutting down")
+)
+
+func NewHub(cfg config.Game, repo *db.Repository, sink event.EventSink, node *cluster.Node) *Hub {
 	h := &Hub{
+		cfg:           cfg,
 		waiting:       make([]*WaitingPlayer, 0),
 		games:         make(map[string]*Game),
 		playerGameMap: make(map[*websocket.Conn]*Game),
+		series:        make(map[string]*Series),
+		rematches:     make(map[*websocket.Conn]*rematch),
+		spectating:    make(map[*websocket.Conn]*Game),
+		lobby:         make(map[*websocket.Conn]*member),
+		challenges:    make(map[*challenge]bool),
+		engines:       make(map[*websocket.Conn]*engine),
+		ckPending:     make(map[*Game]bool),
+		ckSeries:      make(map[*Series]bool),
+		ckWake:        make(chan struct{}, 1),
+		chat:          chat.NewModerator(cfg.Chat, repo),
+		seats:         make(map[*websocket.Conn]*remoteSeat),
+		node:          node,
 		repo:          repo,
-		producer:      producer,
+		sink:          sink,
+	}
+	h.restoreGames()
+	go h.checkpointLoop()
+	if node != nil {
+		node.Listen(h.handleClusterMessage)
 	}
 	go h.matchmakerLoop()
 	return h
@@ -45,94 +127,423 @@ func (h *Hub) matchmakerLoop() {
 	defer ticker.Stop()
 
 	for range ticker.C {
+		h.lastTick.Store(time.Now().UnixNano())
+		if h.node != nil {
+			h.matchAcrossCluster()
+		}
+
 		h.mutex.Lock()
-		for len(h.waiting) >= 2 {
-			p1 := h.waiting[0]
-			p2 := h.waiting[1]
-			h.waiting = h.waiting[2:]
-			h.startGame(p1.Player, p2.Player)
+		if h.draining {
+			h.mutex.Unlock()
+			return
+		}
+		// Clustered instances pair through the shared queue instead
+		for h.node == nil {
+			p1, p2 := h.nextPair()
+			if p1 == nil {
+				break
+			}
+			h.observeWait(p1, "human")
+			h.observeWait(p2, "human")
+			h.startGame(p1.Player, p2.Player, h.cfg.BestOf, !p1.Options.Casual)
 		}
 
-		remaining := []*WaitingPlayer{}
+		var due []*WaitingPlayer
 		for _, wp := range h.waiting {
-			if time.Since(wp.JoinedAt) > 10*time.Second {
-				bot := &Player{Username: "Bot", IsBot: true, Symbol: 2}
-				h.startGame(wp.Player, bot)
+			if !wp.Options.NoBot && time.Since(wp.JoinedAt) > h.cfg.BotFallbackAfter {
+				due = append(due, wp)
+			}
+		}
+		h.mutex.Unlock()
+
+		// Players claimed by another instance meanwhile stay with that match
+		var fallback []*WaitingPlayer
+		for _, wp := range due {
+			if h.leaveSharedQueue(wp.Player.Username) {
+				fallback = append(fallback, wp)
+			}
+		}
+
+		h.mutex.Lock()
+		for _, wp := range fallback {
+			if !h.dropWaiting(wp) {
+				continue // Left the queue in the meantime
+			}
+			assigned := event.GameEvent{
+				Event:    event.EventBotAssigned,
+				Player:   wp.Player.Username,
+				Duration: time.Since(wp.JoinedAt).Seconds(),
+			}
+			// Connected engines go first. Their games are rated like any
+			// other, the built-in bot's never are.
+			if engine := h.takeEngine(); engine != nil {
+				assigned.Event = event.EventEngineAssigned
+				assigned.Player2 = engine.Username
+				h.emit(assigned)
+				h.observeWait(wp, "engine")
+				s := newSeries(wp.Player, engine, h.cfg.BestOf, !wp.Options.Casual)
+				s.noRematch = true
+				h.startSeries(s)
 			} else {
-				remaining = append(remaining, wp)
+				h.emit(assigned)
+				h.observeWait(wp, "bot")
+				bot := &Player{Username: h.cfg.Bot.Name, IsBot: true, Symbol: 2}
+				h.startGame(wp.Player, bot, h.cfg.BestOf, false)
 			}
 		}
-		h.waiting = remaining
+		statuses := h.queueStatus()
+		presence := h.updatePresence()
 		h.mutex.Unlock()
+		send(statuses)
+		send(presence)
+	}
+}
+
+// nextPair takes the two longest waiting players who asked for the same
+// kind of game off the queue. Must be called with h.mutex held.
+func (h *Hub) nextPair() (*WaitingPlayer, *WaitingPlayer) {
+	for i, p1 := range h.waiting {
+		for j := i + 1; j < len(h.waiting); j++ {
+			p2 := h.waiting[j]
+			if p1.Options.Casual != p2.Options.Casual {
+				continue
+			}
+			h.waiting = append(h.waiting[:j], h.waiting[j+1:]...)
+			h.waiting = append(h.waiting[:i], h.waiting[i+1:]...)
+			return p1, p2
+		}
 	}
+	return nil, nil
 }
 
-func (h *Hub) AddPlayer(conn *websocket.Conn, username string) {
+// CheckMatchmaker fails if the hub is draining or its matchmaker loop has
+// stopped ticking
+func (h *Hub) CheckMatchmaker(ctx context.Context) error {
+	h.mutex.Lock()
+	draining := h.draining
+	h.mutex.Unlock()
+	if draining {
+		return fmt.Errorf("draining for shutdown")
+	}
+
+	last := h.lastTick.Load()
+	if last == 0 {
+		return fmt.Errorf("matchmaker has not started")
+	}
+	if since := time.Since(time.Unix(0, last)); since > 5*time.Second {
+		return fmt.Errorf("matchmaker last ran %s ago", since.Round(time.Second))
+	}
+	return nil
+}
+
+// QueueLength returns how many players are waiting on this instance
+func (h *Hub) QueueLength() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.waiting)
+}
+
+// ActiveGames returns how many games this instance is hosting
+func (h *Hub) ActiveGames() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.games)
+}
+
+// HasGame reports whether a game is still running here, including a
+// restored game waiting for its players
+func (h *Hub) HasGame(id string) bool {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
+	_, ok := h.games[id]
+	return ok
+}
+
+// observeWait records how long a player queued. Waits that ended with a
+// human opponent feed the estimate sent in QUEUE_STATUS.
+// Must be called with h.mutex held.
+func (h *Hub) observeWait(wp *WaitingPlayer, opponent string) {
+	wait := time.Since(wp.JoinedAt)
+	metrics.MatchmakingWait.WithLabelValues(opponent).Observe(wait.Seconds())
+	if opponent == "human" {
+		h.recordWait(wait)
+	}
+}
+
+func (h *Hub) AddPlayer(conn *websocket.Conn, username string, opts QueueOptions) {
+	if IsEngine(username) {
+		WriteJSON(conn, models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: ErrReservedName.Error()}})
+		return
+	}
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	_, notices = h.identify(conn, username)
+	h.mutex.Unlock()
 
 	// REJOIN LOGIC
-	for _, game := range h.games {
-		if game.Status == "playing" {
-			if game.Player1.Username == username {
-				fmt.Printf("♻️ REJOIN: %s reconnected to game %s\n", username, game.ID)
-				if game.P1Timer != nil { game.P1Timer.Stop(); game.P1Timer = nil }
-				h.reconnectPlayer(game, game.Player1, conn, 1)
-				return
-			}
-			if game.Player2.Username == username {
-				fmt.Printf("♻️ REJOIN: %s reconnected to game %s\n", username, game.ID)
-				if game.P2Timer != nil { game.P2Timer.Stop(); game.P2Timer = nil }
-				h.reconnectPlayer(game, game.Player2, conn, 2)
-				return
-			}
+	if game := h.rejoin(conn, username); game != nil {
+		// Restored games only continue once every player is back
+		if game.Resume() {
+			fmt.Printf("▶️ Game %s resumed after restart\n", game.ID)
 		}
+		return
+	}
+
+	if h.rejoinRemote(conn, username) {
+		return
 	}
 
 	// NEW PLAYER
+	h.mutex.Lock()
+	if h.draining {
+		h.mutex.Unlock()
+		WriteJSON(conn, models.WSMessage{
+			Type:    models.MsgError,
+			Payload: models.ErrorPayload{Message: "Server is restarting, please try again shortly."},
+		})
+		return
+	}
 	delete(h.playerGameMap, conn)
+	delete(h.seats, conn)
+	notices = append(notices, h.closeRematch(conn, "left")...)
 	wp := &WaitingPlayer{
 		Player:   &Player{Conn: conn, Username: username},
 		JoinedAt: time.Now(),
+		Options:  opts,
 	}
 	h.waiting = append(h.waiting, wp)
+	h.emit(event.GameEvent{Event: event.EventQueueJoined, Player: username})
+	h.mutex.Unlock()
+
+	h.joinSharedQueue(wp)
 	fmt.Printf("Player %s joined queue.\n", username)
 }
 
-func (h *Hub) reconnectPlayer(g *Game, p *Player, conn *websocket.Conn, symbol int) {
+// rejoin reattaches a returning player to their unfinished game, if any.
+// Must be called without h.mutex held.
+func (h *Hub) rejoin(conn *websocket.Conn, username string) *Game {
+	h.mutex.Lock()
+	var games []*Game
+	for _, game := range h.games {
+		if game.Player1.Username == username || game.Player2.Username == username {
+			games = append(games, game)
+		}
+	}
+	h.mutex.Unlock()
+
+	// One of them may have just finished
+	for _, game := range games {
+		if h.reconnectPlayer(game, username, conn, "") {
+			return game
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	// Between two games of a series the player just waits for the next one
+	for _, s := range h.series {
+		if !s.between {
+			continue
+		}
+		for _, p := range []*Player{s.Player1, s.Player2} {
+			if p.Username == username && !p.IsBot {
+				fmt.Printf("♻️ REJOIN: %s reconnected to series %s\n", username, s.ID)
+				p.Conn = conn
+				p.Remote = ""
+				h.playerGameMap[conn] = s.current
+				return s.current
+			}
+		}
+	}
+	return nil
+}
+
+// reconnectPlayer attaches a player of g to a local socket, or to a socket
+// on the remote instance, and replays the game state to them. It returns
+// false if g is over or no longer here. Must be called without h.mutex held.
+func (h *Hub) reconnectPlayer(g *Game, username string, conn *websocket.Conn, remote string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	h.mutex.Lock()
+	if _, ok := h.games[g.ID]; !ok || (g.Status != "playing" && g.Status != "resuming") {
+		h.mutex.Unlock()
+		return false
+	}
+	p := g.Player1
+	if g.Player2.Username == username { p = g.Player2 }
+	if p.Username != username {
+		h.mutex.Unlock()
+		return false
+	}
+
+	if remote == "" {
+		fmt.Printf("♻️ REJOIN: %s reconnected to game %s\n", username, g.ID)
+	} else {
+		fmt.Printf("♻️ REJOIN: %s reconnected to game %s via %s\n", username, g.ID, remote)
+		if p.Conn != nil { delete(h.playerGameMap, p.Conn) }
+	}
+	h.stopForfeitTimer(g, p.Symbol)
 	p.Conn = conn
-	h.playerGameMap[conn] = g
+	p.Remote = remote
+	if conn != nil { h.playerGameMap[conn] = g }
+	draining := h.draining
+
+	reconnected := h.gameEvent(event.EventPlayerReconnected, g)
+	reconnected.Player = p.Username
+	h.emit(reconnected)
+	h.mutex.Unlock()
 
+	symbol := p.Symbol
 	startPayload := models.GameStartPayload{
-		GameID: g.ID, Opponent: g.Player2.Username, Symbol: symbol, IsTurn: (g.Turn == symbol),
+		GameID: g.ID, Opponent: g.Player2.Username, Symbol: symbol, IsTurn: (g.Turn == symbol), Rated: g.Rated, Series: g.seriesScore(),
 	}
 	if symbol == 2 { startPayload.Opponent = g.Player1.Username }
-	conn.WriteJSON(models.WSMessage{Type: models.MsgGameStart, Payload: startPayload})
+	g.sendTo(p, models.MsgGameStart, startPayload)
 
 	updatePayload := models.GameUpdatePayload{
 		Board:      *g.Board,
 		Turn:       g.Turn,
 		IsYourTurn: (g.Turn == symbol),
 	}
-	conn.WriteJSON(models.WSMessage{Type: models.MsgUpdate, Payload: updatePayload})
+	g.sendTo(p, models.MsgUpdate, updatePayload)
+
+	if draining {
+		g.sendTo(p, models.MsgShutdown, models.ShutdownPayload{Message: shutdownNotice})
+	}
+	return true
+}
+
+// startGame pairs two players for a best-of-N series and starts its first
+// game. Must be called with h.mutex held.
+func (h *Hub) startGame(p1, p2 *Player, bestOf int, rated bool) *Game {
+	return h.startSeries(newSeries(p1, p2, bestOf, rated))
+}
+
+// startSeries starts the first game of a series.
+// Must be called with h.mutex held.
+func (h *Hub) startSeries(s *Series) *Game {
+	h.series[s.ID] = s
+	h.saveSeries(s)
+	if s.BestOf > 1 {
+		fmt.Printf("Starting best-of-%d series %s: %s vs %s\n", s.BestOf, s.ID, s.Player1.Username, s.Player2.Username)
+	}
+	return h.startSeriesGame(s)
 }
 
-func (h *Hub) startGame(p1, p2 *Player) {
+// startSeriesGame starts the next game of a series. A player who isn't
+// connected at that point gets the usual time to come back.
+// Must be called with h.mutex held.
+func (h *Hub) startSeriesGame(s *Series) *Game {
 	id := uuid.New().String()
-	game := NewGame(id, p1, p2, h.handleGameOver)
+	p1, p2 := s.Player1, s.Player2
+	game := NewGame(id, p1, p2, h.cfg, h.handleGameOver)
+	game.Series = s
+	number, first := s.next()
+	game.Number = number
+	game.Rated = s.Rated
+	game.startWith(first)
+	game.OnMove = h.onMove
+	game.OnTakeback = h.onTakeback
+	if h.node != nil { game.Deliver = h.deliver }
+	prev := s.current
+	s.current = game
+	s.between = false
 	h.games[id] = game
-	if !p1.IsBot { h.playerGameMap[p1.Conn] = game }
-	if !p2.IsBot { h.playerGameMap[p2.Conn] = game }
+	h.checkpoint(game)
+	h.emit(h.gameEvent(event.EventGameStarted, game))
+	if p1.Conn != nil { h.playerGameMap[p1.Conn] = game }
+	if p2.Conn != nil { h.playerGameMap[p2.Conn] = game }
+	if prev != nil {
+		// Spectators follow the series; nobody is left watching the old game
+		for conn := range prev.takeSpectators() {
+			game.spectators[conn] = true
+			h.spectating[conn] = game
+		}
+		for conn, watched := range h.spectating {
+			if watched == prev { delete(h.spectating, conn) }
+		}
+	}
+	for _, p := range []*Player{p1, p2} {
+		if !p.IsBot && !p.connected() {
+			h.startForfeitTimer(game, p.Symbol)
+		}
+	}
 
 	fmt.Printf("Starting Game %s\n", id)
 	go game.Start()
+	return game
+}
+
+// nextGame starts the next game of a series once the pause is over
+func (h *Hub) nextGame(s *Series) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// Series ended by a shutdown in the meantime are gone
+	if _, ok := h.series[s.ID]; !ok || h.draining {
+		return
+	}
+	h.startSeriesGame(s)
+}
+
+// StartMatch starts a single game between two connected players outside the
+// queue, e.g. for a tournament. name1 moves first. It fails if either
+// player is already in a game or the server is draining.
+func (h *Hub) StartMatch(conn1 *websocket.Conn, name1 string, conn2 *websocket.Conn, name2 string) (string, error) {
+	var dequeue []string // Taken off the shared queue once the lock is released
+	var notices []outgoing
+	defer func() {
+		send(notices)
+		for _, name := range dequeue { h.leaveSharedQueue(name) }
+	}()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.draining {
+		return "", ErrDraining
+	}
+	for _, conn := range []*websocket.Conn{conn1, conn2} {
+		if _, busy := h.playerGameMap[conn]; busy {
+			return "", ErrBusy
+		}
+		if _, busy := h.seats[conn]; busy {
+			return "", ErrBusy
+		}
+	}
+	for _, name := range []string{name1, name2} {
+		if h.takeWaiting(name) != nil {
+			dequeue = append(dequeue, name)
+		}
+	}
+	notices = append(h.closeRematch(conn1, "left"), h.closeRematch(conn2, "left")...)
+
+	s := newSeries(&Player{Conn: conn1, Username: name1}, &Player{Conn: conn2, Username: name2}, 1, true)
+	s.noRematch = true
+	s.first = 1 // The caller picked the colors
+	game := h.startSeries(s)
+	return game.ID, nil
+}
+
+// OnResult registers fn to be told about every finished game. Each result
+// is handed over on its own goroutine, without any lock held, and Shutdown
+// waits for the listeners to return.
+func (h *Hub) OnResult(fn func(Result)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.resultListeners = append(h.resultListeners, fn)
 }
 
 func (h *Hub) HandleMove(conn *websocket.Conn, col int) {
 	h.mutex.Lock()
 	game, exists := h.playerGameMap[conn]
+	seat := h.seats[conn]
 	h.mutex.Unlock()
 
+	if seat != nil {
+		h.node.Send(seat.host, cluster.Message{Kind: cluster.KindMove, GameID: seat.gameID, Symbol: seat.symbol, Column: col})
+		return
+	}
 	if !exists || game == nil { return }
 	symbol := 1
 	if game.Player2.Conn == conn { symbol = 2 }
@@ -140,71 +551,497 @@ func (h *Hub) HandleMove(conn *websocket.Conn, col int) {
 }
 
 func (h *Hub) HandleDisconnect(conn *websocket.Conn) {
+	defer forgetConn(conn)
+	var dequeue string // Taken off the shared queue once the lock is released
+	var left *Game     // Told once the lock is released, as it takes the game lock first
+	var seat *remoteSeat // Handed back to its host once the lock is released
+	var notices []outgoing
+	defer func() {
+		send(notices)
+		if dequeue != "" { h.leaveSharedQueue(dequeue) }
+		if left != nil { h.leaveGame(left, conn) }
+		if seat != nil { h.releaseSeat(seat) }
+	}()
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	
 	game, exists := h.playerGameMap[conn]
 	delete(h.playerGameMap, conn)
+	delete(h.engines, conn)
+	notices = append(h.closeRematch(conn, "left"), h.leaveLobby(conn)...)
+	if watched := h.spectating[conn]; watched != nil {
+		watched.removeSpectator(conn)
+		delete(h.spectating, conn)
+	}
 
 	for i, wp := range h.waiting {
 		if wp.Player.Conn == conn {
 			h.waiting = append(h.waiting[:i], h.waiting[i+1:]...)
+			dequeue = wp.Player.Username
+			h.emit(event.GameEvent{
+				Event:    event.EventQueueLeft,
+				Player:   wp.Player.Username,
+				Reason:   "disconnect",
+				Duration: time.Since(wp.JoinedAt).Seconds(),
+			})
 			return 
 		}
 	}
 
-	if exists && game != nil && game.Status == "playing" {
-		fmt.Printf("⚠️ Player disconnected from Game %s. Starting 30s timer.\n", game.ID)
-		
-		forfeitFunc := func() {
-			h.mutex.Lock()
-			defer h.mutex.Unlock()
-			
-			if currentG, ok := h.games[game.ID]; ok && currentG.Status == "playing" {
-				fmt.Printf("⏰ Timeout! Forfeiting game %s\n", game.ID)
-				winner := game.Player2.Username
-				if game.Player2.Conn == conn { winner = game.Player1.Username }
-				
-				currentG.Status = "finished"
-				
-				// Calculate Duration for Forfeit
-				duration := time.Since(currentG.StartTime).Seconds()
-
-				h.handleGameOver(currentG, winner, "forfeit", duration)
-
-				msg := models.WSMessage{
-					Type: models.MsgGameOver,
-					Payload: models.GameOverPayload{Winner: winner, Reason: "forfeit"},
-				}
-				if winner == game.Player1.Username {
-					game.Player1.Conn.WriteJSON(msg)
-				} else if !game.Player2.IsBot {
-					game.Player2.Conn.WriteJSON(msg)
-				}
-			}
-		}
+	if seat = h.seats[conn]; seat != nil {
+		delete(h.seats, conn)
+		return
+	}
+
+	if exists && game != nil {
+		left = game
+	}
+}
+
+// leaveGame handles the socket of a player of g going away.
+// Must be called without h.mutex held.
+func (h *Hub) leaveGame(g *Game, conn *websocket.Conn) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// A stale socket of a player who already rejoined matches neither seat
+	if g.Player1.Conn == conn {
+		h.playerLeft(g, 1)
+	} else if g.Player2.Conn == conn {
+		h.playerLeft(g, 2)
+	}
+}
+
+// playerLeft handles a player's socket going away mid-game, wherever it was
+// connected. Must be called with the game locked and h.mutex held.
+func (h *Hub) playerLeft(game *Game, symbol int) {
+	p := game.Player1
+	if symbol == 2 { p = game.Player2 }
+	p.Conn = nil
+	p.Remote = ""
+
+	disconnected := h.gameEvent(event.EventPlayerDisconnected, game)
+	disconnected.Player = p.Username
+	h.emit(disconnected)
 
-		if game.Player1.Conn == conn {
-			game.P1Timer = time.AfterFunc(30*time.Second, forfeitFunc)
-		} else if game.Player2.Conn == conn {
-			game.P2Timer = time.AfterFunc(30*time.Second, forfeitFunc)
+	// Restored games are already on their resume timer
+	if game.Status != "playing" {
+		return
+	}
+
+	if p.Engine {
+		fmt.Printf("⚠️ Engine %s left Game %s. Forfeiting.\n", p.Username, game.ID)
+	} else {
+		fmt.Printf("⚠️ Player disconnected from Game %s. Starting %s timer.\n", game.ID, h.cfg.ForfeitAfter)
+	}
+	h.startForfeitTimer(game, symbol)
+}
+
+// startForfeitTimer gives an absent player ForfeitAfter to come back before
+// the game goes to their opponent. Engines can't come back: one that is
+// gone has crashed and forfeits at once. Must be called with h.mutex held.
+func (h *Hub) startForfeitTimer(game *Game, symbol int) {
+	grace := h.cfg.ForfeitAfter
+	if game.player(symbol).Engine { grace = 0 }
+	h.forfeitAfter(game, symbol, grace)
+}
+
+// forfeitAfter gives the game to the opponent of an absent player once grace
+// is up. Must be called with h.mutex held.
+func (h *Hub) forfeitAfter(game *Game, symbol int, grace time.Duration) {
+	opponent := game.Player2
+	if symbol == 2 { opponent = game.Player1 }
+
+	forfeitFunc := func() {
+		h.mutex.Lock()
+		currentG, ok := h.games[game.ID]
+		h.mutex.Unlock()
+		if !ok {
+			return
 		}
+
+		fmt.Printf("⏰ Timeout! Forfeiting game %s\n", game.ID)
+		currentG.Finish(opponent.Username, "forfeit")
+	}
+
+	if symbol == 1 {
+		game.P1Timer = time.AfterFunc(grace, forfeitFunc)
+	} else {
+		game.P2Timer = time.AfterFunc(grace, forfeitFunc)
+	}
+	game.deadlines[symbol] = time.Now().Add(grace)
+	h.checkpoint(game)
+}
+
+// stopForfeitTimer spares a player who came back in time.
+// Must be called with h.mutex held.
+func (h *Hub) stopForfeitTimer(game *Game, symbol int) {
+	timer := &game.P1Timer
+	if symbol == 2 { timer = &game.P2Timer }
+	if *timer != nil { (*timer).Stop(); *timer = nil }
+	if !game.deadlines[symbol].IsZero() {
+		game.deadlines[symbol] = time.Time{}
+		h.checkpoint(game)
 	}
 }
 
 // Updated signature to accept duration
 func (h *Hub) handleGameOver(g *Game, winner, reason string, duration float64) {
+	s := g.Series
+	var notices []outgoing
+	h.mutex.Lock()
 	delete(h.games, g.ID)
-	if !g.Player1.IsBot && g.Player1.Conn != nil { delete(h.playerGameMap, g.Player1.Conn) }
-	if !g.Player2.IsBot && g.Player2.Conn != nil { delete(h.playerGameMap, g.Player2.Conn) }
-	
+	// No new games once draining: the series ends at the current score
+	cutShort := h.draining && !s.Finished()
+	if cutShort {
+		s.stop("shutdown")
+	}
+	if s.Finished() {
+		delete(h.series, s.ID)
+		if !g.Player1.IsBot && g.Player1.Conn != nil { delete(h.playerGameMap, g.Player1.Conn) }
+		if !g.Player2.IsBot && g.Player2.Conn != nil { delete(h.playerGameMap, g.Player2.Conn) }
+		h.releaseEngines(g)
+		notices = h.openRematch(s, g)
+	} else {
+		// Players stay mapped to this game until the next one starts, so a
+		// disconnect in between is still noticed
+		s.between = true
+		time.AfterFunc(h.cfg.NextGameAfter, func() { h.nextGame(s) })
+	}
+	// Add must not race with Shutdown's Wait, so both are decided under the
+	// lock. A result after that is still stored, just not waited for.
+	tracked := !h.drained
+	if tracked { h.pending.Add(1) }
+	listeners := h.resultListeners
+	h.mutex.Unlock()
+	if tracked { defer h.pending.Done() }
+	send(notices)
+
 	fmt.Printf("Game Over: %s won (%s). Duration: %.2fs\n", winner, reason, duration)
+	metrics.GamesFinished.WithLabelValues(reason).Inc()
+	if cutShort {
+		g.sendTo(g.Player1, models.MsgShutdown, models.ShutdownPayload{Message: seriesShutdownNotice})
+		g.sendTo(g.Player2, models.MsgShutdown, models.ShutdownPayload{Message: seriesShutdownNotice})
+	}
+
+	if h.repo != nil {
+		h.repo.SaveGame(s.row(), g.ID, g.Number, winner, reason)
+		h.dropCheckpoint(g)
+		if score, ok := ratedScore(g, winner, reason); ok {
+			if err := h.repo.RecordRating(g.Player1.Username, g.Player2.Username, score); err != nil {
+				fmt.Printf("⚠️ Could not update ratings after game %s: %v\n", g.ID, err)
+			}
+		}
+	}
+	over := h.gameEvent(event.EventGameOver, g)
+	over.Winner = winner
+	over.Reason = reason
+	over.Duration = duration
+	h.emit(over)
+
+	if len(listeners) == 0 {
+		return
+	}
+	// The game is still locked here. This Add can't race with Wait, which
+	// is still held up by the one above.
+	result := Result{GameID: g.ID, Player1: g.Player1.Username, Player2: g.Player2.Username, Winner: winner, Reason: reason}
+	if tracked { h.pending.Add(1) }
+	go func() {
+		if tracked { defer h.pending.Done() }
+		for _, fn := range listeners {
+			fn(result)
+		}
+	}()
+}
+
+const (
+	shutdownNotice       = "Server is restarting. Finish your game, no new matches will start."
+	seriesShutdownNotice = "Server is restarting. Your series ends at the current score."
+)
+
+// Shutdown drains the hub before the process exits. New JOINs are refused,
+// queued players are sent away and players in a game are told to finish up.
+// Games still running when ctx expires are suspended for the next process to
+// resume, or adjudicated as draws when there is no store. It returns once
+// every result has been handed to the repository and event sink.
+func (h *Hub) Shutdown(ctx context.Context) {
+	h.mutex.Lock()
+	if h.draining {
+		h.mutex.Unlock()
+		return
+	}
+	h.draining = true
+
+	var notices []outgoing
+	for _, wp := range h.waiting {
+		notices = append(notices, outgoing{wp.Player.Conn, models.WSMessage{
+			Type:    models.MsgShutdown,
+			Payload: models.ShutdownPayload{Message: "Server is restarting, please join again shortly."},
+		}})
+	}
+	leaving := h.waiting
+	for _, wp := range h.waiting {
+		h.emit(event.GameEvent{
+			Event:    event.EventQueueLeft,
+			Player:   wp.Player.Username,
+			Reason:   "shutdown",
+			Duration: time.Since(wp.JoinedAt).Seconds(),
+		})
+	}
+	h.waiting = nil
+	stopped := h.stopSeriesBetweenGames()
+	running := h.runningGames()
+	seated := len(h.seats)
+	for conn := range h.seats {
+		notices = append(notices, outgoing{conn, models.WSMessage{Type: models.MsgShutdown, Payload: models.ShutdownPayload{Message: shutdownNotice}}})
+	}
+	h.mutex.Unlock()
+	send(notices)
+
+	for _, wp := range leaving {
+		h.leaveSharedQueue(wp.Player.Username)
+	}
+	fmt.Printf("🛑 Draining hub: %d game(s) in progress\n", len(running))
+
+	for _, s := range stopped {
+		h.saveSeries(s)
+		s.current.Notify(models.MsgShutdown, models.ShutdownPayload{Message: seriesShutdownNotice})
+	}
+
+	notice := models.ShutdownPayload{Message: shutdownNotice}
+	if deadline, ok := ctx.Deadline(); ok {
+		notice.GracePeriod = int(time.Until(deadline).Seconds())
+	}
+	for _, g := range running {
+		g.Notify(models.MsgShutdown, notice)
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(running) > 0 || seated > 0 {
+		select {
+		case <-ctx.Done():
+			for _, g := range running {
+				// With a store the next process picks the game up again
+				if h.repo != nil {
+					fmt.Printf("💾 Suspending game %s until restart\n", g.ID)
+					g.Suspend()
+					h.checkpoint(g)
+					g.Notify(models.MsgShutdown, models.ShutdownPayload{
+						Message: "Your game has been saved. Rejoin with the same username once the server is back.",
+					})
+					continue
+				}
+				fmt.Printf("⚖️ Adjudicating game %s as a draw\n", g.ID)
+				g.Finish("Draw", "shutdown")
+			}
+			h.releaseSeats()
+			running, seated = nil, 0
+		case <-ticker.C:
+			h.mutex.Lock()
+			running = h.runningGames()
+			seated = len(h.seats)
+			h.mutex.Unlock()
+		}
+	}
 
+	h.mutex.Lock()
+	h.drained = true
+	h.mutex.Unlock()
+	h.pending.Wait()
 	if h.repo != nil {
-		h.repo.SaveGame(g.ID, g.Player1.Username, g.Player2.Username, winner, reason)
+		h.writeCheckpoints()
+	}
+	fmt.Println("✅ Hub drained")
+}
+
+// stopSeriesBetweenGames ends every series waiting for its next game at the
+// current score. Must be called with h.mutex held.
+func (h *Hub) stopSeriesBetweenGames() []*Series {
+	var stopped []*Series
+	for id, s := range h.series {
+		if !s.between {
+			continue
+		}
+		s.stop("shutdown")
+		delete(h.series, id)
+		for _, p := range []*Player{s.Player1, s.Player2} {
+			if p.Conn != nil { delete(h.playerGameMap, p.Conn) }
+		}
+		stopped = append(stopped, s)
+	}
+	return stopped
+}
+
+// runningGames must be called with h.mutex held
+func (h *Hub) runningGames() []*Game {
+	games := make([]*Game, 0, len(h.games))
+	for _, g := range h.games {
+		games = append(games, g)
+	}
+	return games
+}
+
+// onMove publishes the move and checkpoints the game if it goes on.
+// Called with the game locked.
+func (h *Hub) onMove(g *Game, symbol, col, row int) {
+	player := g.Player1.Username
+	if symbol == 2 { player = g.Player2.Username }
+
+	e := h.gameEvent(event.EventMoveMade, g)
+	e.Move = &event.Move{Number: g.MoveCount, Player: player, Symbol: symbol, Column: col, Row: row}
+	h.emit(e)
+
+	if g.Status == "playing" {
+		h.checkpoint(g)
+	}
+}
+
+// onTakeback publishes the position after a takeback and checkpoints it.
+// Called with the game locked.
+func (h *Hub) onTakeback(g *Game) {
+	h.emit(h.gameEvent(event.EventTakeback, g))
+	h.checkpoint(g)
+}
+
+// gameEvent fills in the identity and current state of a game
+func (h *Hub) gameEvent(t event.EventType, g *Game) event.GameEvent {
+	board := [6][7]int(*g.Board)
+	first := g.Player1.Username
+	if g.First == 2 { first = g.Player2.Username }
+	e := event.GameEvent{
+		Event:       t,
+		GameID:      g.ID,
+		Player1:     g.Player1.Username,
+		Player2:     g.Player2.Username,
+		BotGame:     g.Player2.IsBot,
+		FirstPlayer: first,
+		Board:       &board,
+		Turn:        g.Turn,
+		Moves:       g.MoveCount,
+	}
+	if g.Series != nil {
+		e.SeriesID = g.Series.ID
+		e.SeriesGame = g.Number
+	}
+	return e
+}
+
+func (h *Hub) emit(e event.GameEvent) {
+	if h.sink == nil {
+		return
+	}
+	e.Instance = h.instanceID()
+	h.sink.Emit(e)
+}
+
+// restoreGames reloads checkpointed games after a restart. They stay in the
+// "resuming" state until their players rejoin through AddPlayer, for at most
+// ResumeWindow, or less for a player who had already disconnected.
+func (h *Hub) restoreGames() {
+	if h.repo == nil {
+		return
+	}
+	saved, err := h.repo.LoadActiveGames(h.instanceID())
+	if err != nil {
+		fmt.Printf("WARNING: Could not restore active games: %v\n", err)
+		return
+	}
+
+	for _, s := range saved {
+		g := h.restoreGame(s)
+		h.mutex.Lock()
+		h.installGame(g, s)
+		h.mutex.Unlock()
+	}
+	if len(saved) > 0 {
+		fmt.Printf("♻️ Restored %d game(s), waiting for players to rejoin\n", len(saved))
+	}
+}
+
+// restoreGame rebuilds a game from its checkpoint. It reads the store, so it
+// must be called without h.mutex held.
+func (h *Hub) restoreGame(s db.ActiveGame) *Game {
+	board := Board(s.Board)
+	p1 := &Player{Username: s.Player1, Engine: s.Engine1}
+	p2 := &Player{Username: s.Player2, IsBot: s.BotGame, Engine: s.Engine2}
+
+	g := NewGame(s.ID, p1, p2, h.cfg, h.handleGameOver)
+	g.OnMove = h.onMove
+	g.OnTakeback = h.onTakeback
+	if h.node != nil { g.Deliver = h.deliver }
+	g.Board = &board
+	g.MoveCount = board.DiscCount()
+	g.First = s.FirstTurn
+	g.Turn = s.Turn
+	g.Status = "resuming"
+	g.StartTime = s.StartedAt
+	g.Series = h.restoreSeries(s, p1, p2)
+	g.Number, _ = g.Series.next()
+	g.Rated = g.Series.Rated
+	g.Series.current = g
+	return g
+}
+
+// installGame puts a restored game in play, waiting for its players.
+// Must be called with h.mutex held.
+func (h *Hub) installGame(g *Game, s db.ActiveGame) {
+	h.series[g.Series.ID] = g.Series
+	h.games[g.ID] = g
+
+	// Players who were already gone keep the time they had left. Engines
+	// can't rejoin a game, so theirs is lost.
+	for symbol, grace := range map[int]time.Duration{1: s.Grace1, 2: s.Grace2} {
+		if g.player(symbol).Engine {
+			grace = 0
+		}
+		if grace >= 0 && grace < h.cfg.ResumeWindow {
+			h.forfeitAfter(g, symbol, grace)
+		}
+	}
+	time.AfterFunc(h.cfg.ResumeWindow, func() { h.expireResume(g) })
+}
+
+// restoreSeries reloads the series of a restored game. Checkpoints from
+// before series existed, or whose series can't be read, become a single game.
+func (h *Hub) restoreSeries(saved db.ActiveGame, p1, p2 *Player) *Series {
+	if saved.SeriesID != "" {
+		row, ok, err := h.repo.LoadSeries(saved.SeriesID)
+		if err != nil {
+			fmt.Printf("WARNING: Could not restore series %s: %v\n", saved.SeriesID, err)
+		}
+		if ok {
+			return restoreSeries(row, p1, p2, saved.FirstTurn)
+		}
+	}
+	s := newSeries(p1, p2, 1, false)
+	s.first = saved.FirstTurn
+	h.saveSeries(s)
+	return s
+}
+
+// expireResume settles a restored game whose players didn't all come back
+func (h *Hub) expireResume(g *Game) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != "resuming" {
+		return
 	}
-	if h.producer != nil {
-		// Pass duration to producer
-		h.producer.EmitGameOver(g.ID, winner, duration)
+	h.mutex.Lock()
+	p1Back := g.Player1.connected()
+	p2Back := g.Player2.IsBot || g.Player2.connected()
+	h.mutex.Unlock()
+
+	switch {
+	case p1Back && !p2Back:
+		g.finish(g.Player1.Username, "forfeit")
+	case p2Back && !p1Back:
+		g.finish(g.Player2.Username, "forfeit")
+	case !p1Back && !p2Back:
+		fmt.Printf("⏰ Nobody rejoined restored game %s\n", g.ID)
+		g.finish("Draw", "abandoned")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/event"
+	"connectfour/internal/metrics"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShutdownDrainsGames(t *testing.T) {
+	h, sink := testHub(t, config.Game{})
+	queued, queuedClient := pipe(t)
+	conn1, client1 := pipe(t)
+	conn2, client2 := pipe(t)
+
+	h.AddPlayer(queued, "carol", QueueOptions{})
+	if _, err := h.StartMatch(conn1, "alice", conn2, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, client1, models.MsgGameStart, nil)
+	expect(t, client2, models.MsgGameStart, nil)
+
+	var mu sync.Mutex
+	var results []Result
+	h.OnResult(func(r Result) {
+		time.Sleep(50 * time.Millisecond) // Shutdown still waits for it
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	h.Shutdown(ctx)
+
+	mu.Lock()
+	if len(results) != 1 || results[0].Winner != "Draw" || results[0].Reason != "shutdown" {
+		t.Errorf("results when Shutdown returned = %+v, want one draw by shutdown", results)
+	}
+	mu.Unlock()
+
+	expect(t, queuedClient, models.MsgShutdown, nil)
+	for _, client := range []*websocket.Conn{client1, client2} {
+		// The warning comes first, then the game is adjudicated
+		expect(t, client, models.MsgShutdown, nil)
+		var over models.GameOverPayload
+		expect(t, client, models.MsgGameOver, &over)
+		if over.Winner != "Draw" || over.Reason != "shutdown" {
+			t.Errorf("game ended %q by %q, want a draw by shutdown", over.Winner, over.Reason)
+		}
+	}
+
+	left := false
+	for _, e := range sink.Events() {
+		if e.Event == event.EventQueueLeft && e.Player == "carol" && e.Reason == "shutdown" {
+			left = true
+		}
+	}
+	if !left {
+		t.Error("no QUEUE_LEFT for the queued player")
+	}
+
+	late, lateClient := pipe(t)
+	h.AddPlayer(late, "dave", QueueOptions{})
+	expect(t, lateClient, models.MsgError, nil)
+}
+
+func TestHubMetrics(t *testing.T) {
+	h, _ := testHub(t, config.Game{})
+	queued, _ := pipe(t)
+	conn1, client1 := pipe(t)
+	conn2, _ := pipe(t)
+
+	h.AddPlayer(queued, "carol", QueueOptions{NoBot: true})
+	if _, err := h.StartMatch(conn1, "alice", conn2, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, client1, models.MsgGameStart, nil)
+	if n := h.QueueLength(); n != 1 {
+		t.Errorf("QueueLength = %d, want 1", n)
+	}
+	if n := h.ActiveGames(); n != 1 {
+		t.Errorf("ActiveGames = %d, want 1", n)
+	}
+
+	resigned := metrics.GamesFinished.WithLabelValues("resign")
+	before := testutil.ToFloat64(resigned)
+	done := make(chan Result, 1)
+	h.OnResult(func(r Result) { done <- r }) // Called once the game is counted
+	if err := h.HandleAction(conn1, models.MsgResign); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+	if n := h.ActiveGames(); n != 0 {
+		t.Errorf("ActiveGames after the game = %d, want 0", n)
+	}
+	if got := testutil.ToFloat64(resigned) - before; got != 1 {
+		t.Errorf("games finished by resign went up by %v, want 1", got)
+	}
+}
+
+func TestCheckMatchmaker(t *testing.T) {
+	h, _ := testHub(t, config.Game{})
+	if err := h.CheckMatchmaker(context.Background()); err == nil {
+		t.Error("ready before the matchmaker ran")
+	}
+	h.lastTick.Store(time.Now().Add(-time.Minute).UnixNano())
+	if err := h.CheckMatchmaker(context.Background()); err == nil {
+		t.Error("ready with a stalled matchmaker")
+	}
+	h.lastTick.Store(time.Now().UnixNano())
+	if err := h.CheckMatchmaker(context.Background()); err != nil {
+		t.Errorf("not ready with a running matchmaker: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Shutdown(ctx)
+	if err := h.CheckMatchmaker(context.Background()); err == nil {
+		t.Error("ready while draining")
+	}
+}
@@ -0,0 +1,288 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrNotInLobby  = errors.New("enter the lobby first")
+	ErrUnavailable = errors.New("player is not available")
+	ErrNoChallenge = errors.New("no such challenge")
+)
+
+// Lobby statuses, as sent in PRESENCE
+const (
+	presenceIdle    = "idle"
+	presenceQueued  = "queued"
+	presenceInGame  = "in_game"
+	presenceOffline = "offline"
+)
+
+// member is a socket the lobby knows by name: it entered the lobby or
+// joined the queue. Only members that entered the lobby get PRESENCE.
+type member struct {
+	username string
+	status   string // As last announced
+	watching bool
+}
+
+// challenge is a game offered directly by one member to another
+type challenge struct {
+	from     *websocket.Conn
+	to       *websocket.Conn
+	fromName string
+	toName   string
+	casual   bool
+	timer    *time.Timer
+}
+
+// EnterLobby lists the players on this instance to conn and keeps it
+// posted about their presence
+func (h *Hub) EnterLobby(conn *websocket.Conn, username string) error {
+	if username == "" {
+		return errors.New("username required")
+	}
+	if IsEngine(username) {
+		return ErrReservedName
+	}
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	m, notices := h.identify(conn, username)
+	m.watching = true
+	notices = append(notices, h.updatePresence()...)
+
+	players := []models.PresencePayload{}
+	for _, other := range h.lobby {
+		players = append(players, models.PresencePayload{Username: other.username, Status: other.status})
+	}
+	notices = append(notices, outgoing{conn, models.WSMessage{Type: models.MsgLobby, Payload: models.LobbyPayload{Players: players}}})
+	return nil
+}
+
+// identify names the player behind a socket. A socket that changed names
+// takes the old one offline.
+// Must be called with h.mutex held; the PRESENCE is sent after it is released.
+func (h *Hub) identify(conn *websocket.Conn, username string) (*member, []outgoing) {
+	var out []outgoing
+	m := h.lobby[conn]
+	if m == nil {
+		m = &member{}
+		h.lobby[conn] = m
+	}
+	if m.username != username && m.status != "" {
+		out = h.announce(m.username, presenceOffline)
+		m.status = ""
+	}
+	m.username = username
+	return m, out
+}
+
+// statusOf must be called with h.mutex held
+func (h *Hub) statusOf(conn *websocket.Conn) string {
+	if _, ok := h.playerGameMap[conn]; ok {
+		return presenceInGame
+	}
+	if _, ok := h.seats[conn]; ok {
+		return presenceInGame
+	}
+	for _, wp := range h.waiting {
+		if wp.Player.Conn == conn {
+			return presenceQueued
+		}
+	}
+	return presenceIdle
+}
+
+// updatePresence announces every member whose status changed. It runs on
+// each matchmaker tick, so changes reach the lobby within a second.
+// Must be called with h.mutex held; the PRESENCE is sent after it is released.
+func (h *Hub) updatePresence() []outgoing {
+	var out []outgoing
+	for conn, m := range h.lobby {
+		if status := h.statusOf(conn); status != m.status {
+			m.status = status
+			out = append(out, h.announce(m.username, status)...)
+		}
+	}
+	return out
+}
+
+// announce addresses a PRESENCE to every member watching the lobby.
+// Must be called with h.mutex held.
+func (h *Hub) announce(username, status string) []outgoing {
+	var out []outgoing
+	msg := models.WSMessage{Type: models.MsgPresence, Payload: models.PresencePayload{Username: username, Status: status}}
+	for conn, m := range h.lobby {
+		if m.watching {
+			out = append(out, outgoing{conn, msg})
+		}
+	}
+	return out
+}
+
+// leaveLobby forgets a closed socket and calls off its challenges.
+// Must be called with h.mutex held; the PRESENCE is sent after it is released.
+func (h *Hub) leaveLobby(conn *websocket.Conn) []outgoing {
+	m := h.lobby[conn]
+	if m == nil {
+		return nil
+	}
+	delete(h.lobby, conn)
+	var notices []outgoing
+	for c := range h.challenges {
+		if c.from == conn || c.to == conn {
+			notices = append(notices, h.endChallenge(c, conn, "left")...)
+		}
+	}
+	if m.status != "" {
+		notices = append(notices, h.announce(m.username, presenceOffline)...)
+	}
+	return notices
+}
+
+// Challenge offers an idle player on this instance a game, outside the
+// queue. It stands for ChallengeTimeout.
+func (h *Hub) Challenge(conn *websocket.Conn, username string, casual bool) error {
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	me := h.lobby[conn]
+	if me == nil {
+		return ErrNotInLobby
+	}
+	if h.draining {
+		return ErrDraining
+	}
+	if h.statusOf(conn) != presenceIdle {
+		return ErrBusy
+	}
+	var target *websocket.Conn
+	for c, m := range h.lobby {
+		if c != conn && m.username == username && m.username != me.username && h.statusOf(c) == presenceIdle {
+			target = c
+		}
+	}
+	if target == nil {
+		return ErrUnavailable
+	}
+	for c := range h.challenges {
+		if c.from == conn && c.to == target {
+			return nil // Already offered
+		}
+	}
+
+	c := &challenge{from: conn, to: target, fromName: me.username, toName: username, casual: casual}
+	c.timer = time.AfterFunc(h.cfg.ChallengeTimeout, func() {
+		var notices []outgoing
+		defer func() { send(notices) }()
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if h.challenges[c] {
+			notices = h.endChallenge(c, nil, "expired")
+		}
+	})
+	h.challenges[c] = true
+	notices = append(notices, outgoing{target, models.WSMessage{Type: models.MsgChallenge, Payload: models.ChallengePayload{From: me.username, Casual: casual}}})
+	return nil
+}
+
+// AcceptChallenge starts the game offered by the named challenger, if both
+// players are still free
+func (h *Hub) AcceptChallenge(conn *websocket.Conn, from string) error {
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c := h.findChallenge(conn, from)
+	if c == nil || c.to != conn {
+		return ErrNoChallenge
+	}
+	if h.draining {
+		return ErrDraining
+	}
+	if h.lobby[c.from] == nil || h.statusOf(c.from) != presenceIdle || h.statusOf(conn) != presenceIdle {
+		notices = h.endChallenge(c, nil, "busy")
+		return ErrUnavailable
+	}
+
+	// Neither player is free for anything else now
+	for other := range h.challenges {
+		if other != c && (other.from == c.from || other.to == c.from || other.from == conn || other.to == conn) {
+			notices = append(notices, h.endChallenge(other, nil, "busy")...)
+		}
+	}
+	c.timer.Stop()
+	delete(h.challenges, c)
+	notices = append(notices, h.closeRematch(c.from, "left")...)
+	notices = append(notices, h.closeRematch(conn, "left")...)
+
+	fmt.Printf("⚔️ Challenge accepted: %s vs %s\n", c.fromName, c.toName)
+	h.startGame(&Player{Conn: c.from, Username: c.fromName}, &Player{Conn: conn, Username: c.toName}, h.cfg.BestOf, !c.casual)
+	notices = append(notices, h.updatePresence()...)
+	return nil
+}
+
+// DeclineChallenge turns down the named player's challenge, or withdraws
+// one made to them
+func (h *Hub) DeclineChallenge(conn *websocket.Conn, username string) error {
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c := h.findChallenge(conn, username)
+	if c == nil {
+		return ErrNoChallenge
+	}
+	reason := "declined"
+	if c.from == conn {
+		reason = "withdrawn"
+	}
+	notices = h.endChallenge(c, conn, reason)
+	return nil
+}
+
+// findChallenge returns the challenge between conn and the named player,
+// in either direction. Must be called with h.mutex held.
+func (h *Hub) findChallenge(conn *websocket.Conn, username string) *challenge {
+	for c := range h.challenges {
+		if (c.to == conn && c.fromName == username) || (c.from == conn && c.toName == username) {
+			return c
+		}
+	}
+	return nil
+}
+
+// endChallenge drops a challenge and tells both sides, except by, the
+// player who ended it. Must be called with h.mutex held.
+func (h *Hub) endChallenge(c *challenge, by *websocket.Conn, reason string) []outgoing {
+	c.timer.Stop()
+	delete(h.challenges, c)
+
+	from := ""
+	switch by {
+	case c.from:
+		from = c.fromName
+	case c.to:
+		from = c.toName
+	}
+	var notices []outgoing
+	for conn, other := range map[*websocket.Conn]string{c.from: c.toName, c.to: c.fromName} {
+		if conn != by {
+			notices = append(notices, outgoing{conn, models.WSMessage{Type: models.MsgChallengeDecline, Payload: models.ChallengePayload{Username: other, From: from, Reason: reason}}})
+		}
+	}
+	return notices
+}
@@ -0,0 +1,118 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// inLobby enters alice and bob into the lobby
+func inLobby(t *testing.T, h *Hub) (conn1, client1, conn2, client2 *websocket.Conn) {
+	t.Helper()
+	conn1, client1 = pipe(t)
+	conn2, client2 = pipe(t)
+	for conn, name := range map[*websocket.Conn]string{conn1: "alice", conn2: "bob"} {
+		if err := h.EnterLobby(conn, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn1, client1, conn2, client2
+}
+
+func TestChallengeAccepted(t *testing.T) {
+	h, _ := testHub(t, config.Game{ChallengeTimeout: time.Minute})
+	conn1, client1, conn2, client2 := inLobby(t, h)
+
+	if err := h.Challenge(conn1, "alice", false); err != ErrUnavailable {
+		t.Errorf("challenging yourself = %v, want ErrUnavailable", err)
+	}
+	if err := h.Challenge(conn1, "bob", true); err != nil {
+		t.Fatal(err)
+	}
+	var offer models.ChallengePayload
+	expect(t, client2, models.MsgChallenge, &offer)
+	if offer.From != "alice" || !offer.Casual {
+		t.Errorf("challenge = %+v, want a casual one from alice", offer)
+	}
+
+	if err := h.AcceptChallenge(conn2, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for client, opponent := range map[*websocket.Conn]string{client1: "bob", client2: "alice"} {
+		var start models.GameStartPayload
+		expect(t, client, models.MsgGameStart, &start)
+		if start.Opponent != opponent || start.Rated {
+			t.Errorf("game against %s, rated %v; want a casual game against %s", start.Opponent, start.Rated, opponent)
+		}
+	}
+	if err := h.AcceptChallenge(conn2, "alice"); err != ErrNoChallenge {
+		t.Errorf("accepting again = %v, want ErrNoChallenge", err)
+	}
+	if err := h.Challenge(conn1, "bob", false); err != ErrBusy {
+		t.Errorf("challenging during a game = %v, want ErrBusy", err)
+	}
+}
+
+func TestChallengeEnded(t *testing.T) {
+	tests := []struct {
+		name   string
+		end    func(h *Hub, conn1, conn2 *websocket.Conn) error
+		reason string
+		from   string
+		toBob  bool // Told to bob rather than alice
+	}{
+		{"declined", func(h *Hub, _, conn2 *websocket.Conn) error { return h.DeclineChallenge(conn2, "alice") }, "declined", "bob", false},
+		{"withdrawn", func(h *Hub, conn1, _ *websocket.Conn) error { return h.DeclineChallenge(conn1, "bob") }, "withdrawn", "alice", true},
+		{"left", func(h *Hub, conn1, _ *websocket.Conn) error { h.HandleDisconnect(conn1); return nil }, "left", "alice", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := testHub(t, config.Game{ChallengeTimeout: time.Minute})
+			conn1, client1, conn2, client2 := inLobby(t, h)
+			if err := h.Challenge(conn1, "bob", false); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, client2, models.MsgChallenge, nil)
+
+			if err := tt.end(h, conn1, conn2); err != nil {
+				t.Fatal(err)
+			}
+			told := client1
+			if tt.toBob {
+				told = client2
+			}
+			var decline models.ChallengePayload
+			expect(t, told, models.MsgChallengeDecline, &decline)
+			if decline.Reason != tt.reason || decline.From != tt.from {
+				t.Errorf("challenge ended %+v, want %s by %s", decline, tt.reason, tt.from)
+			}
+			if err := h.AcceptChallenge(conn2, "alice"); err != ErrNoChallenge {
+				t.Errorf("accepting afterwards = %v, want ErrNoChallenge", err)
+			}
+		})
+	}
+}
+
+func TestChallengeExpires(t *testing.T) {
+	h, _ := testHub(t, config.Game{ChallengeTimeout: 50 * time.Millisecond})
+	conn1, client1, conn2, client2 := inLobby(t, h)
+	if err := h.Challenge(conn1, "bob", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both sides hear of it, from nobody in particular
+	for client, other := range map[*websocket.Conn]string{client1: "bob", client2: "alice"} {
+		var decline models.ChallengePayload
+		expect(t, client, models.MsgChallengeDecline, &decline)
+		if decline.Reason != "expired" || decline.From != "" || decline.Username != other {
+			t.Errorf("challenge ended %+v, want expired with %s", decline, other)
+		}
+	}
+	if err := h.AcceptChallenge(conn2, "alice"); err != ErrNoChallenge {
+		t.Errorf("accepting after expiry = %v, want ErrNoChallenge", err)
+	}
+}
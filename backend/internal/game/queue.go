@@ -0,0 +1,109 @@
+package game
+
+import (
+	"errors"
+	"time"
+
+	"connectfour/internal/event"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrNotQueued = errors.New("you are not in the queue")
+
+// pairingDelay is what a player with a partner already in line waits for
+// the next matchmaker tick
+const pairingDelay = time.Second
+
+// recordWait folds a queue wait into the moving average.
+// Must be called with h.mutex held.
+func (h *Hub) recordWait(wait time.Duration) {
+	if h.humanWait == 0 {
+		h.humanWait = wait
+		return
+	}
+	h.humanWait = (4*h.humanWait + wait) / 5
+}
+
+// LeaveQueue takes a player out of matchmaking. It fails once another
+// instance has already picked them for a match.
+func (h *Hub) LeaveQueue(conn *websocket.Conn) error {
+	h.mutex.Lock()
+	var queued *WaitingPlayer
+	for _, wp := range h.waiting {
+		if wp.Player.Conn == conn {
+			queued = wp
+		}
+	}
+	h.mutex.Unlock()
+	if queued == nil {
+		return ErrNotQueued
+	}
+	if !h.leaveSharedQueue(queued.Player.Username) {
+		return ErrBusy
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	// Paired by the local matchmaker in the meantime
+	if !h.dropWaiting(queued) {
+		return ErrBusy
+	}
+	h.emit(event.GameEvent{
+		Event:    event.EventQueueLeft,
+		Player:   queued.Player.Username,
+		Reason:   "left",
+		Duration: time.Since(queued.JoinedAt).Seconds(),
+	})
+	return nil
+}
+
+// queueStatus tells every local player still waiting where they stand.
+// Must be called with h.mutex held; the messages are sent after it is released.
+func (h *Hub) queueStatus() []outgoing {
+	online := len(h.waiting)
+	for _, g := range h.games {
+		for _, p := range []*Player{g.Player1, g.Player2} {
+			if !p.IsBot && p.connected() {
+				online++
+			}
+		}
+	}
+
+	var out []outgoing
+	position := map[bool]int{}
+	now := time.Now()
+	for _, wp := range h.waiting {
+		position[wp.Options.Casual]++
+		status := models.QueueStatusPayload{
+			Position: position[wp.Options.Casual],
+			Waiting:  len(h.waiting),
+			Online:   online,
+			Waited:   int(now.Sub(wp.JoinedAt).Seconds()),
+		}
+
+		// Someone ahead in line is still unpaired, so this player completes
+		// a pair on the next tick
+		estimate := time.Duration(-1)
+		if position[wp.Options.Casual]%2 == 0 {
+			estimate = pairingDelay
+		} else if h.humanWait > 0 {
+			estimate = max(h.humanWait-now.Sub(wp.JoinedAt), pairingDelay)
+		}
+		if !wp.Options.NoBot {
+			botIn := max(h.cfg.BotFallbackAfter-now.Sub(wp.JoinedAt), 0)
+			status.BotIn = int(botIn.Seconds())
+			if estimate < 0 || botIn < estimate {
+				estimate = botIn
+			}
+		}
+		status.EstimatedWait = -1
+		if estimate >= 0 {
+			status.EstimatedWait = int(estimate.Round(time.Second).Seconds())
+		}
+
+		out = append(out, outgoing{wp.Player.Conn, models.WSMessage{Type: models.MsgQueueStatus, Payload: status}})
+	}
+	return out
+}
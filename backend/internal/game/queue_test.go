@@ -0,0 +1,92 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/event"
+	"connectfour/pkg/models"
+)
+
+func TestQueueStatus(t *testing.T) {
+	h, _ := testHub(t, config.Game{BotFallbackAfter: 10 * time.Second})
+	now := time.Now()
+	queued := func(name string, ago time.Duration, opts QueueOptions) *WaitingPlayer {
+		return &WaitingPlayer{Player: &Player{Username: name}, JoinedAt: now.Add(-ago), Options: opts}
+	}
+
+	tests := []struct {
+		name      string
+		humanWait time.Duration
+		want      map[string]models.QueueStatusPayload
+	}{
+		{"nothing to go by", 0, map[string]models.QueueStatusPayload{
+			"alice": {Position: 1, Waited: 3, EstimatedWait: 7, BotIn: 6},
+			"bob":   {Position: 1, Waited: 2, EstimatedWait: -1},
+			"carol": {Position: 2, Waited: 0, EstimatedWait: 1, BotIn: 9},
+		}},
+		{"recent waits", 5 * time.Second, map[string]models.QueueStatusPayload{
+			"alice": {Position: 1, Waited: 3, EstimatedWait: 2, BotIn: 6},
+			"bob":   {Position: 1, Waited: 2, EstimatedWait: 3},
+			"carol": {Position: 2, Waited: 0, EstimatedWait: 1, BotIn: 9},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.mutex.Lock()
+			h.waiting = []*WaitingPlayer{
+				queued("alice", 3300*time.Millisecond, QueueOptions{}),
+				queued("bob", 2200*time.Millisecond, QueueOptions{Casual: true, NoBot: true}),
+				queued("carol", 500*time.Millisecond, QueueOptions{}),
+			}
+			h.humanWait = tt.humanWait
+			out := h.queueStatus()
+			h.waiting = nil
+			h.mutex.Unlock()
+
+			if len(out) != 3 {
+				t.Fatalf("%d status message(s), want 3", len(out))
+			}
+			for i, name := range []string{"alice", "bob", "carol"} {
+				want := tt.want[name]
+				want.Waiting, want.Online = 3, 3
+				if got := out[i].msg.Payload.(models.QueueStatusPayload); got != want {
+					t.Errorf("%s got %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaveQueue(t *testing.T) {
+	h, sink := testHub(t, config.Game{})
+	conn, client := pipe(t)
+	h.AddPlayer(conn, "alice", QueueOptions{NoBot: true})
+
+	// Sent on the next matchmaker tick
+	var status models.QueueStatusPayload
+	expect(t, client, models.MsgQueueStatus, &status)
+	if status.Position != 1 || status.Waiting != 1 || status.BotIn != 0 {
+		t.Errorf("status = %+v, want first of 1 with no bot", status)
+	}
+
+	if err := h.LeaveQueue(conn); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.QueueLength(); n != 0 {
+		t.Errorf("QueueLength = %d after leaving, want 0", n)
+	}
+	if err := h.LeaveQueue(conn); err != ErrNotQueued {
+		t.Errorf("leaving again = %v, want ErrNotQueued", err)
+	}
+	left := 0
+	for _, e := range sink.Events() {
+		if e.Event == event.EventQueueLeft && e.Player == "alice" && e.Reason == "left" {
+			left++
+		}
+	}
+	if left != 1 {
+		t.Errorf("%d QUEUE_LEFT event(s), want 1", left)
+	}
+}
@@ -0,0 +1,393 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"connectfour/internal/cluster"
+	"connectfour/internal/db"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// remoteSeat is a local player in a game hosted by another instance.
+// Their moves are relayed to the host, and the host relays messages back.
+type remoteSeat struct {
+	gameID   string
+	host     string
+	symbol   int
+	username string
+}
+
+func (h *Hub) instanceID() string {
+	if h.node == nil {
+		return ""
+	}
+	return h.node.ID
+}
+
+// joinSharedQueue publishes a local waiting player to every instance.
+// It writes to the shared store, so it must be called without h.mutex held.
+func (h *Hub) joinSharedQueue(wp *WaitingPlayer) {
+	if h.node == nil {
+		return
+	}
+	err := h.node.Enqueue(cluster.QueueEntry{Username: wp.Player.Username, Instance: h.node.ID, JoinedAt: wp.JoinedAt, Casual: wp.Options.Casual})
+	if err != nil {
+		fmt.Printf("CLUSTER ERROR: Could not queue %s: %v\n", wp.Player.Username, err)
+	}
+}
+
+// leaveSharedQueue takes a local player off the shared queue. It returns
+// false if another instance has already claimed them for a match.
+// It writes to the shared store, so it must be called without h.mutex held.
+func (h *Hub) leaveSharedQueue(username string) bool {
+	if h.node == nil {
+		return true
+	}
+	removed, err := h.node.Dequeue(username)
+	if err != nil {
+		fmt.Printf("CLUSTER ERROR: Could not dequeue %s: %v\n", username, err)
+		return false
+	}
+	return removed
+}
+
+// dropWaiting removes wp from the local queue, if it is still there.
+// Must be called with h.mutex held.
+func (h *Hub) dropWaiting(wp *WaitingPlayer) bool {
+	for i, w := range h.waiting {
+		if w == wp {
+			h.waiting = append(h.waiting[:i], h.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// takeWaiting removes a player from the local queue by name.
+// Must be called with h.mutex held.
+func (h *Hub) takeWaiting(username string) *WaitingPlayer {
+	for i, wp := range h.waiting {
+		if wp.Player.Username == username {
+			h.waiting = append(h.waiting[:i], h.waiting[i+1:]...)
+			return wp
+		}
+	}
+	return nil
+}
+
+// matchAcrossCluster pairs players from the shared queue, wherever they are
+// connected, rated players first. The instance of the longer waiting player
+// hosts the game.
+func (h *Hub) matchAcrossCluster() {
+	h.mutex.Lock()
+	draining := h.draining
+	h.mutex.Unlock()
+	if draining {
+		return
+	}
+
+	if err := h.node.Heartbeat(); err != nil {
+		fmt.Printf("CLUSTER ERROR: Heartbeat failed: %v\n", err)
+	}
+
+	for _, casual := range []bool{false, true} {
+		for {
+			pair, ok, err := h.node.ClaimPair(casual)
+			if err != nil {
+				fmt.Printf("CLUSTER ERROR: Matchmaking failed: %v\n", err)
+				return
+			}
+			if !ok {
+				break
+			}
+
+			m := cluster.Message{
+				Kind:     cluster.KindMatch,
+				Username: pair[0].Username,
+				Opponent: pair[1].Username,
+				Instance: pair[1].Instance,
+				Casual:   casual,
+			}
+			if pair[0].Instance == h.node.ID {
+				m.From = h.node.ID
+				h.handleMatch(m)
+			} else {
+				h.node.Send(pair[0].Instance, m)
+			}
+		}
+	}
+}
+
+// rejoinRemote reattaches a returning player to a game hosted by another
+// instance. A game whose host is gone is taken over from its checkpoint. It
+// looks the game up in the store, so it must be called without h.mutex held.
+func (h *Hub) rejoinRemote(conn *websocket.Conn, username string) bool {
+	if h.node == nil || h.repo == nil {
+		return false
+	}
+	// Another instance may take the game over first, then it is theirs
+	for attempt := 0; attempt < 2; attempt++ {
+		active, ok, err := h.repo.FindActiveGame(username)
+		if err != nil || !ok || active.Host == "" || active.Host == h.node.ID {
+			return false
+		}
+		alive, err := h.node.Alive(active.Host)
+		if err != nil {
+			fmt.Printf("CLUSTER ERROR: Could not check on %s: %v\n", active.Host, err)
+			alive = true // Nobody takes the game over on a guess
+		}
+		if alive {
+			h.rejoinHost(conn, username, active)
+			return true
+		}
+		if claimed, done := h.adopt(conn, username, active); claimed {
+			return done
+		}
+	}
+	return false
+}
+
+// rejoinHost seats a returning player in a game on a live host
+func (h *Hub) rejoinHost(conn *websocket.Conn, username string, active db.ActiveGame) {
+	symbol := 1
+	if active.Player2 == username { symbol = 2 }
+	h.mutex.Lock()
+	h.seats[conn] = &remoteSeat{gameID: active.ID, host: active.Host, symbol: symbol, username: username}
+	h.mutex.Unlock()
+
+	fmt.Printf("♻️ REJOIN: %s reconnected to game %s on %s\n", username, active.ID, active.Host)
+	h.node.Send(active.Host, cluster.Message{Kind: cluster.KindRejoin, GameID: active.ID, Username: username})
+}
+
+// adopt takes over a game whose host is gone and rejoins the player to it
+// here. claimed is false if another instance got to the game first.
+func (h *Hub) adopt(conn *websocket.Conn, username string, active db.ActiveGame) (claimed, rejoined bool) {
+	claimed, err := h.repo.ClaimActiveGame(active.ID, active.Host, h.node.ID)
+	if err != nil {
+		fmt.Printf("CLUSTER ERROR: Could not take over game %s: %v\n", active.ID, err)
+		return true, false
+	}
+	if !claimed {
+		return false, false
+	}
+	fmt.Printf("♻️ Taking over game %s from %s, which is gone\n", active.ID, active.Host)
+
+	active.Host = h.node.ID
+	g := h.restoreGame(active)
+	h.mutex.Lock()
+	h.installGame(g, active)
+	h.mutex.Unlock()
+
+	if !h.reconnectPlayer(g, username, conn, "") {
+		return true, false
+	}
+	if g.Resume() {
+		fmt.Printf("▶️ Game %s resumed after restart\n", g.ID)
+	}
+	return true, true
+}
+
+// deliver relays a game message to a player connected to another instance
+func (h *Hub) deliver(g *Game, p *Player, msg models.WSMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	h.node.Send(p.Remote, cluster.Message{
+		Kind:     cluster.KindDeliver,
+		GameID:   g.ID,
+		Username: p.Username,
+		Symbol:   p.Symbol,
+		Payload:  payload,
+	})
+}
+
+// releaseSeats hands local players of remotely hosted games back to their
+// host as disconnected, so they can rejoin through another instance.
+func (h *Hub) releaseSeats() {
+	h.mutex.Lock()
+	seats := make([]*remoteSeat, 0, len(h.seats))
+	for conn, seat := range h.seats {
+		delete(h.seats, conn)
+		seats = append(seats, seat)
+	}
+	h.mutex.Unlock()
+
+	for _, seat := range seats {
+		h.releaseSeat(seat)
+	}
+}
+
+// releaseSeat tells the host that the player of a seat is gone. It writes
+// to the shared store, so it must be called without h.mutex held.
+func (h *Hub) releaseSeat(seat *remoteSeat) {
+	h.node.Send(seat.host, cluster.Message{Kind: cluster.KindDisconnect, GameID: seat.gameID, Symbol: seat.symbol})
+}
+
+func (h *Hub) handleClusterMessage(m cluster.Message) {
+	switch m.Kind {
+	case cluster.KindMatch:
+		h.handleMatch(m)
+	case cluster.KindMove:
+		h.handleRemoteMove(m)
+	case cluster.KindDeliver:
+		h.handleDeliver(m)
+	case cluster.KindDisconnect:
+		h.handleRemoteDisconnect(m)
+	case cluster.KindRejoin:
+		h.handleRemoteRejoin(m)
+	case cluster.KindChat:
+		h.handleRemoteChat(m)
+	case cluster.KindAction:
+		h.handleRemoteAction(m)
+	}
+}
+
+// handleMatch starts a game between a local queued player and an opponent
+// on any instance.
+func (h *Hub) handleMatch(m cluster.Message) {
+	var requeue func() // Shared queue writes wait until the lock is released
+	defer func() {
+		if requeue != nil { requeue() }
+	}()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	p1 := h.takeWaiting(m.Username)
+	if p1 == nil || h.draining {
+		// Our player left in the meantime, put the opponent back in line
+		requeue = func() {
+			h.node.Enqueue(cluster.QueueEntry{Username: m.Opponent, Instance: m.Instance, JoinedAt: time.Now(), Casual: m.Casual})
+		}
+		return
+	}
+
+	p2 := &Player{Username: m.Opponent, Remote: m.Instance}
+	if m.Instance == h.node.ID {
+		local := h.takeWaiting(m.Opponent)
+		if local == nil {
+			h.waiting = append([]*WaitingPlayer{p1}, h.waiting...)
+			requeue = func() { h.joinSharedQueue(p1) }
+			return
+		}
+		h.observeWait(local, "human")
+		p2 = local.Player
+	}
+	h.observeWait(p1, "human")
+
+	fmt.Printf("🔗 Matched %s with %s (on %s)\n", m.Username, m.Opponent, m.Instance)
+	h.startGame(p1.Player, p2, h.cfg.BestOf, !m.Casual)
+}
+
+func (h *Hub) handleRemoteMove(m cluster.Message) {
+	h.mutex.Lock()
+	g, ok := h.games[m.GameID]
+	h.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	p := g.Player1
+	if m.Symbol == 2 { p = g.Player2 }
+	if p.Remote != m.From {
+		return
+	}
+	g.MakeMove(m.Symbol, m.Column)
+}
+
+// handleDeliver writes a message from a remote host to the local socket.
+// The first message of a new game moves the player out of the local queue.
+func (h *Hub) handleDeliver(m cluster.Message) {
+	var envelope struct {
+		Type    models.MessageType `json:"type"`
+		Payload struct {
+			From   string              `json:"from"`
+			Series *models.SeriesScore `json:"series"`
+		} `json:"payload"`
+	}
+	decoded := json.Unmarshal(m.Payload, &envelope) == nil
+
+	h.mutex.Lock()
+	conn := h.seatFor(m)
+	h.mutex.Unlock()
+	if conn == nil {
+		return
+	}
+
+	// Mutes and blocks are applied where the recipient is connected
+	if decoded && (envelope.Type == models.MsgChat || envelope.Type == models.MsgEmote) &&
+		envelope.Payload.From != m.Username && h.chat.Hidden(m.Username, envelope.Payload.From) {
+		return
+	}
+	writeRaw(conn, m.Payload)
+
+	if decoded && envelope.Type == models.MsgGameOver {
+		if series := envelope.Payload.Series; series == nil || series.Finished {
+			h.mutex.Lock()
+			if seat := h.seats[conn]; seat != nil && seat.gameID == m.GameID { delete(h.seats, conn) }
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// seatFor finds the local socket a delivered message is for, taking the
+// player out of the local queue if it starts their game.
+// Must be called with h.mutex held.
+func (h *Hub) seatFor(m cluster.Message) *websocket.Conn {
+	for c, seat := range h.seats {
+		if seat.gameID == m.GameID && seat.symbol == m.Symbol {
+			return c
+		}
+	}
+	// The next game of a series keeps the seat of the previous one
+	for c, seat := range h.seats {
+		if seat.host == m.From && seat.username == m.Username {
+			seat.gameID = m.GameID
+			return c
+		}
+	}
+	wp := h.takeWaiting(m.Username)
+	if wp == nil {
+		return nil
+	}
+	h.observeWait(wp, "human")
+	conn := wp.Player.Conn
+	h.seats[conn] = &remoteSeat{gameID: m.GameID, host: m.From, symbol: m.Symbol, username: m.Username}
+	return conn
+}
+
+func (h *Hub) handleRemoteDisconnect(m cluster.Message) {
+	h.mutex.Lock()
+	g := h.gameByID(m.GameID)
+	h.mutex.Unlock()
+	if g == nil {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	p := g.Player1
+	if m.Symbol == 2 { p = g.Player2 }
+	if p.Remote != m.From {
+		return
+	}
+	h.playerLeft(g, m.Symbol)
+}
+
+func (h *Hub) handleRemoteRejoin(m cluster.Message) {
+	h.mutex.Lock()
+	g, ok := h.games[m.GameID]
+	h.mutex.Unlock()
+	if !ok || !h.reconnectPlayer(g, m.Username, nil, m.From) {
+		return
+	}
+	if g.Resume() {
+		fmt.Printf("▶️ Game %s resumed after restart\n", g.ID)
+	}
+}
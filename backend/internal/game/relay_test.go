@@ -0,0 +1,69 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"connectfour/internal/cluster"
+	"connectfour/internal/config"
+	"connectfour/pkg/models"
+)
+
+// delivered is a message for bob from the instance hosting his game
+func delivered(t *testing.T, gameID string, msg models.WSMessage) cluster.Message {
+	t.Helper()
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cluster.Message{Kind: cluster.KindDeliver, From: "host-b", GameID: gameID, Username: "bob", Symbol: 2, Payload: payload}
+}
+
+func TestDeliverSeatsQueuedPlayer(t *testing.T) {
+	h, _ := testHub(t, config.Game{})
+	conn, client := pipe(t)
+	h.AddPlayer(conn, "bob", QueueOptions{})
+
+	seat := func() *remoteSeat {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return h.seats[conn]
+	}
+	start := models.WSMessage{Type: models.MsgGameStart, Payload: models.GameStartPayload{GameID: "g1", Opponent: "alice", Symbol: 2}}
+	series := &models.SeriesScore{SeriesID: "s1", BestOf: 3, Game: 1}
+	over := models.WSMessage{Type: models.MsgGameOver, Payload: models.GameOverPayload{Winner: "alice", Reason: "connect4", Series: series}}
+
+	h.handleDeliver(delivered(t, "g1", start))
+	expect(t, client, models.MsgGameStart, nil)
+	h.mutex.Lock()
+	waiting, status := len(h.waiting), h.statusOf(conn)
+	h.mutex.Unlock()
+	if waiting != 0 || status != presenceInGame {
+		t.Fatalf("after GAME_START: %d waiting, bob %s; want 0 waiting, bob in_game", waiting, status)
+	}
+	if s := seat(); s == nil || s.gameID != "g1" || s.host != "host-b" || s.symbol != 2 {
+		t.Fatalf("seat = %+v, want g1 on host-b as player 2", s)
+	}
+
+	// The series goes on, so the seat is kept for its next game
+	h.handleDeliver(delivered(t, "g1", over))
+	expect(t, client, models.MsgGameOver, nil)
+	h.handleDeliver(delivered(t, "g2", start))
+	expect(t, client, models.MsgGameStart, nil)
+	if s := seat(); s == nil || s.gameID != "g2" {
+		t.Fatalf("seat for the next game = %+v, want g2", s)
+	}
+
+	series.Finished = true
+	h.handleDeliver(delivered(t, "g2", over))
+	expect(t, client, models.MsgGameOver, nil)
+	if s := seat(); s != nil {
+		t.Errorf("seat = %+v after the series, want none", s)
+	}
+
+	// Nobody here to take it
+	h.handleDeliver(delivered(t, "g3", start))
+	if s := seat(); s != nil {
+		t.Errorf("seat = %+v for a player not in the queue, want none", s)
+	}
+}
@@ -0,0 +1,173 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrNoRematch = errors.New("no rematch available")
+
+// rematch is the window after a series in which its players can agree to
+// play again. Only players connected to this instance (or the bot) get one.
+type rematch struct {
+	player1 *Player // As seated in the series that just ended
+	player2 *Player
+	first   string // Who moved first in the last game
+	bestOf  int
+	rated   bool
+	offered map[string]bool // Usernames that want to play again
+	timer   *time.Timer
+}
+
+// opponent returns the other side of the rematch
+func (r *rematch) opponent(conn *websocket.Conn) (me, them *Player) {
+	if r.player1.Conn == conn {
+		return r.player1, r.player2
+	}
+	return r.player2, r.player1
+}
+
+// openRematch gives the players of a finished series RematchWindow to ask
+// for another one. Must be called with h.mutex held.
+func (h *Hub) openRematch(s *Series, last *Game) []outgoing {
+	if h.draining || s.noRematch {
+		return nil
+	}
+	for _, p := range []*Player{s.Player1, s.Player2} {
+		if !p.IsBot && (p.Conn == nil || p.Remote != "") {
+			return nil
+		}
+	}
+
+	first := s.Player1.Username
+	if last.First == 2 {
+		first = s.Player2.Username
+	}
+	r := &rematch{player1: s.Player1, player2: s.Player2, first: first, bestOf: s.BestOf, rated: s.Rated, offered: map[string]bool{}}
+	var notices []outgoing
+	for _, p := range []*Player{s.Player1, s.Player2} {
+		if p.Conn != nil {
+			notices = append(notices, h.closeRematch(p.Conn, "")...)
+			h.rematches[p.Conn] = r
+		}
+	}
+	r.timer = time.AfterFunc(h.cfg.RematchWindow, func() {
+		var notices []outgoing
+		defer func() { send(notices) }()
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if h.rematches[r.player1.Conn] == r || h.rematches[r.player2.Conn] == r {
+			notices = h.endRematch(r, "", "expired")
+		}
+	})
+	return notices
+}
+
+// OfferRematch asks the last opponent for a rematch, or accepts theirs
+func (h *Hub) OfferRematch(conn *websocket.Conn) error {
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r := h.rematches[conn]
+	if r == nil {
+		return ErrNoRematch
+	}
+	if h.draining {
+		return ErrDraining
+	}
+	me, them := r.opponent(conn)
+	r.offered[me.Username] = true
+
+	// The bot is always up for another one
+	if !them.IsBot && !r.offered[them.Username] {
+		notices = append(notices, outgoing{them.Conn, models.WSMessage{Type: models.MsgRematchOffer, Payload: models.RematchPayload{From: me.Username}}})
+		return nil
+	}
+	h.startRematch(r)
+	return nil
+}
+
+// AcceptRematch takes up the opponent's offer. Accepting before they have
+// offered counts as an offer.
+func (h *Hub) AcceptRematch(conn *websocket.Conn) error {
+	return h.OfferRematch(conn)
+}
+
+// DeclineRematch turns down a rematch, or withdraws an offer
+func (h *Hub) DeclineRematch(conn *websocket.Conn) error {
+	var notices []outgoing
+	defer func() { send(notices) }()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r := h.rematches[conn]
+	if r == nil {
+		return ErrNoRematch
+	}
+	me, _ := r.opponent(conn)
+	notices = h.endRematch(r, me.Username, "declined")
+	return nil
+}
+
+// closeRematch drops the rematch of a player who moved on (left, queued
+// again). The opponent is told if they are still around.
+// Must be called with h.mutex held.
+func (h *Hub) closeRematch(conn *websocket.Conn, reason string) []outgoing {
+	r := h.rematches[conn]
+	if r == nil {
+		return nil
+	}
+	me, _ := r.opponent(conn)
+	return h.endRematch(r, me.Username, reason)
+}
+
+// endRematch closes the window for both players and tells whoever is left
+// waiting. from is the player who ended it, if anyone.
+// Must be called with h.mutex held.
+func (h *Hub) endRematch(r *rematch, from, reason string) []outgoing {
+	r.timer.Stop()
+	var notices []outgoing
+	for _, p := range []*Player{r.player1, r.player2} {
+		if p.Conn == nil || h.rematches[p.Conn] != r {
+			continue
+		}
+		delete(h.rematches, p.Conn)
+		if reason != "" && p.Username != from {
+			notices = append(notices, outgoing{p.Conn, models.WSMessage{Type: models.MsgRematchDecline, Payload: models.RematchPayload{From: from, Reason: reason}}})
+		}
+	}
+	return notices
+}
+
+// startRematch seats the same players again with colors swapped, so whoever
+// moved first last time moves second now. The bot always plays symbol 2, so
+// against it only the first move changes hands.
+// Must be called with h.mutex held.
+func (h *Hub) startRematch(r *rematch) {
+	r.timer.Stop()
+	delete(h.rematches, r.player1.Conn)
+	delete(h.rematches, r.player2.Conn)
+
+	seat := func(p *Player) *Player {
+		return &Player{Conn: p.Conn, Username: p.Username, IsBot: p.IsBot}
+	}
+	p1, p2 := seat(r.player2), seat(r.player1)
+	if p1.IsBot {
+		p1, p2 = p2, p1
+	}
+	s := newSeries(p1, p2, r.bestOf, r.rated)
+	s.first = 1
+	if p1.Username == r.first {
+		s.first = 2
+	}
+
+	fmt.Printf("🔁 Rematch: %s vs %s\n", p1.Username, p2.Username)
+	h.startSeries(s)
+}
@@ -0,0 +1,102 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// finishedMatch plays a one game series between alice and bob, which bob
+// resigns. Alice moves first.
+func finishedMatch(t *testing.T, h *Hub) (conn1, client1, conn2, client2 *websocket.Conn) {
+	t.Helper()
+	conn1, client1 = pipe(t)
+	conn2, client2 = pipe(t)
+	h.mutex.Lock()
+	s := newSeries(&Player{Conn: conn1, Username: "alice"}, &Player{Conn: conn2, Username: "bob"}, 1, true)
+	s.first = 1
+	h.startSeries(s)
+	h.mutex.Unlock()
+	expect(t, client1, models.MsgGameStart, nil)
+
+	done := make(chan Result, 1)
+	h.OnResult(func(r Result) { done <- r }) // Called once the rematch is open
+	if err := h.HandleAction(conn2, models.MsgResign); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+	return conn1, client1, conn2, client2
+}
+
+func TestRematchAccepted(t *testing.T) {
+	h, _ := testHub(t, config.Game{RematchWindow: time.Minute})
+	conn1, client1, conn2, client2 := finishedMatch(t, h)
+
+	if err := h.OfferRematch(conn1); err != nil {
+		t.Fatal(err)
+	}
+	var offer models.RematchPayload
+	expect(t, client2, models.MsgRematchOffer, &offer)
+	if offer.From != "alice" {
+		t.Errorf("offer from %q, want alice", offer.From)
+	}
+	if err := h.AcceptRematch(conn2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Whoever moved first last time moves second now
+	var start models.GameStartPayload
+	expect(t, client1, models.MsgGameStart, &start)
+	if start.Opponent != "bob" || start.IsTurn {
+		t.Errorf("rematch against %s, alice to move %v; want bob, with bob to move", start.Opponent, start.IsTurn)
+	}
+	expect(t, client2, models.MsgGameStart, nil)
+	if err := h.OfferRematch(conn1); err != ErrNoRematch {
+		t.Errorf("second rematch offer = %v, want ErrNoRematch", err)
+	}
+}
+
+func TestRematchDeclined(t *testing.T) {
+	h, _ := testHub(t, config.Game{RematchWindow: time.Minute})
+	conn1, client1, conn2, client2 := finishedMatch(t, h)
+
+	if err := h.OfferRematch(conn1); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, client2, models.MsgRematchOffer, nil)
+	if err := h.DeclineRematch(conn2); err != nil {
+		t.Fatal(err)
+	}
+	var decline models.RematchPayload
+	expect(t, client1, models.MsgRematchDecline, &decline)
+	if decline.From != "bob" || decline.Reason != "declined" {
+		t.Errorf("decline = %+v, want declined by bob", decline)
+	}
+	if err := h.OfferRematch(conn1); err != ErrNoRematch {
+		t.Errorf("offer after the decline = %v, want ErrNoRematch", err)
+	}
+}
+
+func TestRematchExpires(t *testing.T) {
+	h, _ := testHub(t, config.Game{RematchWindow: 50 * time.Millisecond})
+	conn1, client1, _, client2 := finishedMatch(t, h)
+
+	for _, client := range []*websocket.Conn{client1, client2} {
+		var decline models.RematchPayload
+		expect(t, client, models.MsgRematchDecline, &decline)
+		if decline.Reason != "expired" {
+			t.Errorf("rematch ended by %q, want expired", decline.Reason)
+		}
+	}
+	if err := h.OfferRematch(conn1); err != ErrNoRematch {
+		t.Errorf("offer after expiry = %v, want ErrNoRematch", err)
+	}
+}
@@ -0,0 +1,188 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"connectfour/internal/cluster"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrGameOver    = errors.New("the game is over")
+	ErrNoDrawOffer = errors.New("no draw has been offered")
+	ErrDrawOffered = errors.New("you already offered a draw this move")
+)
+
+// ratedResults are the ways a game can end that count towards ratings.
+// Games cut short by the server (shutdown, abandoned) do not.
+var ratedResults = map[string]bool{"connect4": true, "draw": true, "forfeit": true, "resign": true, "agreed_draw": true, "timeout": true}
+
+// ratedScore returns what player 1 scored in a finished game, if it counts
+// towards ratings. Casual games, which include every game against the bot,
+// never do.
+func ratedScore(g *Game, winner, reason string) (float64, bool) {
+	if !g.Rated || !ratedResults[reason] {
+		return 0, false
+	}
+	switch winner {
+	case g.Player1.Username:
+		return 1, true
+	case g.Player2.Username:
+		return 0, true
+	}
+	return 0.5, true
+}
+
+// HandleAction applies a RESIGN, DRAW or TAKEBACK message from a player to
+// their game
+func (h *Hub) HandleAction(conn *websocket.Conn, kind models.MessageType) error {
+	h.mutex.Lock()
+	g, p := h.playerFor(conn)
+	seat := h.seats[conn]
+	h.mutex.Unlock()
+
+	if seat != nil {
+		payload, _ := json.Marshal(models.WSMessage{Type: kind})
+		h.node.Send(seat.host, cluster.Message{Kind: cluster.KindAction, GameID: seat.gameID, Symbol: seat.symbol, Payload: payload})
+		return nil
+	}
+	if g == nil {
+		return ErrNotPlaying
+	}
+	return g.act(p.Symbol, kind)
+}
+
+// handleRemoteAction takes a RESIGN, DRAW or TAKEBACK message from a player
+// connected elsewhere
+func (h *Hub) handleRemoteAction(m cluster.Message) {
+	h.mutex.Lock()
+	g := h.gameByID(m.GameID)
+	h.mutex.Unlock()
+	if g == nil {
+		return
+	}
+	p := g.Player1
+	if m.Symbol == 2 {
+		p = g.Player2
+	}
+	if p.Remote != m.From {
+		return
+	}
+
+	var msg models.WSMessage
+	if json.Unmarshal(m.Payload, &msg) != nil {
+		return
+	}
+	if err := g.act(m.Symbol, msg.Type); err != nil {
+		g.tell(p, models.MsgError, models.ErrorPayload{Message: err.Error()})
+	}
+}
+
+func (g *Game) act(symbol int, kind models.MessageType) error {
+	switch kind {
+	case models.MsgResign:
+		return g.Resign(symbol)
+	case models.MsgDrawOffer:
+		return g.OfferDraw(symbol)
+	case models.MsgDrawAccept:
+		return g.AcceptDraw(symbol)
+	case models.MsgDrawDecline:
+		return g.DeclineDraw(symbol)
+	case models.MsgTakebackRequest:
+		return g.RequestTakeback(symbol)
+	case models.MsgTakebackAccept:
+		return g.AcceptTakeback(symbol)
+	case models.MsgTakebackDecline:
+		return g.DeclineTakeback(symbol)
+	}
+	return fmt.Errorf("%s is not a game action", kind)
+}
+
+// Resign gives the game to the opponent of symbol. It can be done at any
+// time, not only on the player's turn.
+func (g *Game) Resign(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" && g.Status != "resuming" {
+		return ErrGameOver
+	}
+	g.Status = "finished"
+	g.endGame(g.player(3-symbol).Username, "resign")
+	return nil
+}
+
+// OfferDraw offers the opponent of symbol a draw, or accepts theirs if they
+// offered one first. The bot always plays on.
+func (g *Game) OfferDraw(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" {
+		return ErrGameOver
+	}
+	if g.drawOffer == 3-symbol {
+		g.agreeDraw()
+		return nil
+	}
+	if g.drawOffered[symbol] == g.MoveCount+1 {
+		return ErrDrawOffered
+	}
+	g.drawOffered[symbol] = g.MoveCount + 1
+
+	me, opponent := g.player(symbol), g.player(3-symbol)
+	if opponent.IsBot {
+		g.sendTo(me, models.MsgDrawDecline, models.DrawPayload{From: opponent.Username})
+		return nil
+	}
+	g.drawOffer = symbol
+	g.sendTo(opponent, models.MsgDrawOffer, models.DrawPayload{From: me.Username})
+	return nil
+}
+
+// AcceptDraw ends the game as a draw if the opponent of symbol offered one
+func (g *Game) AcceptDraw(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" {
+		return ErrGameOver
+	}
+	if g.drawOffer != 3-symbol {
+		return ErrNoDrawOffer
+	}
+	g.agreeDraw()
+	return nil
+}
+
+// DeclineDraw turns down the opponent's draw offer
+func (g *Game) DeclineDraw(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" || g.drawOffer != 3-symbol {
+		return ErrNoDrawOffer
+	}
+	g.drawOffer = 0
+	g.sendTo(g.player(3-symbol), models.MsgDrawDecline, models.DrawPayload{From: g.player(symbol).Username})
+	return nil
+}
+
+// agreeDraw must be called with the game locked
+func (g *Game) agreeDraw() {
+	g.drawOffer = 0
+	g.Status = "finished"
+	g.endGame("Draw", "agreed_draw")
+}
+
+// player returns the player with the given symbol
+func (g *Game) player(symbol int) *Player {
+	if symbol == 2 {
+		return g.Player2
+	}
+	return g.Player1
+}
@@ -0,0 +1,200 @@
+package game
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"connectfour/internal/db"
+	"connectfour/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// Series is a best-of-N match between two players. Every game of a series
+// reuses the same two Player values, so Player1 always plays symbol 1, and
+// the player who moves first alternates from game to game. The series is
+// over once a player has won a majority of the games, after N games, or as
+// soon as a game ends any other way than on the board, by resignation or by
+// agreement.
+type Series struct {
+	ID        string
+	BestOf    int
+	Player1   *Player
+	Player2   *Player
+	Rated     bool // Its games count towards ratings; no takebacks
+	CreatedAt time.Time
+
+	// Set for games started from outside matchmaking, which are not
+	// offered a rematch
+	noRematch bool
+
+	mutex    sync.Mutex
+	first    int // Symbol moving first in game 1
+	played   int
+	wins1    int
+	wins2    int
+	draws    int
+	finished bool
+	winner   string
+	reason   string
+
+	// Guarded by the hub's mutex
+	current *Game // Game being played, or the last one while between games
+	between bool  // Waiting to start the next game
+}
+
+// newSeries pairs two players. Who moves first in the opening game is a
+// coin toss; after that it alternates.
+func newSeries(p1, p2 *Player, bestOf int, rated bool) *Series {
+	return &Series{
+		ID:        uuid.New().String(),
+		BestOf:    bestOf,
+		Player1:   p1,
+		Player2:   p2,
+		Rated:     rated,
+		CreatedAt: time.Now(),
+		first:     1 + rand.Intn(2),
+	}
+}
+
+// restoreSeries rebuilds a series from its stored score. firstTurn is who
+// moved first in the game being restored.
+func restoreSeries(row db.Series, p1, p2 *Player, firstTurn int) *Series {
+	s := &Series{
+		ID:        row.ID,
+		BestOf:    row.BestOf,
+		Player1:   p1,
+		Player2:   p2,
+		Rated:     row.Rated,
+		CreatedAt: row.CreatedAt,
+		played:    row.Wins1 + row.Wins2 + row.Draws,
+		wins1:     row.Wins1,
+		wins2:     row.Wins2,
+		draws:     row.Draws,
+		first:     firstTurn,
+	}
+	if s.played%2 == 1 {
+		s.first = 3 - firstTurn
+	}
+	return s
+}
+
+// next returns the number of the next game and the symbol moving first in it
+func (s *Series) next() (number, first int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	first = s.first
+	if s.played%2 == 1 {
+		first = 3 - s.first
+	}
+	return s.played + 1, first
+}
+
+// seriesResults are the ways a game can end without ending its series early
+var seriesResults = map[string]bool{"connect4": true, "draw": true, "resign": true, "agreed_draw": true}
+
+// record adds the result of a game to the score
+func (s *Series) record(winner, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.finished {
+		return
+	}
+	s.played++
+	switch winner {
+	case "Draw":
+		s.draws++
+	case s.Player1.Username:
+		s.wins1++
+	case s.Player2.Username:
+		s.wins2++
+	}
+
+	majority := s.BestOf/2 + 1
+	switch {
+	case reason == "forfeit" || reason == "timeout":
+		// Leaving a game, or an engine running out of time, gives up the
+		// whole series
+		s.finish(winner, reason)
+	case !seriesResults[reason]:
+		s.finish(s.leader(), reason)
+	case s.wins1 >= majority || s.wins2 >= majority:
+		s.finish(s.leader(), "clinched")
+	case s.played >= s.BestOf:
+		s.finish(s.leader(), "completed")
+	}
+}
+
+// stop ends the series early at the current score
+func (s *Series) stop(reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.finished {
+		s.finish(s.leader(), reason)
+	}
+}
+
+// finish must be called with s.mutex held
+func (s *Series) finish(winner, reason string) {
+	s.finished = true
+	s.winner = winner
+	s.reason = reason
+}
+
+// leader must be called with s.mutex held
+func (s *Series) leader() string {
+	switch {
+	case s.wins1 > s.wins2:
+		return s.Player1.Username
+	case s.wins2 > s.wins1:
+		return s.Player2.Username
+	}
+	return "Draw"
+}
+
+func (s *Series) Finished() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.finished
+}
+
+// Score reports the series as sent to players, during the given game
+func (s *Series) Score(game int) *models.SeriesScore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &models.SeriesScore{
+		SeriesID: s.ID,
+		BestOf:   s.BestOf,
+		Game:     game,
+		Wins:     map[string]int{s.Player1.Username: s.wins1, s.Player2.Username: s.wins2},
+		Draws:    s.draws,
+		Finished: s.finished,
+		Winner:   s.winner,
+	}
+}
+
+// row is the series as stored in the repository
+func (s *Series) row() db.Series {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return db.Series{
+		ID:        s.ID,
+		Player1:   s.Player1.Username,
+		Player2:   s.Player2.Username,
+		BestOf:    s.BestOf,
+		Wins1:     s.wins1,
+		Wins2:     s.wins2,
+		Draws:     s.draws,
+		Winner:    s.winner,
+		Reason:    s.reason,
+		Finished:  s.finished,
+		Rated:     s.Rated,
+		CreatedAt: s.CreatedAt,
+	}
+}
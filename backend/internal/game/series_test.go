@@ -0,0 +1,83 @@
+package game
+
+import "testing"
+
+func TestSeriesRecord(t *testing.T) {
+	type game struct{ winner, reason string }
+	tests := []struct {
+		name     string
+		bestOf   int
+		games    []game
+		finished bool
+		winner   string
+		reason   string
+	}{
+		{name: "connect4 continues", bestOf: 3, games: []game{{"alice", "connect4"}}},
+		{name: "draw continues", bestOf: 3, games: []game{{"Draw", "draw"}}},
+		{name: "resign continues", bestOf: 3, games: []game{{"bob", "resign"}}},
+		{name: "agreed draw continues", bestOf: 3, games: []game{{"Draw", "agreed_draw"}}},
+		{
+			name:     "forfeit ends it for the winner",
+			bestOf:   5,
+			games:    []game{{"alice", "connect4"}, {"alice", "connect4"}, {"bob", "forfeit"}},
+			finished: true, winner: "bob", reason: "forfeit",
+		},
+		{
+			name:     "timeout ends it for the winner",
+			bestOf:   5,
+			games:    []game{{"bob", "connect4"}, {"alice", "timeout"}},
+			finished: true, winner: "alice", reason: "timeout",
+		},
+		{
+			name:     "abandoned ends it for the leader",
+			bestOf:   5,
+			games:    []game{{"bob", "connect4"}, {"Draw", "abandoned"}},
+			finished: true, winner: "bob", reason: "abandoned",
+		},
+		{
+			name:     "shutdown at a tie",
+			bestOf:   5,
+			games:    []game{{"alice", "connect4"}, {"bob", "resign"}, {"", "shutdown"}},
+			finished: true, winner: "Draw", reason: "shutdown",
+		},
+		{
+			name:     "clinched on a majority",
+			bestOf:   5,
+			games:    []game{{"alice", "connect4"}, {"Draw", "draw"}, {"alice", "resign"}, {"alice", "connect4"}},
+			finished: true, winner: "alice", reason: "clinched",
+		},
+		{
+			name:     "completed after every game",
+			bestOf:   3,
+			games:    []game{{"alice", "connect4"}, {"Draw", "draw"}, {"Draw", "agreed_draw"}},
+			finished: true, winner: "alice", reason: "completed",
+		},
+		{
+			name:     "completed level",
+			bestOf:   2,
+			games:    []game{{"alice", "connect4"}, {"bob", "connect4"}},
+			finished: true, winner: "Draw", reason: "completed",
+		},
+		{
+			name:     "nothing counts once finished",
+			bestOf:   1,
+			games:    []game{{"bob", "connect4"}, {"alice", "connect4"}},
+			finished: true, winner: "bob", reason: "clinched",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeries(&Player{Username: "alice"}, &Player{Username: "bob"}, tt.bestOf, true)
+			for _, g := range tt.games {
+				s.record(g.winner, g.reason)
+			}
+			if s.Finished() != tt.finished {
+				t.Fatalf("finished %v, want %v", s.Finished(), tt.finished)
+			}
+			if s.winner != tt.winner || s.reason != tt.reason {
+				t.Errorf("series ended %q by %q, want %q by %q", s.winner, s.reason, tt.winner, tt.reason)
+			}
+		})
+	}
+}
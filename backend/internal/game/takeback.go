@@ -0,0 +1,102 @@
+package game
+
+import (
+	"errors"
+
+	"connectfour/pkg/models"
+)
+
+var (
+	ErrRatedGame         = errors.New("takebacks are not allowed in rated games")
+	ErrNoTakeback        = errors.New("there is no move of yours to take back")
+	ErrNoTakebackRequest = errors.New("no takeback has been requested")
+	ErrTakebackRequested = errors.New("you already asked for a takeback this move")
+)
+
+// RequestTakeback asks the opponent of symbol to let them take back their
+// last move. Against the bot, which always agrees, the player's last move is
+// taken back straight away, together with the bot's answer if it already
+// played one.
+func (g *Game) RequestTakeback(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" {
+		return ErrGameOver
+	}
+	if g.Rated {
+		return ErrRatedGame
+	}
+	opponent := g.player(3 - symbol)
+	if opponent.IsBot {
+		undo := 1
+		if g.Turn == symbol {
+			undo = 2
+		}
+		if len(g.moves) < undo {
+			return ErrNoTakeback
+		}
+		g.undo(undo, symbol)
+		return nil
+	}
+
+	// It's the opponent's turn right after our move
+	if g.Turn == symbol || len(g.moves) == 0 {
+		return ErrNoTakeback
+	}
+	if g.takebackAsked[symbol] == g.MoveCount {
+		return ErrTakebackRequested
+	}
+	g.takebackAsked[symbol] = g.MoveCount
+	g.takeback = symbol
+	g.sendTo(opponent, models.MsgTakebackRequest, models.TakebackPayload{From: g.player(symbol).Username})
+	return nil
+}
+
+// AcceptTakeback lets the opponent of symbol take back their last move
+func (g *Game) AcceptTakeback(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" || g.takeback != 3-symbol {
+		return ErrNoTakebackRequest
+	}
+	g.undo(1, 3-symbol)
+	return nil
+}
+
+// DeclineTakeback refuses the opponent's takeback request
+func (g *Game) DeclineTakeback(symbol int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != "playing" || g.takeback != 3-symbol {
+		return ErrNoTakebackRequest
+	}
+	g.takeback = 0
+	g.sendTo(g.player(3-symbol), models.MsgTakebackDecline, models.TakebackPayload{From: g.player(symbol).Username})
+	return nil
+}
+
+// undo takes back the last n moves and gives the turn to symbol.
+// Must be called with the game locked.
+func (g *Game) undo(n, symbol int) {
+	for i := 0; i < n; i++ {
+		last := len(g.moves) - 1
+		g.Board.RemoveDisc(g.moves[last])
+		g.moves = g.moves[:last]
+		g.MoveCount--
+	}
+	g.Turn = symbol
+	g.takeback = 0
+	g.drawOffer = 0
+	// Moves are replayed, so requests are counted afresh
+	g.takebackAsked = [3]int{}
+	g.drawOffered = [3]int{}
+	g.takebacks++
+	if g.OnTakeback != nil {
+		g.OnTakeback(g)
+	}
+	g.broadcastUpdate()
+	g.startMoveClock()
+}
@@ -0,0 +1,145 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// playAgainst starts a one game series in which alice, on conn, moves first
+// against opponent
+func playAgainst(t *testing.T, h *Hub, conn *websocket.Conn, opponent *Player, rated bool) *Game {
+	t.Helper()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s := newSeries(&Player{Conn: conn, Username: "alice"}, opponent, 1, rated)
+	s.first = 1
+	h.startSeries(s)
+	return h.playerGameMap[conn]
+}
+
+// awaitTurn reads updates until it is the client's turn, and returns the board
+func awaitTurn(t *testing.T, client *websocket.Conn) Board {
+	t.Helper()
+	for {
+		var update models.GameUpdatePayload
+		expect(t, client, models.MsgUpdate, &update)
+		if update.IsYourTurn {
+			return Board(update.Board)
+		}
+	}
+}
+
+// position reads the disc count and turn of a game
+func position(g *Game) (discs, turn int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.Board.DiscCount(), g.Turn
+}
+
+func TestTakebackAgainstBot(t *testing.T) {
+	t.Run("after the bot answered", func(t *testing.T) {
+		h, _ := testHub(t, config.Game{})
+		conn, client := pipe(t)
+		g := playAgainst(t, h, conn, &Player{Username: "Bot", IsBot: true}, false)
+		expect(t, client, models.MsgGameStart, nil)
+
+		h.HandleMove(conn, 3)
+		if board := awaitTurn(t, client); board.DiscCount() != 2 {
+			t.Fatalf("%d disc(s) once the bot answered, want 2", board.DiscCount())
+		}
+		if err := g.RequestTakeback(1); err != nil {
+			t.Fatal(err)
+		}
+		// The move and the bot's answer both go
+		if discs, turn := position(g); discs != 0 || turn != 1 {
+			t.Errorf("%d disc(s), turn %d after the takeback; want 0, turn 1", discs, turn)
+		}
+		if err := g.RequestTakeback(1); err != ErrNoTakeback {
+			t.Errorf("takeback with no moves = %v, want ErrNoTakeback", err)
+		}
+	})
+
+	t.Run("before the bot answered", func(t *testing.T) {
+		h, _ := testHub(t, config.Game{Bot: config.Bot{Name: "Bot", MoveDelay: 100 * time.Millisecond}})
+		conn, client := pipe(t)
+		g := playAgainst(t, h, conn, &Player{Username: "Bot", IsBot: true}, false)
+		expect(t, client, models.MsgGameStart, nil)
+
+		h.HandleMove(conn, 3)
+		if err := g.RequestTakeback(1); err != nil {
+			t.Fatal(err)
+		}
+		// The bot's answer to the position that was taken back is dropped
+		time.Sleep(200 * time.Millisecond)
+		if discs, turn := position(g); discs != 0 || turn != 1 {
+			t.Errorf("%d disc(s), turn %d after the takeback; want 0, turn 1", discs, turn)
+		}
+	})
+
+	t.Run("rated", func(t *testing.T) {
+		h, _ := testHub(t, config.Game{})
+		conn, client := pipe(t)
+		g := playAgainst(t, h, conn, &Player{Username: "Bot", IsBot: true}, true)
+		expect(t, client, models.MsgGameStart, nil)
+
+		h.HandleMove(conn, 3)
+		awaitTurn(t, client)
+		if err := g.RequestTakeback(1); err != ErrRatedGame {
+			t.Errorf("takeback in a rated game = %v, want ErrRatedGame", err)
+		}
+	})
+}
+
+func TestTakebackBetweenPlayers(t *testing.T) {
+	h, _ := testHub(t, config.Game{})
+	conn1, client1 := pipe(t)
+	conn2, client2 := pipe(t)
+	g := playAgainst(t, h, conn1, &Player{Conn: conn2, Username: "bob"}, false)
+	expect(t, client1, models.MsgGameStart, nil)
+
+	h.HandleMove(conn1, 3)
+	if err := g.RequestTakeback(2); err != ErrNoTakeback {
+		t.Errorf("takeback before moving = %v, want ErrNoTakeback", err)
+	}
+	if err := g.RequestTakeback(1); err != nil {
+		t.Fatal(err)
+	}
+	var request models.TakebackPayload
+	expect(t, client2, models.MsgTakebackRequest, &request)
+	if request.From != "alice" {
+		t.Errorf("request from %q, want alice", request.From)
+	}
+	if err := g.RequestTakeback(1); err != ErrTakebackRequested {
+		t.Errorf("second request = %v, want ErrTakebackRequested", err)
+	}
+	if err := g.AcceptTakeback(2); err != nil {
+		t.Fatal(err)
+	}
+	if discs, turn := position(g); discs != 0 || turn != 1 {
+		t.Errorf("%d disc(s), turn %d after the takeback; want 0, turn 1", discs, turn)
+	}
+
+	h.HandleMove(conn1, 2)
+	if err := g.RequestTakeback(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.DeclineTakeback(2); err != nil {
+		t.Fatal(err)
+	}
+	var decline models.TakebackPayload
+	expect(t, client1, models.MsgTakebackDecline, &decline)
+	if decline.From != "bob" {
+		t.Errorf("declined by %q, want bob", decline.From)
+	}
+	if discs, turn := position(g); discs != 1 || turn != 2 {
+		t.Errorf("%d disc(s), turn %d after the decline; want 1, turn 2", discs, turn)
+	}
+	if err := g.AcceptTakeback(2); err != ErrNoTakebackRequest {
+		t.Errorf("accept after the decline = %v, want ErrNoTakebackRequest", err)
+	}
+}
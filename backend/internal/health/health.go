@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of one dependency check
+type Result struct {
+	Status    string  `json:"status"` // "up" or "down"
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness response body
+type Report struct {
+	Status string            `json:"status"` // "ready" or "not_ready"
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every check passed
+func (r Report) Ready() bool {
+	return r.Status == "ready"
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Checker runs a set of named dependency checks concurrently
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// NewChecker creates a Checker that gives each check at most timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. fn returns nil when the dependency is usable.
+func (c *Checker) Add(name string, fn func(ctx context.Context) error) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run executes every check and builds the report
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: "ready", Checks: make(map[string]Result, len(c.checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := ch.fn(ctx)
+			res := Result{Status: "up", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status = "down"
+				res.Error = err.Error()
+			}
+
+			mutex.Lock()
+			report.Checks[ch.name] = res
+			if err != nil {
+				report.Status = "not_ready"
+			}
+			mutex.Unlock()
+		}(ch)
+	}
+	wg.Wait()
+	return report
+}
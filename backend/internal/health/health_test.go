@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("up", func(context.Context) error { return nil })
+	c.Add("down", func(context.Context) error { return errors.New("connection refused") })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %s, want it cut off by the timeout", elapsed)
+	}
+	if report.Ready() || report.Status != "not_ready" {
+		t.Errorf("status %q, want not_ready", report.Status)
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		err    string
+	}{
+		{"up", "up", ""},
+		{"down", "down", "connection refused"},
+		{"slow", "down", context.DeadlineExceeded.Error()},
+	}
+	for _, tt := range tests {
+		got, ok := report.Checks[tt.name]
+		if !ok {
+			t.Errorf("no result for %s", tt.name)
+			continue
+		}
+		if got.Status != tt.status || got.Error != tt.err {
+			t.Errorf("%s = %+v, want %s with error %q", tt.name, got, tt.status, tt.err)
+		}
+	}
+	if slow := report.Checks["slow"].LatencyMs; slow < 50 {
+		t.Errorf("slow check latency %.1fms, want at least the 50ms timeout", slow)
+	}
+
+	if report := NewChecker(time.Second).Run(context.Background()); !report.Ready() {
+		t.Errorf("status with no checks = %q, want ready", report.Status)
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "connect4"
+
+var (
+	// Connections is the number of open websocket connections
+	Connections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections.",
+	})
+
+	GamesFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "games_finished_total",
+		Help:      "Games finished, by reason (connect4, draw, forfeit, resign, timeout, ...).",
+	}, []string{"reason"})
+
+	MatchmakingWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "matchmaking_wait_seconds",
+		Help:      "Time players spent in the queue before a game started, by opponent type.",
+		Buckets:   []float64{0.5, 1, 2, 3, 5, 7.5, 10, 12.5, 15, 30, 60},
+	}, []string{"opponent"})
+
+	BotMoveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bot_move_duration_seconds",
+		Help:      "Time the bot spent choosing a move, excluding its artificial delay.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	DBWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "Latency of database writes, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+
+	DBWriteFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_write_failures_total",
+		Help:      "Failed database writes, by operation.",
+	}, []string{"op"})
+
+	KafkaPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_publish_failures_total",
+		Help:      "Event sends rejected by Kafka (the event is parked in the outbox).",
+	})
+
+	KafkaEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_events_dropped_total",
+		Help:      "Events dropped because the Kafka producer was too far behind to hold them.",
+	})
+)
+
+// WatchHub exports the hub's queue length and active game count. The
+// functions are called at scrape time.
+func WatchHub(queueLength, activeGames func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_length",
+		Help:      "Players waiting for a match on this instance.",
+	}, func() float64 { return float64(queueLength()) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_games",
+		Help:      "Games hosted by this instance that haven't finished.",
+	}, func() float64 { return float64(activeGames()) })
+}
+
+// Handler serves every metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
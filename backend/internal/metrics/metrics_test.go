@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// The hub gauges can only be registered once per process
+var (
+	watched        sync.Once
+	queued, active int
+)
+
+func TestHandlerExportsHub(t *testing.T) {
+	queued, active = 3, 2
+	watched.Do(func() {
+		WatchHub(func() int { return queued }, func() int { return active })
+	})
+	resigned := GamesFinished.WithLabelValues("resign")
+	resigned.Inc()
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+	body := scrape()
+	for _, want := range []string{
+		"connect4_queue_length 3",
+		"connect4_active_games 2",
+		fmt.Sprintf(`connect4_games_finished_total{reason="resign"} %v`, testutil.ToFloat64(resigned)),
+		"connect4_websocket_connections 0",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("scrape is missing %q", want)
+		}
+	}
+
+	// The hub is read again on every scrape
+	queued = 0
+	if body := scrape(); !strings.Contains(body, "connect4_queue_length 0\n") {
+		t.Error("queue length wasn't read at scrape time")
+	}
+}
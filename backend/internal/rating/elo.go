@@ -0,0 +1,24 @@
+// Package rating computes Elo ratings for players
+package rating
+
+import "math"
+
+const (
+	// Initial is the rating of a player before their first rated game
+	Initial = 1200.0
+	// K is the most a rating can move in one game
+	K = 32.0
+)
+
+// Expected is the score a player rated a is expected to make against a
+// player rated b, between 0 and 1
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Update returns both ratings after a game in which the first player
+// scored score: 1 for a win, 0.5 for a draw and 0 for a loss
+func Update(a, b, score float64) (float64, float64) {
+	delta := K * (score - Expected(a, b))
+	return a + delta, b - delta
+}
@@ -0,0 +1,63 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpectedIsSymmetric(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b float64
+		want float64 // Expected(a, b)
+	}{
+		{"equal", Initial, Initial, 0.5},
+		{"400 points stronger", 1600, 1200, 10.0 / 11},
+		{"400 points weaker", 1200, 1600, 1.0 / 11},
+		{"800 points stronger", 2000, 1200, 100.0 / 101},
+		{"100 points stronger", 1300, 1200, 0.6400649998},
+		{"200 points weaker", 1200, 1400, 0.2402530734},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ab, ba := Expected(tt.a, tt.b), Expected(tt.b, tt.a)
+			if math.Abs(ab+ba-1) > 1e-9 {
+				t.Errorf("Expected(a, b) + Expected(b, a) = %v, want 1", ab+ba)
+			}
+			if math.Abs(ab-tt.want) > 1e-9 {
+				t.Errorf("Expected(a, b) = %v, want %v", ab, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsTotal(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  float64
+		score float64
+	}{
+		{"win", Initial, Initial, 1},
+		{"draw", 1500, 1300, 0.5},
+		{"upset", 1100, 1900, 1},
+		{"loss", 1400, 1400, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Update(tt.a, tt.b, tt.score)
+			if math.Abs(a+b-tt.a-tt.b) > 1e-9 {
+				t.Errorf("total went from %v to %v", tt.a+tt.b, a+b)
+			}
+			// Swapping the players must give the same ratings
+			b2, a2 := Update(tt.b, tt.a, 1-tt.score)
+			if math.Abs(a-a2) > 1e-9 || math.Abs(b-b2) > 1e-9 {
+				t.Errorf("got %v/%v, swapped %v/%v", a, b, a2, b2)
+			}
+			if d := math.Abs(a - tt.a); d > K {
+				t.Errorf("moved %v, more than K", d)
+			}
+		})
+	}
+}
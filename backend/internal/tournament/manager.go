@@ -0,0 +1,578 @@
+package tournament
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/db"
+	"connectfour/internal/game"
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// Manager runs every tournament on this instance. Players take part by
+// sending TOURNAMENT_JOIN over their socket; matches start through the hub
+// as soon as both players are connected and free, and results come back
+// from the hub. Watchers get TOURNAMENT_UPDATE whenever anything changes.
+//
+// Tournaments are local to one instance: in a cluster, players must be
+// connected to the instance running the event.
+type Manager struct {
+	cfg  config.Tournament
+	hub  *game.Hub
+	repo *db.Repository
+
+	mutex       sync.Mutex
+	tournaments map[string]*Tournament
+	// Sockets of players taking part, by tournament then username, and the
+	// one username each of those sockets plays under
+	players map[string]map[string]*websocket.Conn
+	names   map[*websocket.Conn]string
+	// Sockets receiving updates, by tournament
+	watchers map[string]map[*websocket.Conn]bool
+
+	// Playing matches whose game is gone, by game ID, and since when
+	lost map[string]time.Time
+	// Results of games that ended while loop was still starting them
+	starting bool
+	orphans  map[string]game.Result
+
+	// Tournaments waiting to be saved and pushed to their watchers. They
+	// are published in the background, one batch at a time, so neither the
+	// store nor a slow socket holds up m.mutex.
+	dirty      map[string]bool
+	wake       chan struct{}
+	publishing sync.Mutex
+}
+
+// View is a tournament as served over REST and WebSocket
+type View struct {
+	Tournament
+	Matches   []Match    `json:"matches"`
+	Standings []Standing `json:"standings"`
+}
+
+func NewManager(cfg config.Tournament, hub *game.Hub, repo *db.Repository) *Manager {
+	m := &Manager{
+		cfg:         cfg,
+		hub:         hub,
+		repo:        repo,
+		tournaments: make(map[string]*Tournament),
+		players:     make(map[string]map[string]*websocket.Conn),
+		names:       make(map[*websocket.Conn]string),
+		watchers:    make(map[string]map[*websocket.Conn]bool),
+		lost:        make(map[string]time.Time),
+		orphans:     make(map[string]game.Result),
+		dirty:       make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+	}
+	m.load()
+	hub.OnResult(m.handleResult)
+	go m.publishLoop()
+	go m.loop()
+	return m
+}
+
+// load restores tournaments saved by a previous run. Matches that were
+// being played wait for their game to report back (it is restored by the
+// hub). The loop settles those whose game is gone without a result.
+func (m *Manager) load() {
+	if m.repo == nil {
+		return
+	}
+	states, err := m.repo.LoadTournaments()
+	if err != nil {
+		log.Printf("TOURNAMENT ERROR: Could not load tournaments: %v", err)
+		return
+	}
+	for _, state := range states {
+		var t Tournament
+		if err := json.Unmarshal(state, &t); err != nil {
+			log.Printf("TOURNAMENT ERROR: Bad saved tournament: %v", err)
+			continue
+		}
+		m.tournaments[t.ID] = &t
+	}
+	if len(states) > 0 {
+		log.Printf("TOURNAMENT: Restored %d tournament(s)", len(states))
+	}
+}
+
+func (m *Manager) Create(name string, format Format, rounds int) (View, error) {
+	t, err := New(name, format, rounds)
+	if err != nil {
+		return View{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.tournaments[t.ID] = t
+	m.changed(t)
+	log.Printf("🏆 Tournament created: %s", t)
+	return view(t), nil
+}
+
+// List returns every tournament, newest first, without matches
+func (m *Manager) List() []View {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	views := make([]View, 0, len(m.tournaments))
+	for _, t := range m.tournaments {
+		v := view(t)
+		v.Matches = nil
+		v.Schedule = nil
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].CreatedAt.After(views[j].CreatedAt) })
+	return views
+}
+
+func (m *Manager) Get(id string) (View, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.tournaments[id]
+	if !ok {
+		return View{}, ErrNotFound
+	}
+	return view(t), nil
+}
+
+func (m *Manager) Register(id, username string) (View, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.tournaments[id]
+	if !ok {
+		return View{}, ErrNotFound
+	}
+	if game.IsEngine(username) {
+		return View{}, game.ErrReservedName
+	}
+	if err := t.Register(username); err != nil {
+		return View{}, err
+	}
+	m.changed(t)
+	return view(t), nil
+}
+
+// Start closes registration and pairs the first round
+func (m *Manager) Start(id string) (View, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.tournaments[id]
+	if !ok {
+		return View{}, ErrNotFound
+	}
+	if err := t.Start(time.Now()); err != nil {
+		return View{}, err
+	}
+	log.Printf("🏆 Tournament started: %s with %d players", t, len(t.Players))
+	m.changed(t)
+	return view(t), nil
+}
+
+// Join attaches a player's socket to a tournament, registering them while
+// registration is open. They get updates and are put into their matches.
+// A socket plays under one name, and a name is played from one socket at a
+// time: nobody can take over the seat of a connected player.
+func (m *Manager) Join(conn *websocket.Conn, id, username string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.tournaments[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if game.IsEngine(username) {
+		return game.ErrReservedName
+	}
+	if name, bound := m.names[conn]; bound && name != username {
+		return ErrOtherName
+	}
+	for c, name := range m.names {
+		if c != conn && name == username {
+			return ErrNameInUse
+		}
+	}
+	if !t.HasPlayer(username) {
+		if err := t.Register(username); err != nil {
+			return err
+		}
+	}
+
+	if m.players[id] == nil {
+		m.players[id] = make(map[string]*websocket.Conn)
+	}
+	m.players[id][username] = conn
+	m.names[conn] = username
+	m.watch(conn, id)
+	m.changed(t)
+	return nil
+}
+
+// Watch subscribes a socket to a tournament's updates
+func (m *Manager) Watch(conn *websocket.Conn, id string) error {
+	m.mutex.Lock()
+	t, ok := m.tournaments[id]
+	if !ok {
+		m.mutex.Unlock()
+		return ErrNotFound
+	}
+	m.watch(conn, id)
+	v := view(t)
+	m.mutex.Unlock()
+
+	send(conn, v)
+	return nil
+}
+
+// watch must be called with m.mutex held
+func (m *Manager) watch(conn *websocket.Conn, id string) {
+	if m.watchers[id] == nil {
+		m.watchers[id] = make(map[*websocket.Conn]bool)
+	}
+	m.watchers[id][conn] = true
+}
+
+// HandleDisconnect forgets a closed socket
+func (m *Manager) HandleDisconnect(conn *websocket.Conn) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.names, conn)
+	for id, players := range m.players {
+		for name, c := range players {
+			if c == conn {
+				delete(players, name)
+			}
+		}
+		if len(players) == 0 {
+			delete(m.players, id)
+		}
+	}
+	for id, watchers := range m.watchers {
+		delete(watchers, conn)
+		if len(watchers) == 0 {
+			delete(m.watchers, id)
+		}
+	}
+}
+
+// start is a match whose players are both here, to be started once
+// m.mutex is released
+type start struct {
+	t      *Tournament
+	match  *Match
+	c1, c2 *websocket.Conn
+	gameID string
+}
+
+// gone is a playing match whose game ended without reporting back
+type gone struct {
+	t      *Tournament
+	match  *Match
+	gameID string
+	winner string
+	reason string
+	stored bool
+}
+
+// loop starts matches whose players are both here and settles no-shows
+// and matches whose game was lost
+func (m *Manager) loop() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mutex.Lock()
+		var starts []*start
+		var lost []*gone
+		for _, t := range m.tournaments {
+			if t.Status == StatusRunning {
+				s, l := m.tick(t)
+				starts, lost = append(starts, s...), append(lost, l...)
+			}
+		}
+		m.starting = len(starts) > 0
+		m.mutex.Unlock()
+
+		// The hub and the store are reached without m.mutex held
+		for _, s := range starts {
+			gameID, err := m.hub.StartMatch(s.c1, s.match.Player1, s.c2, s.match.Player2)
+			if err == nil {
+				s.gameID = gameID
+			}
+		}
+		for _, l := range lost {
+			if m.repo == nil {
+				continue
+			}
+			winner, reason, ok, err := m.repo.LoadGameResult(l.gameID)
+			if err != nil {
+				log.Printf("TOURNAMENT ERROR: Could not look up game %s: %v", l.gameID, err)
+			}
+			l.winner, l.reason, l.stored = winner, reason, ok
+		}
+
+		m.mutex.Lock()
+		for _, s := range starts {
+			m.started(s)
+		}
+		for _, l := range lost {
+			m.settleLost(l)
+		}
+		m.starting = false
+		clear(m.orphans)
+		m.mutex.Unlock()
+	}
+}
+
+// tick settles no-shows and picks the matches to start and the ones whose
+// game is lost. Must be called with m.mutex held.
+func (m *Manager) tick(t *Tournament) ([]*start, []*gone) {
+	now := time.Now()
+	changed := false
+	var starts []*start
+	var lost []*gone
+
+	// Finishing a match can add matches, so walk a snapshot
+	for _, match := range append([]*Match(nil), t.Matches...) {
+		if match.Status == MatchPlaying {
+			if l := m.checkGame(t, match, now); l != nil {
+				lost = append(lost, l)
+			}
+			continue
+		}
+		if match.Status != MatchPending {
+			continue
+		}
+		c1 := m.players[t.ID][match.Player1]
+		c2 := m.players[t.ID][match.Player2]
+
+		if c1 != nil && c2 != nil {
+			// Starting can fail while one is finishing another game, and
+			// nobody is a no-show while both are here
+			starts = append(starts, &start{t: t, match: match, c1: c1, c2: c2})
+			continue
+		}
+		if now.Sub(match.ReadyAt) < m.cfg.NoShowAfter {
+			continue
+		}
+		winner := m.present(t, match)
+		log.Printf("🏆 %s: no-show in %s vs %s, winner %q", t.Name, match.Player1, match.Player2, winner)
+		t.Finish(match, winner, "no_show", now)
+		changed = true
+	}
+
+	if changed {
+		m.changed(t)
+	}
+	return starts, lost
+}
+
+// present returns whichever player of a match is here, or nobody if both or
+// neither are. Must be called with m.mutex held.
+func (m *Manager) present(t *Tournament, match *Match) string {
+	c1 := m.players[t.ID][match.Player1]
+	c2 := m.players[t.ID][match.Player2]
+	switch {
+	case c1 != nil && c2 == nil:
+		return match.Player1
+	case c2 != nil && c1 == nil:
+		return match.Player2
+	}
+	return ""
+}
+
+// checkGame notices a playing match whose game is gone. Its result may still
+// be on the way, so it only counts as lost after NoShowAfter.
+// Must be called with m.mutex held.
+func (m *Manager) checkGame(t *Tournament, match *Match, now time.Time) *gone {
+	if m.hub.HasGame(match.GameID) {
+		delete(m.lost, match.GameID)
+		return nil
+	}
+	since, seen := m.lost[match.GameID]
+	if !seen {
+		m.lost[match.GameID] = now
+		return nil
+	}
+	if now.Sub(since) < m.cfg.NoShowAfter {
+		return nil
+	}
+	delete(m.lost, match.GameID)
+	return &gone{t: t, match: match, gameID: match.GameID}
+}
+
+// started records a match the hub started, along with its result if the
+// game is already over. Must be called with m.mutex held.
+func (m *Manager) started(s *start) {
+	if s.gameID == "" || s.match.Status != MatchPending {
+		return
+	}
+	s.match.Status = MatchPlaying
+	s.match.GameID = s.gameID
+	log.Printf("🏆 %s round %d: %s vs %s (game %s)", s.t.Name, s.match.Round, s.match.Player1, s.match.Player2, s.gameID)
+	if r, ok := m.orphans[s.gameID]; ok {
+		m.record(s.t, s.match, r)
+		return
+	}
+	m.changed(s.t)
+}
+
+// settleLost ends a match whose game is gone with the result stored for it.
+// Without one, a player who is here wins, and if both are the match is
+// played again. Must be called with m.mutex held.
+func (m *Manager) settleLost(l *gone) {
+	match := l.match
+	if match.Status != MatchPlaying || match.GameID != l.gameID {
+		return // Its result came in after all
+	}
+	now := time.Now()
+	if l.stored {
+		log.Printf("🏆 %s: %s vs %s -> %s (%s), from the stored game", l.t.Name, match.Player1, match.Player2, l.winner, l.reason)
+		l.t.Finish(match, l.winner, l.reason, now)
+		m.changed(l.t)
+		return
+	}
+
+	c1 := m.players[l.t.ID][match.Player1]
+	c2 := m.players[l.t.ID][match.Player2]
+	if c1 != nil && c2 != nil {
+		log.Printf("🏆 %s: game %s of %s vs %s was lost, replaying it", l.t.Name, l.gameID, match.Player1, match.Player2)
+		match.Status = MatchPending
+		match.GameID = ""
+		match.ReadyAt = now
+	} else {
+		winner := m.present(l.t, match)
+		log.Printf("🏆 %s: game %s of %s vs %s was lost, winner %q", l.t.Name, l.gameID, match.Player1, match.Player2, winner)
+		l.t.Finish(match, winner, "no_show", now)
+	}
+	m.changed(l.t)
+}
+
+func (m *Manager) handleResult(r game.Result) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, t := range m.tournaments {
+		if match := t.MatchForGame(r.GameID); match != nil {
+			m.record(t, match, r)
+			return
+		}
+	}
+	// One of the matches loop is starting, which it will pick up
+	if m.starting {
+		m.orphans[r.GameID] = r
+	}
+}
+
+// record must be called with m.mutex held
+func (m *Manager) record(t *Tournament, match *Match, r game.Result) {
+	delete(m.lost, r.GameID)
+	t.Finish(match, r.Winner, r.Reason, time.Now())
+	log.Printf("🏆 %s: %s vs %s -> %s (%s)", t.Name, match.Player1, match.Player2, r.Winner, r.Reason)
+	m.changed(t)
+}
+
+// changed queues a tournament to be saved and pushed to its watchers.
+// Must be called with m.mutex held.
+func (m *Manager) changed(t *Tournament) {
+	if t.Status == StatusFinished {
+		log.Printf("🏆 Tournament finished: %s, winner %q", t, t.Winner)
+	}
+	m.dirty[t.ID] = true
+	select {
+	case m.wake <- struct{}{}:
+	default: // A publish is already due
+	}
+}
+
+// publishLoop publishes changed tournaments as they come in
+func (m *Manager) publishLoop() {
+	for range m.wake {
+		m.publish()
+	}
+}
+
+// publish saves every changed tournament and sends it to its watchers, as it
+// stands now
+func (m *Manager) publish() {
+	m.publishing.Lock()
+	defer m.publishing.Unlock()
+
+	type update struct {
+		t        *Tournament
+		state    []byte
+		finished bool
+		view     View
+		watchers []*websocket.Conn
+	}
+	m.mutex.Lock()
+	var updates []update
+	for id := range m.dirty {
+		t := m.tournaments[id]
+		state, err := json.Marshal(t)
+		if err != nil {
+			continue
+		}
+		u := update{t: t, state: state, finished: t.Status == StatusFinished, view: view(t)}
+		for conn := range m.watchers[id] {
+			u.watchers = append(u.watchers, conn)
+		}
+		updates = append(updates, u)
+	}
+	clear(m.dirty)
+	m.mutex.Unlock()
+
+	for _, u := range updates {
+		if m.repo != nil {
+			if err := m.repo.SaveTournament(u.t.ID, u.state, u.finished); err != nil {
+				log.Printf("TOURNAMENT ERROR: Could not save %s: %v", u.t, err)
+			}
+		}
+		for _, conn := range u.watchers {
+			send(conn, u.view)
+		}
+	}
+}
+
+// Shutdown saves whatever changed since the last publish. Call it after the
+// hub has shut down, so every result is in.
+func (m *Manager) Shutdown() {
+	m.publish()
+}
+
+func send(conn *websocket.Conn, v View) {
+	game.WriteJSON(conn, models.WSMessage{Type: models.MsgTournamentUpdate, Payload: v})
+}
+
+// view copies a tournament so it can be encoded without the lock
+func view(t *Tournament) View {
+	v := View{Tournament: *t, Standings: t.Standings()}
+	v.Players = append([]string(nil), t.Players...)
+	v.Matches = make([]Match, len(t.Matches))
+	for i, match := range t.Matches {
+		v.Matches[i] = *match
+	}
+	v.Tournament.Matches = nil
+	return v
+}
+
+// ParseFormat accepts the format names used in the API
+func ParseFormat(s string) (Format, error) {
+	f := Format(s)
+	switch f {
+	case RoundRobin, Swiss, SingleElimination, DoubleElimination:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w, got %q", ErrBadFormat, s)
+}
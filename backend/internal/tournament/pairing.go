@@ -0,0 +1,119 @@
+package tournament
+
+// roundRobinSchedule pairs everyone with everyone using the circle method.
+// With an odd number of players, the player paired with "" has a bye.
+// Colors alternate from round to round so nobody always moves first.
+func roundRobinSchedule(players []string) [][][2]string {
+	ring := append([]string(nil), players...)
+	if len(ring)%2 == 1 {
+		ring = append(ring, "")
+	}
+	n := len(ring)
+
+	rounds := make([][][2]string, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		var pairs [][2]string
+		for i := 0; i < n/2; i++ {
+			a, b := ring[i], ring[n-1-i]
+			if (r+i)%2 == 1 {
+				a, b = b, a
+			}
+			pairs = append(pairs, [2]string{a, b})
+		}
+		rounds = append(rounds, pairs)
+
+		// Keep the first player fixed and rotate the rest
+		last := ring[n-1]
+		copy(ring[2:], ring[1:n-1])
+		ring[1] = last
+	}
+	return rounds
+}
+
+// swissPairs pairs players with similar scores who haven't met yet. The
+// lowest ranked player without a bye so far sits out when the count is odd.
+func swissPairs(standings []Standing, played map[[2]string]bool, hadBye map[string]bool) [][2]string {
+	var pairs [][2]string
+	ranked := make([]string, 0, len(standings))
+	for _, s := range standings {
+		ranked = append(ranked, s.Player)
+	}
+
+	if len(ranked)%2 == 1 {
+		bye := len(ranked) - 1
+		for i := len(ranked) - 1; i >= 0; i-- {
+			if !hadBye[ranked[i]] {
+				bye = i
+				break
+			}
+		}
+		pairs = append(pairs, [2]string{ranked[bye], ""})
+		ranked = append(ranked[:bye], ranked[bye+1:]...)
+	}
+
+	paired := make([]bool, len(ranked))
+	for i := range ranked {
+		if paired[i] {
+			continue
+		}
+		// Closest score first; a rematch only if nobody else is left
+		opponent := -1
+		for j := i + 1; j < len(ranked); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent == -1 {
+				opponent = j
+			}
+			if !played[[2]string{ranked[i], ranked[j]}] {
+				opponent = j
+				break
+			}
+		}
+		if opponent == -1 {
+			continue
+		}
+		paired[i], paired[opponent] = true, true
+		pairs = append(pairs, [2]string{ranked[i], ranked[opponent]})
+	}
+	return pairs
+}
+
+// eliminationPairs pairs the surviving players of an elimination event.
+// Players are grouped by losses (the winners bracket has none, the losers
+// bracket one) and paired within their group, top seed against bottom seed.
+// A player alone in their group waits for the other group to play down, and
+// when each group has one player left they meet in the final. If the losers
+// bracket player wins it, both have one loss and the final is replayed.
+func eliminationPairs(alive []Standing) [][2]string {
+	if len(alive) < 2 {
+		return nil
+	}
+
+	groups := map[int][]string{}
+	var losses []int
+	for _, s := range alive {
+		if _, ok := groups[s.Losses]; !ok {
+			losses = append(losses, s.Losses)
+		}
+		groups[s.Losses] = append(groups[s.Losses], s.Player)
+	}
+
+	// Final: one player left in each bracket
+	if len(losses) == 2 && len(groups[losses[0]]) == 1 && len(groups[losses[1]]) == 1 {
+		return [][2]string{{groups[losses[0]][0], groups[losses[1]][0]}}
+	}
+
+	var pairs [][2]string
+	for _, l := range losses {
+		group := groups[l]
+		// With an odd group the top seed waits a round
+		if len(group)%2 == 1 {
+			group = group[1:]
+		}
+		for i := 0; i < len(group)/2; i++ {
+			pairs = append(pairs, [2]string{group[i], group[len(group)-1-i]})
+		}
+	}
+	return pairs
+}
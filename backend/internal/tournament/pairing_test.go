@@ -0,0 +1,238 @@
+package tournament
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func standings(players ...string) []Standing {
+	rows := make([]Standing, len(players))
+	for i, p := range players {
+		rows[i] = Standing{Player: p}
+	}
+	return rows
+}
+
+func TestSwissPairs(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranked []string
+		played [][2]string
+		hadBye []string
+		want   [][2]string
+	}{
+		{
+			name:   "closest scores",
+			ranked: []string{"a", "b", "c", "d"},
+			want:   [][2]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:   "avoids a rematch",
+			ranked: []string{"a", "b", "c", "d"},
+			played: [][2]string{{"a", "b"}},
+			want:   [][2]string{{"a", "c"}, {"b", "d"}},
+		},
+		{
+			name:   "rematch when nobody else is left",
+			ranked: []string{"a", "b"},
+			played: [][2]string{{"b", "a"}},
+			want:   [][2]string{{"a", "b"}},
+		},
+		{
+			name:   "bye for the lowest ranked",
+			ranked: []string{"a", "b", "c"},
+			want:   [][2]string{{"c", ""}, {"a", "b"}},
+		},
+		{
+			name:   "no second bye",
+			ranked: []string{"a", "b", "c"},
+			hadBye: []string{"c"},
+			want:   [][2]string{{"b", ""}, {"a", "c"}},
+		},
+		{
+			name:   "everyone had a bye",
+			ranked: []string{"a", "b", "c"},
+			hadBye: []string{"a", "b", "c"},
+			want:   [][2]string{{"c", ""}, {"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			played := map[[2]string]bool{}
+			for _, p := range tt.played {
+				played[p] = true
+				played[[2]string{p[1], p[0]}] = true
+			}
+			hadBye := map[string]bool{}
+			for _, p := range tt.hadBye {
+				hadBye[p] = true
+			}
+			got := swissPairs(standings(tt.ranked...), played, hadBye)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEliminationPairs(t *testing.T) {
+	tests := []struct {
+		name  string
+		alive []Standing
+		want  [][2]string
+	}{
+		{
+			name:  "top seed against bottom seed",
+			alive: standings("a", "b", "c", "d"),
+			want:  [][2]string{{"a", "d"}, {"b", "c"}},
+		},
+		{
+			name:  "top seed waits in an odd group",
+			alive: standings("a", "b", "c"),
+			want:  [][2]string{{"b", "c"}},
+		},
+		{
+			name:  "brackets paired separately",
+			alive: []Standing{{Player: "a"}, {Player: "b"}, {Player: "c", Losses: 1}, {Player: "d", Losses: 1}},
+			want:  [][2]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:  "final between the brackets",
+			alive: []Standing{{Player: "a"}, {Player: "b", Losses: 1}},
+			want:  [][2]string{{"a", "b"}},
+		},
+		{
+			name:  "lone player waits for the other bracket",
+			alive: []Standing{{Player: "a"}, {Player: "b", Losses: 1}, {Player: "c", Losses: 1}},
+			want:  [][2]string{{"b", "c"}},
+		},
+		{
+			name:  "champion",
+			alive: standings("a"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eliminationPairs(tt.alive); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// play runs a tournament to the end. Player1 of each match wins, except
+// for the matches draw picks.
+func play(t *testing.T, tour *Tournament, draw func(*Match) bool) {
+	t.Helper()
+	now := time.Now()
+	for guard := 0; tour.Status == StatusRunning; guard++ {
+		if guard > 100 {
+			t.Fatal("tournament never ends")
+		}
+		for _, m := range tour.Matches {
+			if m.Status != MatchPending {
+				continue
+			}
+			winner := m.Player1
+			if draw != nil && draw(m) {
+				winner = Draw
+			}
+			tour.Finish(m, winner, "connect4", now)
+			break // Finish may have added matches
+		}
+	}
+}
+
+func TestTournamentByesAndRematches(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    Format
+		rounds    int
+		players   []string
+		draw      func(*Match) bool
+		byes      map[string]int // Byes per player, if checked
+		rematches int            // Pairings played more than once, -1 if not checked
+		winner    string
+	}{
+		{
+			name:    "swiss without rematches",
+			format:  Swiss,
+			rounds:  3,
+			players: []string{"a", "b", "c", "d"},
+			winner:  "a",
+		},
+		{
+			name:      "swiss gives one bye each",
+			format:    Swiss,
+			rounds:    5,
+			players:   []string{"a", "b", "c", "d", "e"},
+			byes:      map[string]int{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1},
+			rematches: -1,
+		},
+		{
+			name:    "single elimination with an odd field",
+			format:  SingleElimination,
+			players: []string{"a", "b", "c"},
+			byes:    map[string]int{},
+			winner:  "a",
+		},
+		{
+			name:      "drawn elimination match is replayed",
+			format:    SingleElimination,
+			players:   []string{"a", "b"},
+			draw:      func(m *Match) bool { return m.Player1 == "a" },
+			rematches: 1,
+			winner:    "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tour, err := New("test", tt.format, tt.rounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range tt.players {
+				if err := tour.Register(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tour.Start(time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			play(t, tour, tt.draw)
+
+			byes := map[string]int{}
+			meetings := map[[2]string]int{}
+			for _, m := range tour.Matches {
+				if m.Reason == "bye" {
+					byes[m.Player1]++
+					continue
+				}
+				pair := [2]string{m.Player1, m.Player2}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				meetings[pair]++
+			}
+			rematches := 0
+			for _, n := range meetings {
+				rematches += n - 1
+			}
+
+			if tt.byes != nil && !maps.Equal(byes, tt.byes) {
+				t.Errorf("byes %v, want %v", byes, tt.byes)
+			}
+			if tt.rematches >= 0 && rematches != tt.rematches {
+				t.Errorf("%d rematch(es), want %d", rematches, tt.rematches)
+			}
+			if tt.winner != "" && tour.Winner != tt.winner {
+				t.Errorf("winner %q, want %q", tour.Winner, tt.winner)
+			}
+		})
+	}
+}
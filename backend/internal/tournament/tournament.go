@@ -0,0 +1,390 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	RoundRobin        Format = "round_robin"
+	Swiss             Format = "swiss"
+	SingleElimination Format = "single_elimination"
+	DoubleElimination Format = "double_elimination"
+)
+
+type Status string
+
+const (
+	StatusRegistering Status = "registering"
+	StatusRunning     Status = "running"
+	StatusFinished    Status = "finished"
+)
+
+type MatchStatus string
+
+const (
+	MatchPending  MatchStatus = "pending" // Waiting for both players to be connected
+	MatchPlaying  MatchStatus = "playing"
+	MatchFinished MatchStatus = "finished"
+)
+
+// Draw is the winner of a drawn match, as in game results
+const Draw = "Draw"
+
+var (
+	ErrNotFound       = errors.New("tournament not found")
+	ErrNotRegistering = errors.New("registration is closed")
+	ErrAlreadyJoined  = errors.New("player is already registered")
+	ErrTooFewPlayers  = errors.New("at least two players are needed")
+	ErrBadFormat      = errors.New("format must be round_robin, swiss, single_elimination or double_elimination")
+	ErrNameInUse      = errors.New("player is already connected from another socket")
+	ErrOtherName      = errors.New("this connection already plays under another name")
+)
+
+// Match is one pairing. Player2 is empty for a bye.
+type Match struct {
+	ID      string      `json:"id"`
+	Round   int         `json:"round"`
+	Player1 string      `json:"player1"` // Moves first
+	Player2 string      `json:"player2,omitempty"`
+	Status  MatchStatus `json:"status"`
+	GameID  string      `json:"gameId,omitempty"`
+	Winner  string      `json:"winner,omitempty"` // Username, Draw, or empty when both no-showed
+	Reason  string      `json:"reason,omitempty"`
+	ReadyAt time.Time   `json:"readyAt"` // When the pairing was made, for no-shows
+}
+
+// Tournament is the whole state of one event. It is persisted as JSON, so
+// every field that matters after a restart is exported.
+type Tournament struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Format    Format    `json:"format"`
+	Status    Status    `json:"status"`
+	Players   []string  `json:"players"` // In seed order (registration order)
+	Rounds    int       `json:"rounds"`  // Planned rounds, 0 for elimination formats
+	Round     int       `json:"round"`   // Current round, 1-based
+	Matches   []*Match  `json:"matches"`
+	Winner    string    `json:"winner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Round robin pairings, generated when the event starts
+	Schedule [][][2]string `json:"schedule,omitempty"`
+}
+
+// Standing is one row of the table
+type Standing struct {
+	Player     string  `json:"player"`
+	Points     float64 `json:"points"` // 1 per win or bye, 0.5 per draw
+	Wins       int     `json:"wins"`
+	Draws      int     `json:"draws"`
+	Losses     int     `json:"losses"`
+	Played     int     `json:"played"`
+	Buchholz   float64 `json:"buchholz"` // Sum of opponents' points, the tie-break
+	Eliminated bool    `json:"eliminated,omitempty"`
+}
+
+func New(name string, format Format, rounds int) (*Tournament, error) {
+	switch format {
+	case RoundRobin, Swiss, SingleElimination, DoubleElimination:
+	default:
+		return nil, ErrBadFormat
+	}
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if rounds < 0 {
+		return nil, errors.New("rounds must not be negative")
+	}
+	return &Tournament{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Format:    format,
+		Status:    StatusRegistering,
+		Players:   []string{},
+		Matches:   []*Match{},
+		Rounds:    rounds,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (t *Tournament) Register(username string) error {
+	if t.Status != StatusRegistering {
+		return ErrNotRegistering
+	}
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if t.HasPlayer(username) {
+		return ErrAlreadyJoined
+	}
+	t.Players = append(t.Players, username)
+	return nil
+}
+
+func (t *Tournament) HasPlayer(username string) bool {
+	return slices.Contains(t.Players, username)
+}
+
+// Start closes registration and pairs the first round
+func (t *Tournament) Start(now time.Time) error {
+	if t.Status != StatusRegistering {
+		return ErrNotRegistering
+	}
+	if len(t.Players) < 2 {
+		return ErrTooFewPlayers
+	}
+	t.Status = StatusRunning
+
+	switch t.Format {
+	case RoundRobin:
+		t.Schedule = roundRobinSchedule(t.Players)
+		t.Rounds = len(t.Schedule)
+	case Swiss:
+		if t.Rounds == 0 {
+			t.Rounds = int(math.Ceil(math.Log2(float64(len(t.Players)))))
+		}
+	case SingleElimination, DoubleElimination:
+		t.Rounds = 0
+	}
+	t.nextRound(now)
+	return nil
+}
+
+// lossLimit is how many losses knock a player out, 0 when nobody is
+func (t *Tournament) lossLimit() int {
+	switch t.Format {
+	case SingleElimination:
+		return 1
+	case DoubleElimination:
+		return 2
+	}
+	return 0
+}
+
+// MatchForGame finds the match being played in a game
+func (t *Tournament) MatchForGame(gameID string) *Match {
+	for _, m := range t.Matches {
+		if m.GameID == gameID {
+			return m
+		}
+	}
+	return nil
+}
+
+// Finish records the result of a match and moves the event on when the
+// round is complete. Drawn elimination matches are replayed with colors
+// swapped, since someone has to go through.
+func (t *Tournament) Finish(m *Match, winner, reason string, now time.Time) {
+	if m.Status == MatchFinished {
+		return
+	}
+	m.Status = MatchFinished
+	m.Winner = winner
+	m.Reason = reason
+
+	if winner == Draw && t.lossLimit() > 0 {
+		t.addMatch(m.Player2, m.Player1, now)
+	}
+	if t.roundComplete() {
+		t.nextRound(now)
+	}
+}
+
+func (t *Tournament) roundComplete() bool {
+	for _, m := range t.Matches {
+		if m.Round == t.Round && m.Status != MatchFinished {
+			return false
+		}
+	}
+	return true
+}
+
+// nextRound pairs the next round, or ends the event if there is none
+func (t *Tournament) nextRound(now time.Time) {
+	var pairs [][2]string
+	switch t.Format {
+	case RoundRobin:
+		if t.Round < len(t.Schedule) {
+			pairs = t.Schedule[t.Round]
+		}
+	case Swiss:
+		if t.Round < t.Rounds {
+			pairs = swissPairs(t.Standings(), t.playedPairs(), t.hadBye())
+		}
+	case SingleElimination, DoubleElimination:
+		pairs = eliminationPairs(t.alive())
+	}
+
+	if len(pairs) == 0 {
+		t.finish()
+		return
+	}
+
+	t.Round++
+	for _, p := range pairs {
+		t.addMatch(p[0], p[1], now)
+	}
+	// A round made only of byes is already over
+	if t.roundComplete() {
+		t.nextRound(now)
+	}
+}
+
+func (t *Tournament) addMatch(p1, p2 string, now time.Time) {
+	m := &Match{ID: uuid.New().String(), Round: t.Round, Player1: p1, Player2: p2, Status: MatchPending, ReadyAt: now}
+	if p1 == "" {
+		m.Player1, m.Player2 = p2, ""
+	}
+	if m.Player2 == "" {
+		m.Status = MatchFinished
+		m.Winner = m.Player1
+		m.Reason = "bye"
+	}
+	t.Matches = append(t.Matches, m)
+}
+
+func (t *Tournament) finish() {
+	t.Status = StatusFinished
+	if limit := t.lossLimit(); limit > 0 {
+		if alive := t.alive(); len(alive) == 1 {
+			t.Winner = alive[0].Player
+		}
+		return
+	}
+	if standings := t.Standings(); len(standings) > 0 && standings[0].Played > 0 {
+		t.Winner = standings[0].Player
+	}
+}
+
+// alive returns the players still in an elimination event, in seed order,
+// with their standings
+func (t *Tournament) alive() []Standing {
+	bySeed := map[string]Standing{}
+	for _, s := range t.Standings() {
+		bySeed[s.Player] = s
+	}
+	var alive []Standing
+	for _, p := range t.Players {
+		if s := bySeed[p]; !s.Eliminated {
+			alive = append(alive, s)
+		}
+	}
+	return alive
+}
+
+func (t *Tournament) playedPairs() map[[2]string]bool {
+	played := map[[2]string]bool{}
+	for _, m := range t.Matches {
+		if m.Player2 != "" {
+			played[[2]string{m.Player1, m.Player2}] = true
+			played[[2]string{m.Player2, m.Player1}] = true
+		}
+	}
+	return played
+}
+
+func (t *Tournament) hadBye() map[string]bool {
+	byes := map[string]bool{}
+	for _, m := range t.Matches {
+		if m.Reason == "bye" {
+			byes[m.Player1] = true
+		}
+	}
+	return byes
+}
+
+// Standings ranks players by points, then Buchholz, then wins, then seed.
+// Elimination events rank surviving players first.
+func (t *Tournament) Standings() []Standing {
+	rows := map[string]*Standing{}
+	seed := map[string]int{}
+	for i, p := range t.Players {
+		rows[p] = &Standing{Player: p}
+		seed[p] = i
+	}
+	opponents := map[string][]string{}
+
+	for _, m := range t.Matches {
+		if m.Status != MatchFinished {
+			continue
+		}
+		a, b := rows[m.Player1], rows[m.Player2]
+		if a == nil {
+			continue
+		}
+		if m.Reason == "bye" {
+			a.Points++
+			a.Wins++
+			continue
+		}
+		if b == nil {
+			continue
+		}
+		a.Played++
+		b.Played++
+		opponents[a.Player] = append(opponents[a.Player], b.Player)
+		opponents[b.Player] = append(opponents[b.Player], a.Player)
+
+		switch m.Winner {
+		case Draw:
+			a.Points += 0.5
+			b.Points += 0.5
+			a.Draws++
+			b.Draws++
+		case a.Player:
+			a.Points++
+			a.Wins++
+			b.Losses++
+		case b.Player:
+			b.Points++
+			b.Wins++
+			a.Losses++
+		default: // Neither showed up
+			a.Losses++
+			b.Losses++
+		}
+	}
+
+	limit := t.lossLimit()
+	standings := make([]Standing, 0, len(rows))
+	for _, p := range t.Players {
+		s := rows[p]
+		for _, o := range opponents[p] {
+			s.Buchholz += rows[o].Points
+		}
+		s.Eliminated = limit > 0 && s.Losses >= limit
+		standings = append(standings, *s)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return seed[a.Player] < seed[b.Player]
+	})
+	return standings
+}
+
+// String is used in logs
+func (t *Tournament) String() string {
+	return fmt.Sprintf("%s (%s, %s)", t.Name, t.Format, t.ID)
+}
@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"connectfour/internal/config"
+	"connectfour/internal/db"
+	"connectfour/internal/event"
+
+	"github.com/google/uuid"
+)
+
+const queueSize = 1024 // Deliveries waiting for a worker
+
+// Dispatcher delivers game events to the webhook subscriptions stored in the
+// database. It is an event sink, so it sees every event the hub emits.
+// Every attempt is recorded in the delivery log; failed ones are retried
+// with exponential backoff.
+type Dispatcher struct {
+	cfg    config.Webhooks
+	repo   *db.Repository
+	client *http.Client
+
+	// Active subscriptions, reloaded on changes and periodically
+	hooksMutex sync.RWMutex
+	hooks      []db.Webhook
+
+	jobs    chan *delivery
+	workers sync.WaitGroup
+	stop    chan struct{}
+
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+// delivery is one event on its way to one webhook
+type delivery struct {
+	hook    db.Webhook
+	id      string
+	event   event.EventType
+	gameID  string
+	body    []byte
+	attempt int
+}
+
+func NewDispatcher(cfg config.Webhooks, repo *db.Repository) *Dispatcher {
+	d := &Dispatcher{
+		cfg:    cfg,
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout},
+		jobs:   make(chan *delivery, queueSize),
+		stop:   make(chan struct{}),
+	}
+	if err := d.Reload(); err != nil {
+		log.Printf("WEBHOOK ERROR: Could not load subscriptions: %v", err)
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+	go d.refreshLoop()
+	return d
+}
+
+// Reload picks up subscription changes from the database
+func (d *Dispatcher) Reload() error {
+	hooks, err := d.repo.ListWebhooks()
+	if err != nil {
+		return err
+	}
+	active := hooks[:0]
+	for _, h := range hooks {
+		if h.Active {
+			active = append(active, h)
+		}
+	}
+	d.hooksMutex.Lock()
+	d.hooks = active
+	d.hooksMutex.Unlock()
+	return nil
+}
+
+func (d *Dispatcher) refreshLoop() {
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Reload(); err != nil {
+				log.Printf("WEBHOOK ERROR: Could not reload subscriptions: %v", err)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Emit queues the event for every subscription whose filter matches it
+func (d *Dispatcher) Emit(e event.GameEvent) {
+	event.Stamp(&e)
+
+	d.hooksMutex.RLock()
+	var matched []db.Webhook
+	for _, h := range d.hooks {
+		if subscribed(h, e.Event) {
+			matched = append(matched, h)
+		}
+	}
+	d.hooksMutex.RUnlock()
+	if len(matched) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("WEBHOOK ERROR: Could not encode %s event: %v", e.Event, err)
+		return
+	}
+	for _, h := range matched {
+		d.enqueue(&delivery{hook: h, id: uuid.New().String(), event: e.Event, gameID: e.GameID, body: body, attempt: 1})
+	}
+}
+
+// Test sends a PING delivery to one webhook, whatever its filter
+func (d *Dispatcher) Test(h db.Webhook) string {
+	body, _ := json.Marshal(map[string]interface{}{"event": "PING", "timestamp": time.Now().UTC()})
+	job := &delivery{hook: h, id: uuid.New().String(), event: "PING", body: body, attempt: 1}
+	d.enqueue(job)
+	return job.id
+}
+
+func subscribed(h db.Webhook, t event.EventType) bool {
+	return slices.Contains(h.Events, "*") || slices.Contains(h.Events, string(t))
+}
+
+func (d *Dispatcher) enqueue(job *delivery) {
+	d.closeMutex.RLock()
+	defer d.closeMutex.RUnlock()
+
+	if d.closed {
+		log.Printf("WEBHOOK: Shutting down, dropped %s delivery %s to %s", job.event, job.id, job.hook.URL)
+		return
+	}
+	select {
+	case d.jobs <- job:
+	default:
+		log.Printf("WEBHOOK ERROR: Queue full, dropped %s delivery %s to %s", job.event, job.id, job.hook.URL)
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for job := range d.jobs {
+		d.attempt(job)
+	}
+}
+
+// attempt makes one delivery attempt, logs it and schedules a retry if it
+// failed in a way worth retrying
+func (d *Dispatcher) attempt(job *delivery) {
+	start := time.Now()
+	status, err := d.post(job)
+
+	entry := db.WebhookDelivery{
+		WebhookID:  job.hook.ID,
+		DeliveryID: job.id,
+		Event:      string(job.event),
+		GameID:     job.gameID,
+		Attempt:    job.attempt,
+		StatusCode: status,
+		Success:    err == nil,
+		DurationMs: int(time.Since(start).Milliseconds()),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if logErr := d.repo.LogWebhookDelivery(entry); logErr != nil {
+		log.Printf("WEBHOOK ERROR: Could not log delivery %s: %v", job.id, logErr)
+	}
+	if err == nil {
+		return
+	}
+
+	if !retryable(status) || job.attempt >= d.cfg.MaxAttempts {
+		log.Printf("WEBHOOK ERROR: Giving up on %s delivery %s to %s after %d attempt(s): %v", job.event, job.id, job.hook.URL, job.attempt, err)
+		return
+	}
+
+	backoff := d.cfg.InitialBackoff << (job.attempt - 1)
+	job.attempt++
+	time.AfterFunc(backoff, func() { d.enqueue(job) })
+}
+
+// retryable is false for client errors other than timeouts and rate limits,
+// which won't go away by sending the same request again
+func retryable(status int) bool {
+	if status == http.StatusRequestTimeout || status == http.StatusTooManyRequests {
+		return true
+	}
+	return status < 400 || status >= 500
+}
+
+func (d *Dispatcher) post(job *delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, job.hook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "connect4-webhooks")
+	req.Header.Set("X-Connect4-Event", string(job.event))
+	req.Header.Set("X-Connect4-Delivery", job.id)
+	req.Header.Set("X-Connect4-Attempt", strconv.Itoa(job.attempt))
+	req.Header.Set(SignatureHeader, Sign(job.hook.Secret, time.Now(), job.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, &statusError{resp.Status}
+	}
+	return resp.StatusCode, nil
+}
+
+type statusError struct{ status string }
+
+func (e *statusError) Error() string { return "receiver answered " + e.status }
+
+// Close finishes the deliveries already queued. Retries still waiting for
+// their backoff are dropped (their failed attempts stay in the log).
+func (d *Dispatcher) Close() {
+	d.closeMutex.Lock()
+	if d.closed {
+		d.closeMutex.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.stop)
+	close(d.jobs)
+	d.closeMutex.Unlock()
+
+	d.workers.Wait()
+}
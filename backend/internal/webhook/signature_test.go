@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"event":"game_over","gameId":"g1"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		header  string
+		secret  string
+		body    []byte
+		wantErr string
+	}{
+		{name: "round trip", header: Sign(secret, now, body), secret: secret, body: body},
+		{name: "within tolerance", header: Sign(secret, now.Add(-4*time.Minute), body), secret: secret, body: body},
+		{name: "tampered body", header: Sign(secret, now, body), secret: secret, body: []byte(`{"event":"game_over","gameId":"g2"}`), wantErr: "mismatch"},
+		{name: "wrong secret", header: Sign(secret, now, body), secret: "other", body: body, wantErr: "mismatch"},
+		{
+			name:    "tampered timestamp",
+			header:  retime(Sign(secret, now, body), now.Add(-time.Hour)),
+			secret:  secret,
+			body:    body,
+			wantErr: "outside tolerance",
+		},
+		{
+			name:    "timestamp moved within tolerance",
+			header:  retime(Sign(secret, now, body), now.Add(-time.Second)),
+			secret:  secret,
+			body:    body,
+			wantErr: "mismatch",
+		},
+		{name: "replayed", header: Sign(secret, now.Add(-time.Hour), body), secret: secret, body: body, wantErr: "outside tolerance"},
+		{name: "from the future", header: Sign(secret, now.Add(time.Hour), body), secret: secret, body: body, wantErr: "outside tolerance"},
+		{name: "missing signature", header: "t=" + strconv.FormatInt(now.Unix(), 10), secret: secret, body: body, wantErr: "malformed"},
+		{name: "bad timestamp", header: "t=soon,v1=abc", secret: secret, body: body, wantErr: "malformed"},
+		{name: "empty", secret: secret, body: body, wantErr: "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// retime swaps the timestamp of a signature header, keeping its HMAC
+func retime(header string, t time.Time) string {
+	_, sig, _ := strings.Cut(header, ",")
+	return "t=" + strconv.FormatInt(t.Unix(), 10) + "," + sig
+}
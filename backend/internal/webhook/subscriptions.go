@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+
+	"connectfour/internal/db"
+	"connectfour/internal/event"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalid wraps every validation failure of a subscription
+var ErrInvalid = errors.New("invalid webhook")
+
+// Subscription is what the admin API accepts when creating or updating a
+// webhook. Nil fields are left unchanged on update.
+type Subscription struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// Create stores a new subscription with a freshly generated secret. The
+// secret is only ever returned here.
+func (d *Dispatcher) Create(s Subscription) (db.Webhook, error) {
+	h := db.Webhook{ID: uuid.New().String(), Events: []string{string(event.EventGameOver)}, Active: true}
+	if s.URL == nil {
+		return h, fmt.Errorf("%w: url is required", ErrInvalid)
+	}
+	if err := apply(&h, s); err != nil {
+		return h, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return h, err
+	}
+	h.Secret = "whsec_" + hex.EncodeToString(secret)
+
+	h, err := d.repo.CreateWebhook(h)
+	if err != nil {
+		return h, err
+	}
+	d.reloadAfterChange()
+	return h, nil
+}
+
+// Update changes the URL, filter or active flag of a subscription
+func (d *Dispatcher) Update(id string, s Subscription) (db.Webhook, error) {
+	h, err := d.repo.GetWebhook(id)
+	if err != nil {
+		return h, err
+	}
+	if err := apply(&h, s); err != nil {
+		return h, err
+	}
+	if err := d.repo.UpdateWebhook(h); err != nil {
+		return h, err
+	}
+	d.reloadAfterChange()
+	h.Secret = ""
+	return h, nil
+}
+
+func (d *Dispatcher) Delete(id string) error {
+	if err := d.repo.DeleteWebhook(id); err != nil {
+		return err
+	}
+	d.reloadAfterChange()
+	return nil
+}
+
+// List returns every subscription without its secret
+func (d *Dispatcher) List() ([]db.Webhook, error) {
+	hooks, err := d.repo.ListWebhooks()
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, err
+}
+
+// Get returns one subscription. The secret is kept for signing test
+// deliveries; callers must not expose it.
+func (d *Dispatcher) Get(id string) (db.Webhook, error) {
+	return d.repo.GetWebhook(id)
+}
+
+func (d *Dispatcher) Deliveries(id string, limit int) ([]db.WebhookDelivery, error) {
+	if _, err := d.repo.GetWebhook(id); err != nil {
+		return nil, err
+	}
+	return d.repo.ListWebhookDeliveries(id, limit)
+}
+
+func (d *Dispatcher) reloadAfterChange() {
+	if err := d.Reload(); err != nil {
+		// The periodic refresh will catch up
+		log.Printf("WEBHOOK ERROR: Could not reload subscriptions: %v", err)
+	}
+}
+
+// apply validates s and copies its set fields onto h
+func apply(h *db.Webhook, s Subscription) error {
+	if s.URL != nil {
+		u, err := url.Parse(*s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalid)
+		}
+		h.URL = *s.URL
+	}
+	if s.Events != nil {
+		if len(s.Events) == 0 {
+			return fmt.Errorf("%w: events must not be empty", ErrInvalid)
+		}
+		for _, name := range s.Events {
+			if name != "*" && !slices.Contains(event.EventTypes, event.EventType(name)) {
+				return fmt.Errorf("%w: unknown event %q", ErrInvalid, name)
+			}
+		}
+		h.Events = s.Events
+	}
+	if s.Active != nil {
+		h.Active = *s.Active
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package client speaks the game's WebSocket protocol, so bots, tools and
+// tests don't have to build models.WSMessage values by hand.
+//
+//	c, err := client.Dial("ws://localhost:8080/ws", client.Options{})
+//	if err != nil { ... }
+//	defer c.Close()
+//	c.Join(models.JoinPayload{Username: "alice"})
+//	for ev := range c.Events() {
+//		switch ev.Type {
+//		case models.MsgUpdate:
+//			if ev.Update.IsYourTurn {
+//				c.Move(3)
+//			}
+//		case models.MsgGameOver:
+//			...
+//		}
+//	}
+//
+// When the connection drops the client dials again and repeats its JOIN,
+// which puts it back into a running game (or back in the queue).
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connection events, delivered alongside the server's messages
+const (
+	Disconnected models.MessageType = "DISCONNECTED" // Err says why; a reconnect follows unless NoReconnect is set
+	Reconnected  models.MessageType = "RECONNECTED"  // The last JOIN, if any, has been sent again
+)
+
+var (
+	ErrClosed       = errors.New("client closed")
+	ErrNotConnected = errors.New("not connected")
+	ErrNotJoined    = errors.New("nothing to rejoin")
+)
+
+// Options tune a Client. The zero value is ready to use.
+type Options struct {
+	Dialer *websocket.Dialer // Defaults to websocket.DefaultDialer
+	Header http.Header       // Sent with every handshake
+
+	NoReconnect       bool          // End the event stream when the connection drops
+	ReconnectDelay    time.Duration // First wait before dialing again, doubled on each failure (default 500ms)
+	MaxReconnectDelay time.Duration // Upper bound for that wait (default 10s)
+	Buffer            int           // Events held while the reader is busy (default 64)
+}
+
+// Event is one message from the server. The field matching Type is set for
+// START, UPDATE, GAME_OVER and ERROR; other messages only carry Payload.
+type Event struct {
+	Type     models.MessageType
+	Start    *models.GameStartPayload
+	Update   *models.GameUpdatePayload
+	GameOver *models.GameOverPayload
+	Error    *models.ErrorPayload
+	Payload  json.RawMessage
+	Err      error // Why the connection dropped, or why Payload could not be decoded
+}
+
+// Client is a connection to the game server. Its methods are safe to call
+// from any goroutine.
+type Client struct {
+	url    string
+	opts   Options
+	events chan Event
+	done   chan struct{}
+
+	mutex  sync.Mutex
+	conn   *websocket.Conn
+	join   *models.JoinPayload // Repeated on reconnect while a game or queue is pending
+	closed bool
+}
+
+// Dial connects to a /ws endpoint
+func Dial(url string, opts Options) (*Client, error) {
+	if opts.Dialer == nil {
+		opts.Dialer = websocket.DefaultDialer
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 500 * time.Millisecond
+	}
+	if opts.MaxReconnectDelay < opts.ReconnectDelay {
+		opts.MaxReconnectDelay = max(10*time.Second, opts.ReconnectDelay)
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+
+	conn, _, err := opts.Dialer.Dial(url, opts.Header)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{url: url, opts: opts, conn: conn, events: make(chan Event, opts.Buffer), done: make(chan struct{})}
+	go c.run(conn)
+	return c, nil
+}
+
+// Events delivers server messages in order. It is closed after Close, or
+// when the connection drops with NoReconnect set.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Join queues for a game. If the server still has a game for this
+// username, it reattaches to it instead.
+func (c *Client) Join(join models.JoinPayload) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.join = &join
+	return c.send(models.WSMessage{Type: models.MsgJoin, Payload: join})
+}
+
+// Rejoin repeats the last JOIN, picking up a game this username was
+// playing. The client does this by itself after reconnecting.
+func (c *Client) Rejoin() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.join == nil {
+		return ErrNotJoined
+	}
+	return c.send(models.WSMessage{Type: models.MsgJoin, Payload: *c.join})
+}
+
+// Move drops a disc into column (0-6)
+func (c *Client) Move(column int) error {
+	return c.Send(models.WSMessage{Type: models.MsgMove, Payload: models.MovePayload{Column: column}})
+}
+
+// Resign gives up the current game
+func (c *Client) Resign() error {
+	return c.Send(models.WSMessage{Type: models.MsgResign})
+}
+
+// LeaveQueue stops waiting for an opponent
+func (c *Client) LeaveQueue() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.join = nil
+	return c.send(models.WSMessage{Type: models.MsgLeaveQueue})
+}
+
+// Send writes any other message, such as a draw offer or chat line
+func (c *Client) Send(msg models.WSMessage) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.send(msg)
+}
+
+// send must be called with c.mutex held
+func (c *Client) send(msg models.WSMessage) error {
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	return c.conn.WriteJSON(msg)
+}
+
+// Close hangs up. The server treats this like any other disconnect, so a
+// running game can still be rejoined from another client.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// run reads from conn, and its replacements after every reconnect, until
+// the client is closed
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.events)
+	for {
+		err := c.read(conn)
+
+		c.mutex.Lock()
+		closed := c.closed
+		c.conn = nil
+		c.mutex.Unlock()
+		conn.Close()
+		if closed {
+			return
+		}
+		c.emit(Event{Type: Disconnected, Err: err})
+		if c.opts.NoReconnect {
+			return
+		}
+
+		if conn = c.redial(); conn == nil {
+			return
+		}
+	}
+}
+
+// read forwards messages until the connection fails
+func (c *Client) read(conn *websocket.Conn) error {
+	for {
+		var msg struct {
+			Type    models.MessageType `json:"type"`
+			Payload json.RawMessage    `json:"payload"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		ev := Event{Type: msg.Type, Payload: msg.Payload}
+		switch msg.Type {
+		case models.MsgGameStart:
+			ev.Start = &models.GameStartPayload{}
+			ev.Err = decode(msg.Payload, ev.Start)
+		case models.MsgUpdate:
+			ev.Update = &models.GameUpdatePayload{}
+			ev.Err = decode(msg.Payload, ev.Update)
+		case models.MsgGameOver:
+			ev.GameOver = &models.GameOverPayload{}
+			ev.Err = decode(msg.Payload, ev.GameOver)
+			// Nothing left to rejoin once the series is over
+			if ev.Err == nil && (ev.GameOver.Series == nil || ev.GameOver.Series.Finished) {
+				c.mutex.Lock()
+				c.join = nil
+				c.mutex.Unlock()
+			}
+		case models.MsgError:
+			ev.Error = &models.ErrorPayload{}
+			ev.Err = decode(msg.Payload, ev.Error)
+		}
+		if !c.emit(ev) {
+			return ErrClosed
+		}
+	}
+}
+
+func decode(payload json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("decoding payload: %w", err)
+	}
+	return nil
+}
+
+// redial connects again, backing off between attempts, and repeats the
+// last JOIN. It returns nil if the client was closed meanwhile.
+func (c *Client) redial() *websocket.Conn {
+	delay := c.opts.ReconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return nil
+		}
+
+		conn, _, err := c.opts.Dialer.Dial(c.url, c.opts.Header)
+		if err != nil {
+			delay = min(delay*2, c.opts.MaxReconnectDelay)
+			continue
+		}
+
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.conn = conn
+		if c.join != nil {
+			err = c.send(models.WSMessage{Type: models.MsgJoin, Payload: *c.join})
+		}
+		if err != nil {
+			c.conn = nil
+		}
+		c.mutex.Unlock()
+		if err != nil {
+			conn.Close()
+			delay = min(delay*2, c.opts.MaxReconnectDelay)
+			continue
+		}
+
+		if !c.emit(Event{Type: Reconnected}) {
+			return nil
+		}
+		return conn
+	}
+}
+
+// emit hands ev to the reader, giving up if the client is closed first
+func (c *Client) emit(ev Event) bool {
+	select {
+	case c.events <- ev:
+		return true
+	case <-c.done:
+		return false
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectfour/pkg/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// server runs session on every connection made to it, numbered from 0. The
+// connection is closed when session returns.
+func server(t *testing.T, session func(n int, conn *websocket.Conn)) (url string) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	conns := make(chan int, 16)
+	for i := 0; i < cap(conns); i++ {
+		conns <- i
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		session(<-conns, conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// next reads the client's next event
+func next(t *testing.T, c *Client) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-c.Events():
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+// readJoin reads a JOIN from the client
+func readJoin(t *testing.T, conn *websocket.Conn) models.JoinPayload {
+	var msg struct {
+		Type    models.MessageType `json:"type"`
+		Payload models.JoinPayload `json:"payload"`
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != models.MsgJoin {
+		t.Errorf("read %s (%v), want JOIN", msg.Type, err)
+	}
+	return msg.Payload
+}
+
+func TestClientRejoinsAfterDrop(t *testing.T) {
+	joins := make(chan models.JoinPayload, 2)
+	url := server(t, func(n int, conn *websocket.Conn) {
+		joins <- readJoin(t, conn)
+		switch n {
+		case 0:
+			conn.WriteJSON(models.WSMessage{Type: models.MsgGameStart, Payload: models.GameStartPayload{GameID: "g1", Opponent: "bob", Symbol: 1, IsTurn: true}})
+			// Then hang up mid-game
+		case 1:
+			conn.WriteJSON(models.WSMessage{Type: models.MsgUpdate, Payload: models.GameUpdatePayload{Turn: 1, IsYourTurn: true}})
+			conn.ReadMessage() // Until the client closes
+		}
+	})
+
+	c, err := Dial(url, Options{ReconnectDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Join(models.JoinPayload{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := next(t, c); ev.Type != models.MsgGameStart || ev.Start == nil || ev.Start.GameID != "g1" || !ev.Start.IsTurn {
+		t.Fatalf("first event %+v, want the GAME_START of g1", ev)
+	}
+	if ev := next(t, c); ev.Type != Disconnected || ev.Err == nil {
+		t.Fatalf("event %+v after the drop, want DISCONNECTED with its cause", ev)
+	}
+	if ev := next(t, c); ev.Type != Reconnected {
+		t.Fatalf("event %+v, want RECONNECTED", ev)
+	}
+	if ev := next(t, c); ev.Type != models.MsgUpdate || ev.Update == nil || !ev.Update.IsYourTurn {
+		t.Fatalf("event %+v after rejoining, want the UPDATE", ev)
+	}
+	for i := 0; i < 2; i++ {
+		if join := <-joins; join.Username != "alice" {
+			t.Errorf("JOIN %d for %q, want alice", i+1, join.Username)
+		}
+	}
+
+	c.Close()
+	if _, ok := <-c.Events(); ok {
+		t.Error("event stream still open after Close")
+	}
+	if err := c.Move(3); err != ErrClosed {
+		t.Errorf("Move after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestClientForgetsFinishedGame(t *testing.T) {
+	received := make(chan models.MessageType, 4)
+	url := server(t, func(n int, conn *websocket.Conn) {
+		if n == 0 {
+			readJoin(t, conn)
+			conn.WriteJSON(models.WSMessage{Type: models.MsgGameOver, Payload: models.GameOverPayload{Winner: "alice", Reason: "resign"}})
+			return
+		}
+		// Whatever the client sends first after reconnecting
+		var msg models.WSMessage
+		if err := conn.ReadJSON(&msg); err == nil {
+			received <- msg.Type
+		}
+	})
+
+	c, err := Dial(url, Options{ReconnectDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Join(models.JoinPayload{Username: "alice"})
+
+	if ev := next(t, c); ev.Type != models.MsgGameOver || ev.GameOver == nil || ev.GameOver.Winner != "alice" {
+		t.Fatalf("first event %+v, want the GAME_OVER", ev)
+	}
+	next(t, c) // DISCONNECTED
+	if ev := next(t, c); ev.Type != Reconnected {
+		t.Fatalf("event %+v, want RECONNECTED", ev)
+	}
+	if err := c.Rejoin(); err != ErrNotJoined {
+		t.Errorf("Rejoin after the game = %v, want ErrNotJoined", err)
+	}
+	c.Send(models.WSMessage{Type: models.MsgLobbyEnter})
+	select {
+	case got := <-received:
+		if got != models.MsgLobbyEnter {
+			t.Errorf("first message after reconnecting %s, want no JOIN before LOBBY_ENTER", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("nothing sent after reconnecting")
+	}
+}
+
+func TestClientWithoutReconnect(t *testing.T) {
+	url := server(t, func(n int, conn *websocket.Conn) {
+		conn.WriteJSON(models.WSMessage{Type: models.MsgError, Payload: models.ErrorPayload{Message: "Server is restarting"}})
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"UPDATE","payload":"oops"}`))
+	})
+
+	c, err := Dial(url, Options{NoReconnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if ev := next(t, c); ev.Type != models.MsgError || ev.Error == nil || ev.Error.Message != "Server is restarting" {
+		t.Errorf("first event %+v, want the ERROR", ev)
+	}
+	if ev := next(t, c); ev.Type != models.MsgUpdate || ev.Err == nil || !json.Valid(ev.Payload) {
+		t.Errorf("event %+v, want an UPDATE that failed to decode, with its raw payload", ev)
+	}
+	if ev := next(t, c); ev.Type != Disconnected {
+		t.Errorf("event %+v, want DISCONNECTED", ev)
+	}
+	if _, ok := <-c.Events(); ok {
+		t.Error("event stream still open without reconnect")
+	}
+	if err := c.Move(3); err != ErrNotConnected {
+		t.Errorf("Move after the drop = %v, want ErrNotConnected", err)
+	}
+}
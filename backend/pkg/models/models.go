@@ -11,6 +11,42 @@ const (
 	MsgGameOver  MessageType = "GAME_OVER"
 	MsgError     MessageType = "ERROR"
 	MsgPing      MessageType = "PING"
+	MsgShutdown  MessageType = "SHUTDOWN"
+
+	MsgQueueStatus MessageType = "QUEUE_STATUS"
+	MsgLeaveQueue  MessageType = "LEAVE_QUEUE"
+
+	MsgLobbyEnter       MessageType = "LOBBY_ENTER"
+	MsgLobby            MessageType = "LOBBY"
+	MsgPresence         MessageType = "PRESENCE"
+	MsgChallenge        MessageType = "CHALLENGE"
+	MsgChallengeAccept  MessageType = "CHALLENGE_ACCEPT"
+	MsgChallengeDecline MessageType = "CHALLENGE_DECLINE"
+
+	MsgResign      MessageType = "RESIGN"
+	MsgDrawOffer   MessageType = "DRAW_OFFER"
+	MsgDrawAccept  MessageType = "DRAW_ACCEPT"
+	MsgDrawDecline MessageType = "DRAW_DECLINE"
+
+	MsgTakebackRequest MessageType = "TAKEBACK_REQUEST"
+	MsgTakebackAccept  MessageType = "TAKEBACK_ACCEPT"
+	MsgTakebackDecline MessageType = "TAKEBACK_DECLINE"
+
+	MsgRematchOffer   MessageType = "REMATCH_OFFER"
+	MsgRematchAccept  MessageType = "REMATCH_ACCEPT"
+	MsgRematchDecline MessageType = "REMATCH_DECLINE"
+
+	MsgChat     MessageType = "CHAT"
+	MsgEmote    MessageType = "EMOTE"
+	MsgMute     MessageType = "MUTE"
+	MsgUnmute   MessageType = "UNMUTE"
+	MsgBlock    MessageType = "BLOCK"
+	MsgUnblock  MessageType = "UNBLOCK"
+	MsgSpectate MessageType = "SPECTATE"
+
+	MsgTournamentJoin   MessageType = "TOURNAMENT_JOIN"
+	MsgTournamentWatch  MessageType = "TOURNAMENT_WATCH"
+	MsgTournamentUpdate MessageType = "TOURNAMENT_UPDATE"
 )
 
 // WSMessage is the envelope for all websocket communications
@@ -22,6 +58,19 @@ type WSMessage struct {
 // JoinPayload is sent by client to join queue
 type JoinPayload struct {
 	Username string `json:"username"`
+	Casual   bool   `json:"casual,omitempty"` // Unrated game, takebacks allowed
+	NoBot    bool   `json:"noBot,omitempty"`  // Keep waiting for a human instead of playing the bot
+}
+
+// QueueStatusPayload is sent to a queued player every matchmaker tick.
+// Clients leave the queue with LEAVE_QUEUE, without a payload.
+type QueueStatusPayload struct {
+	Position      int `json:"position"` // 1-based, among players wanting the same kind of game
+	Waiting       int `json:"waiting"`  // Players queued on this instance
+	Online        int `json:"online"`   // Players queued or playing on this instance
+	Waited        int `json:"waitedSeconds"`
+	EstimatedWait int `json:"estimatedWaitSeconds"` // -1 while there is nothing to go by
+	BotIn         int `json:"botInSeconds,omitempty"`
 }
 
 // MovePayload is sent by client to make a move
@@ -29,12 +78,40 @@ type MovePayload struct {
 	Column int `json:"column"`
 }
 
+// PresencePayload is a player's lobby status: "idle", "queued", "in_game",
+// or "offline" once they disconnect. Clients send LOBBY_ENTER with a
+// username and get a LOBBY listing everyone, then a PRESENCE per change.
+type PresencePayload struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+// LobbyPayload lists the players connected to this instance
+type LobbyPayload struct {
+	Players []PresencePayload `json:"players"`
+}
+
+// ChallengePayload is a direct game offer. Clients send CHALLENGE with the
+// opponent's username (and casual), and answer one with CHALLENGE_ACCEPT or
+// CHALLENGE_DECLINE naming the challenger. The server forwards a CHALLENGE
+// with From set, and sends CHALLENGE_DECLINE with a Reason when an offer
+// ends without a game.
+type ChallengePayload struct {
+	Username string `json:"username,omitempty"`
+	From     string `json:"from,omitempty"`
+	Casual   bool   `json:"casual,omitempty"`
+	Reason   string `json:"reason,omitempty"` // "declined", "withdrawn", "expired", "left" or "busy"
+}
+
 // GameStartPayload is sent to client when game begins
 type GameStartPayload struct {
-	GameID    string `json:"gameId"`
-	Opponent  string `json:"opponent"`
-	Symbol    int    `json:"symbol"` // 1 or 2
-	IsTurn    bool   `json:"isTurn"`
+	GameID   string       `json:"gameId"`
+	Opponent string       `json:"opponent"`
+	Symbol   int          `json:"symbol"` // 1 or 2
+	IsTurn   bool         `json:"isTurn"`
+	Rated    bool         `json:"rated"` // Casual games are unrated and allow takebacks
+	Series   *SeriesScore `json:"series,omitempty"`
+	MoveTime int          `json:"moveTimeMs,omitempty"` // Engines only: milliseconds they have for each move
 }
 
 // GameUpdatePayload sends the new board state
@@ -46,7 +123,92 @@ type GameUpdatePayload struct {
 
 // GameOverPayload sends the result
 type GameOverPayload struct {
-	Winner   string `json:"winner"` // Username or "Draw"
-	Reason   string `json:"reason"` // "connect4", "forfeit", "draw"
-	WinLines [][]int `json:"winLines,omitempty"` // Coordinates of winning discs
-}
\ No newline at end of file
+	Winner   string       `json:"winner"`             // Username or "Draw"
+	Reason   string       `json:"reason"`             // "connect4", "forfeit", "draw", "resign", "agreed_draw", "timeout"
+	WinLines [][]int      `json:"winLines,omitempty"` // Coordinates of winning discs
+	Series   *SeriesScore `json:"series,omitempty"`   // Score including this game
+}
+
+// SeriesScore is the state of the best-of-N series a game belongs to
+type SeriesScore struct {
+	SeriesID string         `json:"seriesId"`
+	BestOf   int            `json:"bestOf"`
+	Game     int            `json:"game"` // 1-based number of the current game
+	Wins     map[string]int `json:"wins"` // Games won, by username
+	Draws    int            `json:"draws"`
+	Finished bool           `json:"finished"`
+	Winner   string         `json:"winner,omitempty"` // Username or "Draw", once finished
+}
+
+// ErrorPayload explains why a client request was rejected
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+// ShutdownPayload warns clients that the server is going away
+type ShutdownPayload struct {
+	Message     string `json:"message"`
+	GracePeriod int    `json:"gracePeriodSeconds"` // Time left to finish a running game
+}
+
+// DrawPayload is sent to a player when their opponent offers a draw
+// (DRAW_OFFER) or turns theirs down (DRAW_DECLINE). Clients send RESIGN and
+// the DRAW messages without a payload. An offer stands until it is answered
+// or the player it was made to moves.
+type DrawPayload struct {
+	From string `json:"from"`
+}
+
+// TakebackPayload is sent to a player when their opponent asks to take
+// their last move back (TAKEBACK_REQUEST) or refuses (TAKEBACK_DECLINE).
+// Clients send the TAKEBACK messages without a payload. A granted takeback
+// is followed by an UPDATE with the board before the move.
+type TakebackPayload struct {
+	From string `json:"from"`
+}
+
+// RematchPayload is sent to a player when their last opponent offers a
+// rematch (REMATCH_OFFER) or turns it down (REMATCH_DECLINE). Clients send
+// the three REMATCH messages without a payload.
+type RematchPayload struct {
+	From   string `json:"from,omitempty"`
+	Reason string `json:"reason,omitempty"` // "declined", "left" or "expired"
+}
+
+// ChatPayload is a chat line. Clients send only the text; the server adds
+// the sender when relaying it to both players and spectators.
+type ChatPayload struct {
+	From string `json:"from,omitempty"`
+	Text string `json:"text"`
+}
+
+// EmotePayload is a quick reaction, one of a fixed set (see chat.Emotes)
+type EmotePayload struct {
+	From  string `json:"from,omitempty"`
+	Emote string `json:"emote"`
+}
+
+// UserPayload names the player to MUTE, UNMUTE, BLOCK or UNBLOCK
+type UserPayload struct {
+	Username string `json:"username"`
+}
+
+// SpectatePayload asks to watch a game, by ID or by one of its players.
+// The server answers with the players and board, and again whenever the
+// next game of a series starts.
+type SpectatePayload struct {
+	GameID   string       `json:"gameId,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Player1  string       `json:"player1,omitempty"`
+	Player2  string       `json:"player2,omitempty"`
+	Board    *[6][7]int   `json:"board,omitempty"`
+	Turn     int          `json:"turn,omitempty"`
+	Series   *SeriesScore `json:"series,omitempty"`
+}
+
+// TournamentJoinPayload is sent by a client to play in a tournament
+// (TOURNAMENT_JOIN) or just follow it (TOURNAMENT_WATCH, no username)
+type TournamentJoinPayload struct {
+	TournamentID string `json:"tournamentId"`
+	Username     string `json:"username,omitempty"`
+}
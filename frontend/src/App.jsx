@@ -21,13 +21,27 @@ const styles = {
   log: { marginTop: '20px', fontSize: '12px', color: '#aaa' }
 };
 
+const EMOTES = { hello: '👋', gg: '🤝', good_move: '👏', oops: '😬', thinking: '🤔', wow: '😮', thanks: '🙏' };
+
 export default function App() {
   const [socket, setSocket] = useState(null);
   const [view, setView] = useState('login'); 
   const [username, setUsername] = useState('');
-  const [gameInfo, setGameInfo] = useState({ opponent: '', symbol: 0, isTurn: false });
+  const [casual, setCasual] = useState(false);
+  const [noBot, setNoBot] = useState(false);
+  const [queue, setQueue] = useState(null);
+  const [lobby, setLobby] = useState({}); // username -> status
+  const [challenges, setChallenges] = useState([]); // incoming, by challenger
+  const [lobbyNote, setLobbyNote] = useState('');
+  const [gameInfo, setGameInfo] = useState({ opponent: '', symbol: 0, isTurn: false, rated: false });
   const [board, setBoard] = useState(Array(6).fill(null).map(() => Array(7).fill(0)));
   const [winner, setWinner] = useState(null);
+  const [series, setSeries] = useState(null);
+  const [rematch, setRematch] = useState(null); // null, 'offered', { from } or { reason }
+  const [drawOffer, setDrawOffer] = useState(null); // null, 'sent' or the opponent's name
+  const [takeback, setTakeback] = useState(null); // null, 'sent' or the opponent's name
+  const [chat, setChat] = useState([]);
+  const [chatText, setChatText] = useState('');
   const [leaderboardData, setLeaderboardData] = useState([]);
   
   useEffect(() => {
@@ -49,36 +63,138 @@ export default function App() {
         setGameInfo({ 
           opponent: msg.payload.opponent, 
           symbol: msg.payload.symbol, 
-          isTurn: msg.payload.isTurn 
+          isTurn: msg.payload.isTurn,
+          rated: msg.payload.rated
         });
         // Reset board and winner state when a new game starts
         setBoard(Array(6).fill(null).map(() => Array(7).fill(0)));
         setWinner(null);
+        setSeries(msg.payload.series || null);
+        setRematch(null);
+        setDrawOffer(null);
         setView('game');
         break;
+      case 'LOBBY':
+        setLobby(Object.fromEntries(msg.payload.players.map(p => [p.username, p.status])));
+        break;
+      case 'PRESENCE':
+        setLobby(prev => {
+          const next = { ...prev, [msg.payload.username]: msg.payload.status };
+          if (msg.payload.status === 'offline') delete next[msg.payload.username];
+          return next;
+        });
+        break;
+      case 'CHALLENGE':
+        setChallenges(prev => [...prev.filter(c => c.from !== msg.payload.from), msg.payload]);
+        break;
+      case 'CHALLENGE_DECLINE':
+        setChallenges(prev => prev.filter(c => c.from !== msg.payload.username));
+        setLobbyNote(`Challenge with ${msg.payload.username}: ${msg.payload.reason}`);
+        break;
+      case 'QUEUE_STATUS':
+        setQueue(msg.payload);
+        break;
       case 'UPDATE':
         setBoard(msg.payload.board);
         setGameInfo(prev => ({ ...prev, isTurn: msg.payload.isYourTurn }));
+        // An offer lapses once the player it was made to moves
+        setDrawOffer(prev => prev && (prev === 'sent') === msg.payload.isYourTurn ? null : prev);
+        setTakeback(null);
         break;
       case 'GAME_OVER':
         setWinner(msg.payload.winner);
+        setDrawOffer(null);
+        setSeries(msg.payload.series || null);
         setView('gameover');
         break;
+      case 'CHAT':
+        setChat(prev => [...prev.slice(-49), `${msg.payload.from}: ${msg.payload.text}`]);
+        break;
+      case 'EMOTE':
+        setChat(prev => [...prev.slice(-49), `${msg.payload.from} ${EMOTES[msg.payload.emote] || msg.payload.emote}`]);
+        break;
+      case 'ERROR':
+        setChat(prev => [...prev.slice(-49), `⚠️ ${msg.payload.message}`]);
+        break;
+      case 'DRAW_OFFER':
+        setDrawOffer(msg.payload.from);
+        break;
+      case 'DRAW_DECLINE':
+        setDrawOffer(null);
+        setChat(prev => [...prev.slice(-49), `${msg.payload.from} declined the draw`]);
+        break;
+      case 'TAKEBACK_REQUEST':
+        setTakeback(msg.payload.from);
+        break;
+      case 'TAKEBACK_DECLINE':
+        setTakeback(null);
+        setChat(prev => [...prev.slice(-49), `${msg.payload.from} refused the takeback`]);
+        break;
+      case 'REMATCH_OFFER':
+        setRematch({ from: msg.payload.from });
+        break;
+      case 'REMATCH_DECLINE':
+        setRematch({ reason: msg.payload.reason });
+        break;
       default: break;
     }
   };
 
   const joinGame = () => {
     if (!username || !socket) return;
-    socket.send(JSON.stringify({ type: 'JOIN', payload: { username } }));
+    socket.send(JSON.stringify({ type: 'JOIN', payload: { username, casual, noBot } }));
+    setQueue(null);
     setView('matching');
   };
 
+  const enterLobby = () => {
+    if (!username || !socket) return;
+    socket.send(JSON.stringify({ type: 'LOBBY_ENTER', payload: { username } }));
+    setView('lobby');
+  };
+
+  const sendChallenge = (type, name) => {
+    socket.send(JSON.stringify({ type, payload: { username: name, casual } }));
+    if (type === 'CHALLENGE') setLobbyNote(`Challenged ${name}...`);
+    else setChallenges(prev => prev.filter(c => c.from !== name));
+  };
+
+  const leaveQueue = () => {
+    socket.send(JSON.stringify({ type: 'LEAVE_QUEUE' }));
+    setView('login');
+  };
+
   const makeMove = (colIndex) => {
     if (!gameInfo.isTurn || view !== 'game') return;
     socket.send(JSON.stringify({ type: 'MOVE', payload: { column: colIndex } }));
   };
 
+  const sendChat = () => {
+    if (!chatText.trim()) return;
+    socket.send(JSON.stringify({ type: 'CHAT', payload: { text: chatText } }));
+    setChatText('');
+  };
+
+  const sendEmote = (emote) => {
+    socket.send(JSON.stringify({ type: 'EMOTE', payload: { emote } }));
+  };
+
+  const sendMute = (type) => {
+    socket.send(JSON.stringify({ type, payload: { username: gameInfo.opponent } }));
+    setChat(prev => [...prev, `🔇 ${gameInfo.opponent} muted`]);
+  };
+
+  const sendAction = (type) => {
+    socket.send(JSON.stringify({ type }));
+    if (type.startsWith('DRAW')) setDrawOffer(type === 'DRAW_OFFER' ? 'sent' : null);
+    if (type.startsWith('TAKEBACK')) setTakeback(type === 'TAKEBACK_REQUEST' ? 'sent' : null);
+  };
+
+  const sendRematch = (type) => {
+    socket.send(JSON.stringify({ type }));
+    setRematch(type === 'REMATCH_DECLINE' ? null : 'offered');
+  };
+
   const fetchLeaderboard = async () => {
     try {
       console.log("Fetching Leaderboard from:", `${API_URL}/leaderboard`);
@@ -109,7 +225,14 @@ export default function App() {
             onChange={e => setUsername(e.target.value)} 
           />
           <button style={styles.button} onClick={joinGame}>Find Match</button>
+          <button style={styles.secondaryButton} onClick={enterLobby}>Lobby</button>
         </div>
+        <label style={{marginBottom: '20px'}}>
+          <input type="checkbox" checked={casual} onChange={e => setCasual(e.target.checked)} /> Casual (unrated, takebacks allowed)
+        </label>
+        <label style={{marginBottom: '20px'}}>
+          <input type="checkbox" checked={noBot} onChange={e => setNoBot(e.target.checked)} /> Wait for a human (no bot)
+        </label>
         <button style={styles.secondaryButton} onClick={fetchLeaderboard}>🏆 View Leaderboard</button>
       </div>
     );
@@ -125,6 +248,7 @@ export default function App() {
               <th style={styles.th}>Rank</th>
               <th style={styles.th}>Player</th>
               <th style={styles.th}>Wins</th>
+              <th style={styles.th}>Rating</th>
             </tr>
           </thead>
           <tbody>
@@ -133,9 +257,10 @@ export default function App() {
                 <td style={styles.td}>#{index + 1}</td>
                 <td style={styles.td}>{entry.username}</td>
                 <td style={styles.td}>{entry.wins}</td>
+                <td style={styles.td}>{entry.rating || '–'}</td>
               </tr>
             )) : (
-              <tr><td colSpan="3" style={styles.td}>No games played yet</td></tr>
+              <tr><td colSpan="4" style={styles.td}>No games played yet</td></tr>
             )}
           </tbody>
         </table>
@@ -144,12 +269,51 @@ export default function App() {
     );
   }
 
+  if (view === 'lobby') {
+    return (
+      <div style={styles.container}>
+        <h1>Lobby</h1>
+        {challenges.map(c => (
+          <div key={c.from}>
+            {c.from} challenges you{c.casual ? ' (casual)' : ''}
+            <button style={styles.button} onClick={() => sendChallenge('CHALLENGE_ACCEPT', c.from)}>Accept</button>
+            <button style={styles.secondaryButton} onClick={() => sendChallenge('CHALLENGE_DECLINE', c.from)}>Decline</button>
+          </div>
+        ))}
+        <table style={styles.table}>
+          <tbody>
+            {Object.entries(lobby).filter(([name]) => name !== username).map(([name, status]) => (
+              <tr key={name}>
+                <td style={styles.td}>{name}</td>
+                <td style={styles.td}>{status.replace('_', ' ')}</td>
+                <td style={styles.td}>
+                  {status === 'idle' && <button onClick={() => sendChallenge('CHALLENGE', name)}>Challenge</button>}
+                </td>
+              </tr>
+            ))}
+          </tbody>
+        </table>
+        <p style={styles.log}>{lobbyNote}</p>
+        <button style={styles.secondaryButton} onClick={joinGame}>Find Match Instead</button>
+      </div>
+    );
+  }
+
   if (view === 'matching') {
     return (
       <div style={styles.container}>
         <h2>Looking for opponent...</h2>
-        <p>If no one joins in 10s, you will play the Bot.</p>
+        {queue ? (
+          <p>
+            #{queue.position} in line · {queue.online} online · waited {queue.waitedSeconds}s
+            {queue.estimatedWaitSeconds >= 0 && ` · about ${queue.estimatedWaitSeconds}s to go`}
+            {queue.botInSeconds > 0 && ` · Bot in ${queue.botInSeconds}s`}
+          </p>
+        ) : (
+          <p>{noBot ? 'Waiting for a human opponent.' : 'If no one joins in 10s, you will play the Bot.'}</p>
+        )}
         <div className="loader">⏳</div>
+        <button style={styles.secondaryButton} onClick={leaveQueue}>Leave Queue</button>
       </div>
     );
   }
@@ -182,8 +346,55 @@ export default function App() {
         ))}
       </div>
 
-      {view === 'gameover' && (
+      {series && series.bestOf > 1 && (
+        <div style={styles.log}>
+          Game {series.game} of {series.bestOf} · {username} {series.wins[username] || 0} – {series.wins[gameInfo.opponent] || 0} {gameInfo.opponent}
+          {series.finished ? ` · Series winner: ${series.winner}` : (view === 'gameover' ? ' · Next game starting soon' : '')}
+        </div>
+      )}
+
+      {view === 'game' && (
+        <div style={{display: 'flex', gap: '10px'}}>
+          {drawOffer && drawOffer !== 'sent' ? (
+            <>
+              <p>{drawOffer} offers a draw</p>
+              <button style={styles.button} onClick={() => sendAction('DRAW_ACCEPT')}>Accept</button>
+              <button style={styles.secondaryButton} onClick={() => sendAction('DRAW_DECLINE')}>Decline</button>
+            </>
+          ) : (
+            <button style={styles.secondaryButton} disabled={drawOffer === 'sent'} onClick={() => sendAction('DRAW_OFFER')}>
+              {drawOffer === 'sent' ? 'Draw offered' : 'Offer Draw'}
+            </button>
+          )}
+          {!gameInfo.rated && (takeback && takeback !== 'sent' ? (
+            <>
+              <p>{takeback} wants to take back a move</p>
+              <button style={styles.button} onClick={() => sendAction('TAKEBACK_ACCEPT')}>Allow</button>
+              <button style={styles.secondaryButton} onClick={() => sendAction('TAKEBACK_DECLINE')}>Refuse</button>
+            </>
+          ) : (
+            <button style={styles.secondaryButton} disabled={takeback === 'sent'} onClick={() => sendAction('TAKEBACK_REQUEST')}>
+              {takeback === 'sent' ? 'Takeback asked' : 'Take Back'}
+            </button>
+          ))}
+          <button style={styles.secondaryButton} onClick={() => window.confirm('Resign this game?') && sendAction('RESIGN')}>Resign</button>
+        </div>
+      )}
+
+      {view === 'gameover' && (!series || series.finished) && (
          <div style={{display: 'flex', gap: '10px'}}>
+           {rematch === null && (
+             <button style={styles.button} onClick={() => sendRematch('REMATCH_OFFER')}>Rematch</button>
+           )}
+           {rematch === 'offered' && <p>Waiting for {gameInfo.opponent}...</p>}
+           {rematch && rematch.from && (
+             <>
+               <p>{rematch.from} wants a rematch</p>
+               <button style={styles.button} onClick={() => sendRematch('REMATCH_ACCEPT')}>Accept</button>
+               <button style={styles.secondaryButton} onClick={() => sendRematch('REMATCH_DECLINE')}>Decline</button>
+             </>
+           )}
+           {rematch && rematch.reason && <p>No rematch ({rematch.reason})</p>}
            <button style={styles.button} onClick={() => window.location.reload()}>Play Again</button>
            <button style={styles.secondaryButton} onClick={fetchLeaderboard}>View Leaderboard</button>
          </div>
@@ -192,6 +403,26 @@ export default function App() {
       <div style={styles.log}>
         You are Player {gameInfo.symbol} vs {gameInfo.opponent}
       </div>
+
+      <div style={{...styles.log, width: '350px', textAlign: 'left'}}>
+        {chat.map((line, i) => <div key={i}>{line}</div>)}
+        <div style={{display: 'flex', gap: '4px', marginTop: '6px'}}>
+          {Object.entries(EMOTES).map(([name, icon]) => (
+            <button key={name} title={name} onClick={() => sendEmote(name)}>{icon}</button>
+          ))}
+        </div>
+        <div style={{display: 'flex', gap: '4px', marginTop: '6px'}}>
+          <input
+            style={{...styles.input, margin: 0, flex: 1}}
+            placeholder="Say something"
+            maxLength={200}
+            value={chatText}
+            onChange={e => setChatText(e.target.value)}
+            onKeyDown={e => e.key === 'Enter' && sendChat()}
+          />
+          <button onClick={() => sendMute('MUTE')}>Mute</button>
+        </div>
+      </div>
     </div>
   );
 }
\ No newline at end of file